@@ -4,9 +4,21 @@ type FileType string
 
 type TemplateTypePath string
 
+type PayloadFormat string
+
+// PayloadFormat: encoding of the Bartender action payload
+const (
+	PayloadFormatYaml PayloadFormat = "yaml"
+	PayloadFormatJson PayloadFormat = "json"
+)
+
+// FileType: export_format of a template, the record set file read by the Bartender database connection
 const (
-	FileTypeTxt FileType = "txt"
-	FileTypeCsv FileType = "csv"
+	FileTypeTxt  FileType = "txt"
+	FileTypeCsv  FileType = "csv"
+	FileTypeJson FileType = "json"
+	FileTypeXml  FileType = "xml"
+	FileTypeXlsx FileType = "xlsx"
 )
 
 const (
@@ -16,6 +28,142 @@ const (
 	AdultUs TemplateTypePath = "adultus"
 )
 
+type Market string
+
+// Market: size system of a label template, a size chart or a size field
+const (
+	MarketVn Market = "vn"
+	MarketUs Market = "us"
+	MarketUk Market = "uk"
+)
+
+type FailureStage string
+
+// FailureStage: the step of the pipeline where a message was given up and sent to the dead-letter topic
+const (
+	FailureStageParse       FailureStage = "parse"
+	FailureStageDeduplicate FailureStage = "deduplicate"
+	FailureStageTemplate    FailureStage = "template"
+	FailureStageValidate    FailureStage = "validate"
+	FailureStageRoute       FailureStage = "route"
+	FailureStageExport      FailureStage = "export"
+	FailureStageEnqueue     FailureStage = "enqueue"
+	FailureStagePrint       FailureStage = "print"
+)
+
+type RetentionAction string
+
+// RetentionAction: what happens to an exported file once its job completed and it aged out
+const (
+	RetentionActionDelete  RetentionAction = "delete"
+	RetentionActionArchive RetentionAction = "archive" // moved to the archive directory, deleted later
+)
+
+type KafkaSecurityProtocol string
+
+// KafkaSecurityProtocol: how the consumer and the producer connect to the brokers
+const (
+	KafkaSecurityPlaintext     KafkaSecurityProtocol = "plaintext"
+	KafkaSecuritySsl           KafkaSecurityProtocol = "ssl"
+	KafkaSecuritySaslPlaintext KafkaSecurityProtocol = "sasl_plaintext"
+	KafkaSecuritySaslSsl       KafkaSecurityProtocol = "sasl_ssl"
+)
+
+type KafkaSaslMechanism string
+
+// KafkaSaslMechanism: how the SASL listeners authenticate the user
+const (
+	KafkaSaslPlain       KafkaSaslMechanism = "PLAIN"
+	KafkaSaslScramSha256 KafkaSaslMechanism = "SCRAM-SHA-256"
+	KafkaSaslScramSha512 KafkaSaslMechanism = "SCRAM-SHA-512"
+)
+
+type ValidationPolicy string
+
+// ValidationPolicy: what happens to a print request holding invalid products
+const (
+	ValidationPolicyRejectBatch ValidationPolicy = "reject_batch" // nothing is printed
+	ValidationPolicyDropInvalid ValidationPolicy = "drop_invalid" // the valid products are printed
+)
+
+type ValidationRule string
+
+// ValidationRule: the check a product failed
+const (
+	ValidationRuleRequired     ValidationRule = "required"
+	ValidationRuleEnum         ValidationRule = "enum"
+	ValidationRulePattern      ValidationRule = "pattern"
+	ValidationRuleMaxLength    ValidationRule = "max_length"
+	ValidationRuleSizeChart    ValidationRule = "size_chart"    // the size is not in the size chart of the gender
+	ValidationRuleSizeMismatch ValidationRule = "size_mismatch" // us_size, vn_size and uk_size are not the same size
+)
+
+type ErrorClass string
+
+// ErrorClass: whether a failed print attempt is worth retrying
+const (
+	ErrorClassTransient ErrorClass = "transient" // network errors, timeouts, 5xx, faulted actions
+	ErrorClassPermanent ErrorClass = "permanent" // 4xx, broken payload, missing template
+)
+
+type CircuitState string
+
+// CircuitState: state of the circuit breaker in front of the Bartender API
+const (
+	CircuitClosed   CircuitState = "closed"    // calls go through
+	CircuitOpen     CircuitState = "open"      // workers are paused
+	CircuitHalfOpen CircuitState = "half_open" // a probe decides whether to resume
+)
+
+type PrinterCapability string
+
+// PrinterCapability: kind of labels a printer can print
+const (
+	PrinterCapabilityRfid  PrinterCapability = "rfid"  // encodes RFID tags
+	PrinterCapabilityPlain PrinterCapability = "plain" // plain labels only
+)
+
+type PrintJobEventType string
+
+// PrintJobEventType: lifecycle events published to the print job status topic
+const (
+	PrintJobEventReceived  PrintJobEventType = "received"
+	PrintJobEventExported  PrintJobEventType = "exported"
+	PrintJobEventSubmitted PrintJobEventType = "submitted"
+	PrintJobEventRunning   PrintJobEventType = "running"
+	PrintJobEventCompleted PrintJobEventType = "completed"
+	PrintJobEventFailed    PrintJobEventType = "failed"
+	PrintJobEventDuplicate PrintJobEventType = "duplicate"
+
+	// Some products were skipped, their RFIDs were already printed or queued
+	PrintJobEventPartialDuplicate PrintJobEventType = "partial_duplicate"
+)
+
+type DedupMessageKey string
+
+// DedupMessageKey: what identifies a print request when looking for duplicates
+const (
+	DedupMessageKeyMessageId   DedupMessageKey = "message_id" // falls back to the content hash when BOM sends no message id
+	DedupMessageKeyOrderId     DedupMessageKey = "order_id"
+	DedupMessageKeyContentHash DedupMessageKey = "content_hash"
+)
+
+type BartenderActionStatus string
+
+// BartenderActionStatus: status of an Integration Builder action, WaitingToRun → Running → RanToCompletion/Faulted/Canceled
+const (
+	BartenderActionWaitingToRun    BartenderActionStatus = "WaitingToRun"
+	BartenderActionRunning         BartenderActionStatus = "Running"
+	BartenderActionRanToCompletion BartenderActionStatus = "RanToCompletion"
+	BartenderActionFaulted         BartenderActionStatus = "Faulted"
+	BartenderActionCanceled        BartenderActionStatus = "Canceled"
+)
+
+// IsTerminal reports whether Bartender finished the action
+func (s BartenderActionStatus) IsTerminal() bool {
+	return s == BartenderActionRanToCompletion || s == BartenderActionFaulted || s == BartenderActionCanceled
+}
+
 type AdultSizeAvailable string
 
 // AdultSizeAvailable: XS, S, M, L, XL, 2XL, 3XL
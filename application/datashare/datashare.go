@@ -0,0 +1,230 @@
+package datashare
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	tmpExt = ".tmp"
+
+	// A temporary file this old was left by a crash while exporting
+	staleTmpAge = time.Hour
+)
+
+// WriteFile writes path through a hidden temporary file in the same directory, renamed into
+// place once complete, so Bartender never reads a partial export
+func WriteFile(path string, write func(w io.Writer) error) (err error) {
+	tmp := tmpPath(path)
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	if err = write(file); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// tmpPath is hidden from the sweeper and from the Bartender file lookups
+func tmpPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+tmpExt)
+}
+
+// Options of the sweeper, a zero value disables the check
+type Options struct {
+	Pattern       *regexp.Regexp // Names of the exports, other files are never touched
+	MaxAge        time.Duration  // Completed exports older than this are archived or deleted
+	MaxBytes      int64          // Cap of the exports and the archive, the oldest completed files are deleted first
+	MinAge        time.Duration  // Completed exports younger than this are never removed by the size cap
+	ArchiveDir    string         // Completed exports are moved here instead of deleted
+	ArchiveMaxAge time.Duration  // Archived files older than this are deleted
+}
+
+// Result counts the files a sweep removed from the share
+type Result struct {
+	Archived   int
+	Deleted    int
+	FreedBytes int64
+}
+
+// file is an export or an archived export
+type file struct {
+	path     string
+	name     string
+	size     int64
+	modTime  time.Time
+	archived bool
+}
+
+// Sweeper enforces the retention of the exported files in a directory. Only the files named
+// like an export are touched, hidden files and directories such as the queue or the image
+// cache never are.
+type Sweeper struct {
+	dir  string
+	opts Options
+}
+
+// NewSweeper returns a sweeper of the exports in dir
+func NewSweeper(dir string, opts Options) (*Sweeper, error) {
+	if opts.Pattern == nil {
+		return nil, errors.New("sweeper needs the pattern of the export names")
+	}
+	if opts.ArchiveDir != "" {
+		if err := os.MkdirAll(opts.ArchiveDir, 0755); err != nil {
+			return nil, errors.Wrapf(err, "create archive directory %s", opts.ArchiveDir)
+		}
+	}
+	return &Sweeper{dir: dir, opts: opts}, nil
+}
+
+// Sweep archives or deletes the completed exports, active holds the file names of the jobs
+// that are still exporting, queued or printing
+func (s *Sweeper) Sweep(now time.Time, active map[string]bool) (Result, error) {
+	var result Result
+	exports, err := s.list(s.dir, false)
+	if err != nil {
+		return result, err
+	}
+	var archive []file
+	if s.opts.ArchiveDir != "" {
+		if archive, err = s.list(s.opts.ArchiveDir, true); err != nil {
+			return result, err
+		}
+	}
+
+	var failed []string
+	remove := func(f file) {
+		if err := os.Remove(f.path); err != nil {
+			failed = append(failed, err.Error())
+			return
+		}
+		result.Deleted++
+		result.FreedBytes += f.size
+	}
+
+	// Completed exports past their age, kept exports stay candidates for the size cap
+	var kept []file
+	var total int64
+	for _, f := range exports {
+		if active[f.name] || s.opts.MaxAge <= 0 || now.Sub(f.modTime) < s.opts.MaxAge {
+			kept = append(kept, f)
+			total += f.size
+			continue
+		}
+		if s.opts.ArchiveDir == "" {
+			remove(f)
+			continue
+		}
+		target := filepath.Join(s.opts.ArchiveDir, f.name)
+		if err := os.Rename(f.path, target); err != nil {
+			failed = append(failed, err.Error())
+			kept = append(kept, f)
+			total += f.size
+			continue
+		}
+		result.Archived++
+		f.path, f.archived = target, true
+		archive = append(archive, f)
+	}
+
+	// Archived files past their age
+	var archived []file
+	for _, f := range archive {
+		if s.opts.ArchiveMaxAge > 0 && now.Sub(f.modTime) >= s.opts.ArchiveMaxAge {
+			remove(f)
+			continue
+		}
+		archived = append(archived, f)
+		total += f.size
+	}
+
+	// Size cap, the oldest completed files go first, exports of active jobs and exports completed
+	// less than MinAge ago are never removed
+	if s.opts.MaxBytes > 0 && total > s.opts.MaxBytes {
+		var candidates []file
+		for _, f := range append(archived, kept...) {
+			if f.archived || (!active[f.name] && now.Sub(f.modTime) >= s.opts.MinAge) {
+				candidates = append(candidates, f)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].modTime.Before(candidates[j].modTime)
+		})
+		for _, f := range candidates {
+			if total <= s.opts.MaxBytes {
+				break
+			}
+			deleted := result.Deleted
+			remove(f)
+			if result.Deleted > deleted {
+				total -= f.size
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return result, errors.Errorf("failed to remove %d files: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return result, nil
+}
+
+// list returns the files of dir, stale temporary files of a crashed export are removed
+func (s *Sweeper) list(dir string, archived bool) ([]file, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []file
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(name, ".") {
+			export := strings.TrimSuffix(strings.TrimPrefix(name, "."), tmpExt)
+			if strings.HasSuffix(name, tmpExt) && s.opts.Pattern.MatchString(export) && time.Since(info.ModTime()) > staleTmpAge {
+				os.Remove(filepath.Join(dir, name))
+			}
+			continue
+		}
+		if !s.opts.Pattern.MatchString(name) {
+			continue
+		}
+		files = append(files, file{
+			path:     filepath.Join(dir, name),
+			name:     name,
+			size:     info.Size(),
+			modTime:  info.ModTime(),
+			archived: archived,
+		})
+	}
+	return files, nil
+}
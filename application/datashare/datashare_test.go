@@ -0,0 +1,207 @@
+package datashare
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPattern = regexp.MustCompile(`^export-[0-9]+\.csv$`)
+
+// createFile writes size bytes to dir/name, last modified age ago
+func createFile(t *testing.T, dir, name string, size int, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSweep(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		active  []string
+		remain  []string // Files left in the share
+		archive []string // Files moved to the archive
+		result  Result
+	}{
+		{
+			name:   "no retention",
+			remain: []string{"export-1.csv", "export-2.csv", "export-3.csv", "notes.txt"},
+		},
+		{
+			name:   "old exports are deleted",
+			opts:   Options{MaxAge: 24 * time.Hour},
+			remain: []string{"export-3.csv", "notes.txt"},
+			result: Result{Deleted: 2, FreedBytes: 300},
+		},
+		{
+			name:   "active exports are kept",
+			opts:   Options{MaxAge: 24 * time.Hour},
+			active: []string{"export-1.csv"},
+			remain: []string{"export-1.csv", "export-3.csv", "notes.txt"},
+			result: Result{Deleted: 1, FreedBytes: 200},
+		},
+		{
+			name:    "old exports are archived",
+			opts:    Options{MaxAge: 24 * time.Hour, ArchiveDir: "archive"},
+			remain:  []string{"export-3.csv", "notes.txt"},
+			archive: []string{"export-1.csv", "export-2.csv"},
+			result:  Result{Archived: 2},
+		},
+		{
+			name:    "old archived files are deleted",
+			opts:    Options{MaxAge: 24 * time.Hour, ArchiveDir: "archive", ArchiveMaxAge: 48 * time.Hour},
+			remain:  []string{"export-3.csv", "notes.txt"},
+			archive: []string{"export-2.csv"},
+			result:  Result{Archived: 2, Deleted: 1, FreedBytes: 100},
+		},
+		{
+			name:   "size cap deletes the oldest first",
+			opts:   Options{MaxBytes: 500},
+			remain: []string{"export-2.csv", "export-3.csv", "notes.txt"},
+			result: Result{Deleted: 1, FreedBytes: 100},
+		},
+		{
+			name:   "size cap spares active exports",
+			opts:   Options{MaxBytes: 300},
+			active: []string{"export-1.csv"},
+			remain: []string{"export-1.csv", "notes.txt"},
+			result: Result{Deleted: 2, FreedBytes: 500},
+		},
+		{
+			name:   "size cap spares fresh exports",
+			opts:   Options{MaxBytes: 100, MinAge: 2 * time.Hour},
+			remain: []string{"export-3.csv", "notes.txt"},
+			result: Result{Deleted: 2, FreedBytes: 300},
+		},
+		{
+			name:   "fresh exports over the cap are kept",
+			opts:   Options{MaxBytes: 100, MinAge: 100 * time.Hour},
+			remain: []string{"export-1.csv", "export-2.csv", "export-3.csv", "notes.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			createFile(t, dir, "export-1.csv", 100, 72*time.Hour)
+			createFile(t, dir, "export-2.csv", 200, 36*time.Hour)
+			createFile(t, dir, "export-3.csv", 300, time.Hour)
+			// Not an export, never touched however old or large
+			createFile(t, dir, "notes.txt", 1000, 100*time.Hour)
+			if tt.opts.ArchiveDir != "" {
+				tt.opts.ArchiveDir = filepath.Join(dir, tt.opts.ArchiveDir)
+			}
+			tt.opts.Pattern = testPattern
+
+			s, err := NewSweeper(dir, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			active := make(map[string]bool)
+			for _, name := range tt.active {
+				active[name] = true
+			}
+			result, err := s.Sweep(time.Now(), active)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.result {
+				t.Errorf("result = %+v, want %+v", result, tt.result)
+			}
+			if got := listDir(t, dir); strings.Join(got, ",") != strings.Join(tt.remain, ",") {
+				t.Errorf("share holds %v, want %v", got, tt.remain)
+			}
+			if tt.opts.ArchiveDir != "" {
+				if got := listDir(t, tt.opts.ArchiveDir); strings.Join(got, ",") != strings.Join(tt.archive, ",") {
+					t.Errorf("archive holds %v, want %v", got, tt.archive)
+				}
+			}
+		})
+	}
+}
+
+func TestSweepRemovesStaleTemporaryExports(t *testing.T) {
+	dir := t.TempDir()
+	createFile(t, dir, ".export-1.csv.tmp", 10, 2*time.Hour) // Left by a crash
+	createFile(t, dir, ".export-2.csv.tmp", 10, time.Minute) // Being written
+	createFile(t, dir, ".settings.tmp", 10, 2*time.Hour)     // Hidden file of someone else
+	createFile(t, dir, ".export-3.csv", 10, 100*time.Hour)   // Hidden, not a temporary file
+	if err := os.Mkdir(filepath.Join(dir, "queue"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSweeper(dir, Options{Pattern: testPattern, MaxAge: time.Hour, MaxBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sweep(time.Now(), nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".export-2.csv.tmp", ".export-3.csv", ".settings.tmp"}
+	if got := listDir(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("share holds %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "queue")); err != nil {
+		t.Errorf("directory was touched: %v", err)
+	}
+}
+
+func TestNewSweeperNeedsPattern(t *testing.T) {
+	if _, err := NewSweeper(t.TempDir(), Options{MaxAge: time.Hour}); err == nil {
+		t.Error("sweeper without a pattern was created")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "export-1.csv")
+	err := WriteFile(path, func(w io.Writer) error {
+		// Nothing is visible under the final name while writing
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("export visible before it is complete: %v", err)
+		}
+		_, err := io.WriteString(w, "a;b\n")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "a;b\n" {
+		t.Errorf("export = %q %v", data, err)
+	}
+
+	failed := filepath.Join(dir, "export-2.csv")
+	if err := WriteFile(failed, func(w io.Writer) error { return io.ErrUnexpectedEOF }); err != io.ErrUnexpectedEOF {
+		t.Errorf("WriteFile = %v, want the write error", err)
+	}
+	if got := listDir(t, dir); strings.Join(got, ",") != "export-1.csv" {
+		t.Errorf("failed write left %v", got)
+	}
+}
@@ -0,0 +1,268 @@
+package dedup
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// State of a deduplication key
+type State string
+
+const (
+	StatePending State = "pending" // a job holding the key is queued or printing
+	StatePrinted State = "printed" // the job holding the key finished printing
+)
+
+const (
+	logFileName = "dedup.log"
+
+	// Rewrite the log once it holds this many superseded records
+	compactThreshold = 5000
+)
+
+// Entry is the owner of a key
+type Entry struct {
+	JobID     string    `json:"j"`
+	State     State     `json:"s"`
+	UpdatedAt time.Time `json:"t"`
+}
+
+// record is one line of the append-only log, an empty state deletes the key
+type record struct {
+	Key string `json:"k"`
+	Entry
+}
+
+// Store remembers which message and RFID keys were already printed or are being
+// printed, for a retention window, persisted in an append-only log.
+type Store struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	retention time.Duration
+	entries   map[string]Entry
+	garbage   int
+}
+
+// Open loads the store kept in dir, keys older than the retention window are forgotten
+func Open(dir string, retention time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "create deduplication directory %s", dir)
+	}
+
+	s := &Store{
+		path:      filepath.Join(dir, logFileName),
+		retention: retention,
+		entries:   make(map[string]Entry),
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// replay rebuilds the keys from the log
+func (s *Store) replay() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "open deduplication log %s", s.path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// Torn record from a crash
+			continue
+		}
+		s.apply(r)
+	}
+	return scanner.Err()
+}
+
+// Reserve claims the keys for a job. Keys held by another job within the retention
+// window are returned as conflicts and nothing is reserved in that case.
+func (s *Store) Reserve(jobID string, keys []string) (map[string]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	conflicts := make(map[string]Entry)
+	for _, key := range keys {
+		if e, ok := s.lookup(key, now); ok && e.JobID != jobID {
+			conflicts[key] = e
+		}
+	}
+	if len(conflicts) > 0 {
+		return conflicts, nil
+	}
+
+	return nil, s.write(keys, Entry{JobID: jobID, State: StatePending, UpdatedAt: now})
+}
+
+// MarkPrinted flags the keys of a job as printed, the retention window starts now
+func (s *Store) MarkPrinted(jobID string, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(s.owned(jobID, keys), Entry{JobID: jobID, State: StatePrinted, UpdatedAt: time.Now()})
+}
+
+// Release forgets the keys of a job that did not print, so a re-send is printed again
+func (s *Store) Release(jobID string, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(s.owned(jobID, keys), Entry{})
+}
+
+// Close closes the log
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// lookup returns the entry of a key unless it expired
+func (s *Store) lookup(key string, now time.Time) (Entry, bool) {
+	e, ok := s.entries[key]
+	if !ok {
+		return Entry{}, false
+	}
+	if s.retention > 0 && now.Sub(e.UpdatedAt) > s.retention {
+		return Entry{}, false
+	}
+	return e, true
+}
+
+// owned filters the keys held by the job
+func (s *Store) owned(jobID string, keys []string) []string {
+	var result []string
+	for _, key := range keys {
+		if e, ok := s.entries[key]; ok && e.JobID == jobID {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// write appends one record per key and syncs the log
+func (s *Store) write(keys []string, e Entry) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if s.file == nil {
+		return errors.New("deduplication store closed")
+	}
+
+	w := bufio.NewWriter(s.file)
+	for _, key := range keys {
+		r := record{Key: key, Entry: e}
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return errors.Wrap(err, "write deduplication log")
+		}
+		s.apply(r)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "write deduplication log")
+	}
+	if err := s.file.Sync(); err != nil {
+		return errors.Wrap(err, "sync deduplication log")
+	}
+
+	if s.garbage >= compactThreshold && s.garbage > len(s.entries) {
+		return s.compact()
+	}
+	return nil
+}
+
+// apply updates the in-memory state for a record
+func (s *Store) apply(r record) {
+	if _, exists := s.entries[r.Key]; exists {
+		s.garbage++
+	}
+	if r.State == "" {
+		delete(s.entries, r.Key)
+		s.garbage++
+		return
+	}
+	s.entries[r.Key] = r.Entry
+}
+
+// compact rewrites the log with the keys still inside the retention window
+func (s *Store) compact() error {
+	now := time.Now()
+	for key := range s.entries {
+		if _, ok := s.lookup(key, now); !ok {
+			delete(s.entries, key)
+		}
+	}
+
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "create compacted deduplication log")
+	}
+
+	w := bufio.NewWriter(tmp)
+	var writeErr error
+	for key, e := range s.entries {
+		line, err := json.Marshal(record{Key: key, Entry: e})
+		if err != nil {
+			writeErr = err
+			break
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			writeErr = err
+			break
+		}
+	}
+	if writeErr == nil {
+		writeErr = w.Flush()
+	}
+	if writeErr == nil {
+		writeErr = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(writeErr, "write compacted deduplication log")
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return errors.Wrap(err, "replace deduplication log")
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open deduplication log")
+	}
+	s.file = f
+	s.garbage = 0
+	return nil
+}
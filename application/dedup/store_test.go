@@ -0,0 +1,109 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T, dir string, retention time.Duration) *Store {
+	t.Helper()
+	s, err := Open(dir, retention)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreReserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     func(s *Store) // What job-1 did with its keys
+		conflicts int            // Conflicts of job-2 reserving the same keys
+	}{
+		{name: "pending keys conflict", first: func(s *Store) {}, conflicts: 2},
+		{name: "printed keys conflict", first: func(s *Store) { s.MarkPrinted("job-1", []string{"msg:1", "rfid:A"}) }, conflicts: 2},
+		{name: "released keys are free", first: func(s *Store) { s.Release("job-1", []string{"msg:1", "rfid:A"}) }, conflicts: 0},
+		{name: "partly released keys", first: func(s *Store) { s.Release("job-1", []string{"rfid:A"}) }, conflicts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openStore(t, t.TempDir(), time.Hour)
+			if conflicts, err := s.Reserve("job-1", []string{"msg:1", "rfid:A"}); err != nil || len(conflicts) != 0 {
+				t.Fatalf("first reserve: %v %v", conflicts, err)
+			}
+			tt.first(s)
+
+			conflicts, err := s.Reserve("job-2", []string{"msg:1", "rfid:A"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(conflicts) != tt.conflicts {
+				t.Errorf("got %d conflicts %v, want %d", len(conflicts), conflicts, tt.conflicts)
+			}
+			for key, e := range conflicts {
+				if e.JobID != "job-1" {
+					t.Errorf("key %s held by %s, want job-1", key, e.JobID)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreReserveAgainBySameJob(t *testing.T) {
+	s := openStore(t, t.TempDir(), time.Hour)
+	s.Reserve("job-1", []string{"msg:1"})
+	if conflicts, err := s.Reserve("job-1", []string{"msg:1", "rfid:A"}); err != nil || len(conflicts) != 0 {
+		t.Errorf("reserve by the owner: %v %v", conflicts, err)
+	}
+}
+
+func TestStoreKeepsPrintedKeysAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Reserve("job-1", []string{"msg:1", "rfid:A"})
+	s.MarkPrinted("job-1", []string{"msg:1", "rfid:A"})
+	s.Reserve("job-2", []string{"msg:2"})
+	s.Release("job-2", []string{"msg:2"})
+	s.Close()
+
+	s = openStore(t, dir, time.Hour)
+	conflicts, err := s.Reserve("job-3", []string{"msg:1", "msg:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := conflicts["msg:1"]; !ok || e.State != StatePrinted {
+		t.Errorf("printed key after restart = %+v, want printed by job-1", e)
+	}
+	if _, ok := conflicts["msg:2"]; ok {
+		t.Error("released key is held after restart")
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Reserve("job-1", []string{"rfid:A"})
+	s.MarkPrinted("job-1", []string{"rfid:A"})
+	if conflicts, _ := s.Reserve("job-2", []string{"rfid:A"}); len(conflicts) != 1 {
+		t.Fatalf("key inside the retention window is free")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if conflicts, err := s.Reserve("job-2", []string{"rfid:A"}); err != nil || len(conflicts) != 0 {
+		t.Fatalf("key past the retention window: %v %v", conflicts, err)
+	}
+	s.Close()
+
+	// The compaction on open drops the expired printed key, job-2 holds it now
+	s = openStore(t, dir, 50*time.Millisecond)
+	if e := s.entries["rfid:A"]; e.JobID != "job-2" || e.State != StatePending {
+		t.Errorf("entry after restart = %+v, want pending for job-2", e)
+	}
+}
@@ -0,0 +1,191 @@
+package delimited
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Quoting decides which values are wrapped in quotes
+type Quoting string
+
+const (
+	QuoteMinimal Quoting = "minimal" // values holding the delimiter, a quote or a line break
+	QuoteAll     Quoting = "all"     // every value
+	QuoteNever   Quoting = "never"   // no quotes, delimiters and line breaks in values are replaced by a space
+)
+
+// Encoding of the written text
+type Encoding string
+
+const (
+	EncodingUTF8    Encoding = "utf8"
+	EncodingUTF8BOM Encoding = "utf8_bom"
+	EncodingUTF16LE Encoding = "utf16le" // with byte order mark, the Unicode text Bartender reads on Windows
+	EncodingUTF16BE Encoding = "utf16be" // with byte order mark
+)
+
+// LineEnding terminates every record
+type LineEnding string
+
+const (
+	LineEndingLF   LineEnding = "lf"
+	LineEndingCRLF LineEnding = "crlf"
+)
+
+// Options describe the format of the delimited text
+type Options struct {
+	Delimiter  rune // Default ;
+	Quote      rune // Default "
+	Quoting    Quoting
+	Encoding   Encoding
+	LineEnding LineEnding
+}
+
+// Writer writes records of delimited text, values are quoted or cleaned so a delimiter or a line
+// break in a value never shifts the columns
+type Writer struct {
+	w       *bufio.Writer
+	opts    Options
+	eol     string
+	started bool
+}
+
+// NewWriter returns a writer to w, the options are checked here
+func NewWriter(w io.Writer, opts Options) (*Writer, error) {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ';'
+	}
+	if opts.Quote == 0 {
+		opts.Quote = '"'
+	}
+	if opts.Quoting == "" {
+		opts.Quoting = QuoteMinimal
+	}
+	if opts.Encoding == "" {
+		opts.Encoding = EncodingUTF8
+	}
+	if opts.LineEnding == "" {
+		opts.LineEnding = LineEndingLF
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	eol := "\n"
+	if opts.LineEnding == LineEndingCRLF {
+		eol = "\r\n"
+	}
+	return &Writer{w: bufio.NewWriter(w), opts: opts, eol: eol}, nil
+}
+
+// Validate reports an invalid option, empty options take their default
+func (o Options) Validate() error {
+	quote := o.Quote
+	if quote == 0 {
+		quote = '"'
+	}
+	if o.Delimiter != 0 && (o.Delimiter == quote || o.Delimiter == '\r' || o.Delimiter == '\n' || o.Delimiter == utf8.RuneError) {
+		return errors.Errorf("invalid delimiter %q", o.Delimiter)
+	}
+	switch o.Quoting {
+	case "", QuoteMinimal, QuoteAll, QuoteNever:
+	default:
+		return errors.Errorf("unknown quoting %q, expected minimal, all or never", o.Quoting)
+	}
+	switch o.Encoding {
+	case "", EncodingUTF8, EncodingUTF8BOM, EncodingUTF16LE, EncodingUTF16BE:
+	default:
+		return errors.Errorf("unknown encoding %q, expected utf8, utf8_bom, utf16le or utf16be", o.Encoding)
+	}
+	switch o.LineEnding {
+	case "", LineEndingLF, LineEndingCRLF:
+	default:
+		return errors.Errorf("unknown line ending %q, expected lf or crlf", o.LineEnding)
+	}
+	return nil
+}
+
+// Write writes one record
+func (w *Writer) Write(record []string) error {
+	if !w.started {
+		w.started = true
+		if err := w.writeBOM(); err != nil {
+			return err
+		}
+	}
+
+	var line strings.Builder
+	for i, value := range record {
+		if i > 0 {
+			line.WriteRune(w.opts.Delimiter)
+		}
+		line.WriteString(w.field(value))
+	}
+	line.WriteString(w.eol)
+	return w.writeText(line.String())
+}
+
+// Flush writes the buffered records
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// field returns the value quoted or cleaned according to the quoting
+func (w *Writer) field(value string) string {
+	quote := string(w.opts.Quote)
+	switch w.opts.Quoting {
+	case QuoteNever:
+		return strings.Map(func(r rune) rune {
+			if r == w.opts.Delimiter || r == '\r' || r == '\n' {
+				return ' '
+			}
+			return r
+		}, value)
+	case QuoteAll:
+	default:
+		if !strings.ContainsRune(value, w.opts.Delimiter) && !strings.ContainsAny(value, quote+"\r\n") &&
+			strings.TrimSpace(value) == value {
+			return value
+		}
+	}
+	return quote + strings.ReplaceAll(value, quote, quote+quote) + quote
+}
+
+func (w *Writer) writeBOM() error {
+	var bom []byte
+	switch w.opts.Encoding {
+	case EncodingUTF8BOM:
+		bom = []byte{0xEF, 0xBB, 0xBF}
+	case EncodingUTF16LE:
+		bom = []byte{0xFF, 0xFE}
+	case EncodingUTF16BE:
+		bom = []byte{0xFE, 0xFF}
+	}
+	_, err := w.w.Write(bom)
+	return err
+}
+
+func (w *Writer) writeText(text string) error {
+	switch w.opts.Encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		units := utf16.Encode([]rune(text))
+		buf := make([]byte, 2*len(units))
+		for i, u := range units {
+			if w.opts.Encoding == EncodingUTF16LE {
+				buf[2*i], buf[2*i+1] = byte(u), byte(u>>8)
+			} else {
+				buf[2*i], buf[2*i+1] = byte(u>>8), byte(u)
+			}
+		}
+		_, err := w.w.Write(buf)
+		return err
+	default:
+		_, err := w.w.WriteString(text)
+		return err
+	}
+}
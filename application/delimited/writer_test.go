@@ -0,0 +1,97 @@
+package delimited
+
+import (
+	"bytes"
+	"testing"
+)
+
+func write(t *testing.T, opts Options, records ...[]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, opts)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriterQuoting(t *testing.T) {
+	record := []string{"plain", "a;b", `say "hi"`, "two\nlines", " padded", ""}
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{name: "defaults", want: "plain;\"a;b\";\"say \"\"hi\"\"\";\"two\nlines\";\" padded\";\n"},
+		{name: "quote all", opts: Options{Quoting: QuoteAll}, want: "\"plain\";\"a;b\";\"say \"\"hi\"\"\";\"two\nlines\";\" padded\";\"\"\n"},
+		{name: "quote never", opts: Options{Quoting: QuoteNever}, want: "plain;a b;say \"hi\";two lines; padded;\n"},
+		{name: "tab delimiter", opts: Options{Delimiter: '\t'}, want: "plain\ta;b\t\"say \"\"hi\"\"\"\t\"two\nlines\"\t\" padded\"\t\n"},
+		{name: "single quote", opts: Options{Quote: '\''}, want: "plain;'a;b';say \"hi\";'two\nlines';' padded';\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(write(t, tt.opts, record)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriterEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want []byte
+	}{
+		{name: "utf8", want: []byte("é;1\né;2\n")},
+		{name: "utf8 bom", opts: Options{Encoding: EncodingUTF8BOM}, want: append([]byte{0xEF, 0xBB, 0xBF}, "é;1\né;2\n"...)},
+		{name: "crlf", opts: Options{LineEnding: LineEndingCRLF}, want: []byte("é;1\r\né;2\r\n")},
+		{name: "utf16le", opts: Options{Encoding: EncodingUTF16LE},
+			want: []byte{0xFF, 0xFE, 0xE9, 0, ';', 0, '1', 0, '\n', 0, 0xE9, 0, ';', 0, '2', 0, '\n', 0}},
+		{name: "utf16be", opts: Options{Encoding: EncodingUTF16BE},
+			want: []byte{0xFE, 0xFF, 0, 0xE9, 0, ';', 0, '1', 0, '\n', 0, 0xE9, 0, ';', 0, '2', 0, '\n'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The byte order mark is written once, before the first record
+			if got := write(t, tt.opts, []string{"é", "1"}, []string{"é", "2"}); !bytes.Equal(got, tt.want) {
+				t.Errorf("got % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		valid bool
+	}{
+		{name: "defaults", valid: true},
+		{name: "all set", opts: Options{Delimiter: ',', Quote: '\'', Quoting: QuoteAll, Encoding: EncodingUTF16LE, LineEnding: LineEndingCRLF}, valid: true},
+		{name: "delimiter is the quote", opts: Options{Delimiter: '"'}},
+		{name: "delimiter is a line break", opts: Options{Delimiter: '\n'}},
+		{name: "unknown quoting", opts: Options{Quoting: "some"}},
+		{name: "unknown encoding", opts: Options{Encoding: "latin1"}},
+		{name: "unknown line ending", opts: Options{LineEnding: "cr"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate = %v, want valid %v", err, tt.valid)
+			}
+			if _, err := NewWriter(&bytes.Buffer{}, tt.opts); (err == nil) != tt.valid {
+				t.Errorf("NewWriter = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
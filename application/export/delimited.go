@@ -0,0 +1,34 @@
+package export
+
+import (
+	"io"
+
+	"kafka-consumer/application/delimited"
+)
+
+// delimitedExporter writes a header row with the column names and a row per product
+type delimitedExporter struct{}
+
+func (delimitedExporter) Write(w io.Writer, set *RecordSet) error {
+	writer, err := delimited.NewWriter(w, set.Options)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(set.Columns); err != nil {
+		return err
+	}
+	for _, row := range set.Rows {
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func (delimitedExporter) CheckColumns(columns []string) error {
+	return nil
+}
+
+func (delimitedExporter) TextFormat() string {
+	return ""
+}
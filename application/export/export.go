@@ -0,0 +1,68 @@
+package export
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"kafka-consumer/application/delimited"
+)
+
+// RecordSet is the data of a label batch, one row per product in column order
+type RecordSet struct {
+	Columns []string
+	Rows    [][]string
+	Options delimited.Options // Format of the delimited exports, ignored by the others
+}
+
+// Exporter writes a record set in a format a Bartender database connection can read
+type Exporter interface {
+	// Write writes the record set
+	Write(w io.Writer, set *RecordSet) error
+	// CheckColumns reports column names the format cannot hold
+	CheckColumns(columns []string) error
+	// TextFormat is the format reported to the TransformTextToRecordSetAction, empty for
+	// delimited text, the format of a text database connection
+	TextFormat() string
+}
+
+var (
+	mu        sync.RWMutex
+	exporters = make(map[string]Exporter)
+)
+
+// Register makes an exporter available under the export_format name
+func Register(format string, e Exporter) {
+	mu.Lock()
+	defer mu.Unlock()
+	exporters[strings.ToLower(format)] = e
+}
+
+// Get returns the exporter of an export_format
+func Get(format string) (Exporter, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := exporters[strings.ToLower(format)]
+	return e, ok
+}
+
+// Formats returns the registered export_format names, sorted
+func Formats() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	formats := make([]string, 0, len(exporters))
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func init() {
+	Register("txt", delimitedExporter{})
+	Register("csv", delimitedExporter{})
+	Register("json", jsonExporter{})
+	Register("xml", xmlExporter{})
+	Register("xlsx", xlsxExporter{})
+}
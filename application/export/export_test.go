@@ -0,0 +1,168 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+var testSet = &RecordSet{
+	Columns: []string{"sku", "rfid", "name"},
+	Rows: [][]string{
+		{"001234", "E280116060000209", "Áo thun <trẻ em> & mũ"},
+		{"000042", "E280116060000210", ""},
+	},
+}
+
+func write(t *testing.T, format string, set *RecordSet) []byte {
+	t.Helper()
+	e, ok := Get(format)
+	if !ok {
+		t.Fatalf("format %s is not registered", format)
+	}
+	var buf bytes.Buffer
+	if err := e.Write(&buf, set); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// The workbook must open as a zip archive with the parts Excel and Bartender look for, and
+// hold every value as text
+func TestXLSXIsValidWorkbook(t *testing.T) {
+	data := write(t, "xlsx", testSet)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	parts := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		parts[f.Name] = f
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		f, ok := parts[name]
+		if !ok {
+			t.Errorf("part %s is missing", name)
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Every part is well-formed XML
+		d := xml.NewDecoder(r)
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("part %s: %v", name, err)
+				break
+			}
+		}
+		r.Close()
+	}
+
+	r, err := parts["xl/worksheets/sheet1.xml"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref  string `xml:"r,attr"`
+				Type string `xml:"t,attr"`
+				Text string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.NewDecoder(r).Decode(&sheet); err != nil {
+		t.Fatal(err)
+	}
+	want := append([][]string{testSet.Columns}, testSet.Rows...)
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("sheet has %d rows, want %d", len(sheet.Rows), len(want))
+	}
+	for i, row := range sheet.Rows {
+		for j, cell := range row.Cells {
+			if cell.Text != want[i][j] || cell.Type != "inlineStr" {
+				t.Errorf("cell %s = %q (%s), want text %q", cell.Ref, cell.Text, cell.Type, want[i][j])
+			}
+		}
+	}
+	if ref := sheet.Rows[2].Cells[2].Ref; ref != "C3" {
+		t.Errorf("last cell is %s, want C3", ref)
+	}
+}
+
+func TestXLSXRejectsOversizedCell(t *testing.T) {
+	set := &RecordSet{Columns: []string{"name"}, Rows: [][]string{{strings.Repeat("a", maxCellLength+1)}}}
+	e, _ := Get("xlsx")
+	if err := e.Write(io.Discard, set); err == nil {
+		t.Error("cell longer than Excel allows was written")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"}, {25, "Z"}, {26, "AA"}, {51, "AZ"}, {52, "BA"}, {701, "ZZ"}, {702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := columnName(tt.index); got != tt.want {
+			t.Errorf("columnName(%d) = %s, want %s", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestJSONExport(t *testing.T) {
+	var records []map[string]string
+	if err := json.Unmarshal(write(t, "json", testSet), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0]["sku"] != "001234" || records[0]["name"] != testSet.Rows[0][2] {
+		t.Errorf("records = %v", records)
+	}
+}
+
+func TestXMLExport(t *testing.T) {
+	var set struct {
+		Records []struct {
+			Sku  string `xml:"sku"`
+			Name string `xml:"name"`
+		} `xml:"Record"`
+	}
+	if err := xml.Unmarshal(write(t, "XML", testSet), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Records) != 2 || set.Records[1].Sku != "000042" || set.Records[0].Name != testSet.Rows[0][2] {
+		t.Errorf("records = %+v", set.Records)
+	}
+}
+
+func TestXMLCheckColumns(t *testing.T) {
+	tests := []struct {
+		column string
+		valid  bool
+	}{
+		{column: "sku", valid: true},
+		{column: "size_us", valid: true},
+		{column: "_id.v-2", valid: true},
+		{column: "2nd", valid: false},
+		{column: "size us", valid: false},
+		{column: "XmlName", valid: false},
+		{column: "", valid: false},
+	}
+	e, _ := Get("xml")
+	for _, tt := range tests {
+		if err := e.CheckColumns([]string{tt.column}); (err == nil) != tt.valid {
+			t.Errorf("CheckColumns(%q) = %v, want valid %v", tt.column, err, tt.valid)
+		}
+	}
+}
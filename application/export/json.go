@@ -0,0 +1,53 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// jsonExporter writes an array with an object per product, keyed by column name in column order
+type jsonExporter struct{}
+
+func (jsonExporter) Write(w io.Writer, set *RecordSet) error {
+	keys := make([][]byte, len(set.Columns))
+	for i, column := range set.Columns {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	buf := bufio.NewWriter(w)
+	buf.WriteString("[")
+	for i, row := range set.Rows {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  {")
+		for j, key := range keys {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			value, err := json.Marshal(row[j])
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteString(": ")
+			buf.Write(value)
+		}
+		buf.WriteString("}")
+	}
+	buf.WriteString("\n]\n")
+	return buf.Flush()
+}
+
+func (jsonExporter) CheckColumns(columns []string) error {
+	return nil
+}
+
+func (jsonExporter) TextFormat() string {
+	return "JSON"
+}
@@ -0,0 +1,107 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// maxCellLength is the longest text an Excel cell holds
+const maxCellLength = 32767
+
+// xlsxParts are the fixed parts of a workbook with a single sheet
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="RecordSet" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// xlsxExporter writes a workbook whose first row holds the column names, every cell is
+// text so RFID barcodes and sizes keep their leading zeros
+type xlsxExporter struct{}
+
+func (xlsxExporter) Write(w io.Writer, set *RecordSet) error {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		pw, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(pw, part.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	rows := append([][]string{set.Columns}, set.Rows...)
+	for i, row := range rows {
+		ref := strconv.Itoa(i + 1)
+		buf.WriteString(`<row r="` + ref + `">`)
+		for j, value := range row {
+			if utf8.RuneCountInString(value) > maxCellLength {
+				return errors.Errorf("row %d column %q exceeds the %d characters of an Excel cell", i, set.Columns[j], maxCellLength)
+			}
+			buf.WriteString(`<c r="` + columnName(j) + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(&buf, []byte(value)); err != nil {
+				return err
+			}
+			buf.WriteString(`</t></is></c>`)
+		}
+		buf.WriteString(`</row>`)
+		// Keep the memory of large batches bounded
+		if buf.Len() > 1<<16 {
+			if _, err := sheet.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+	}
+	buf.WriteString(`</sheetData></worksheet>`)
+	if _, err := sheet.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func (xlsxExporter) CheckColumns(columns []string) error {
+	return nil
+}
+
+func (xlsxExporter) TextFormat() string {
+	return "Excel"
+}
+
+// columnName returns the letters of a zero-based column index, A to Z then AA
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
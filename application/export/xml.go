@@ -0,0 +1,50 @@
+package export
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// xmlElementName matches the column names usable as element names
+var xmlElementName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// xmlExporter writes a RecordSet element holding a Record element per product, with an
+// element per column
+type xmlExporter struct{}
+
+func (xmlExporter) Write(w io.Writer, set *RecordSet) error {
+	buf := bufio.NewWriter(w)
+	buf.WriteString(xml.Header)
+	buf.WriteString("<RecordSet>\n")
+	for _, row := range set.Rows {
+		buf.WriteString("  <Record>\n")
+		for i, column := range set.Columns {
+			buf.WriteString("    <" + column + ">")
+			if err := xml.EscapeText(buf, []byte(row[i])); err != nil {
+				return err
+			}
+			buf.WriteString("</" + column + ">\n")
+		}
+		buf.WriteString("  </Record>\n")
+	}
+	buf.WriteString("</RecordSet>\n")
+	return buf.Flush()
+}
+
+func (xmlExporter) CheckColumns(columns []string) error {
+	for _, column := range columns {
+		if !xmlElementName.MatchString(column) || strings.HasPrefix(strings.ToLower(column), "xml") {
+			return errors.Errorf("column %q is not a valid XML element name", column)
+		}
+	}
+	return nil
+}
+
+func (xmlExporter) TextFormat() string {
+	return "XML"
+}
@@ -0,0 +1,408 @@
+package imagecache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dataExt = ".bin"
+	metaExt = ".json"
+)
+
+// Options bound the cache
+type Options struct {
+	MaxDiskBytes   int64         // Images kept on disk, least recently used are evicted first
+	MaxMemoryBytes int64         // Images kept in memory
+	MaxImageBytes  int64         // Larger images are refused
+	Revalidate     time.Duration // Cached images are served without asking the server for this long
+	Client         *http.Client
+}
+
+// meta describes a cached image, stored next to its content
+type meta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Size         int64     `json:"size"`
+	CheckedAt    time.Time `json:"checked_at"` // Last download or successful revalidation
+	UsedAt       time.Time `json:"used_at"`
+}
+
+// memoryEntry is an image held in memory
+type memoryEntry struct {
+	key  string
+	data []byte
+}
+
+// Cache keeps downloaded images on disk and the most used ones in memory, keyed by URL.
+// Images older than the revalidation window are checked with their ETag or Last-Modified
+// and served from the cache when the server answers 304 or cannot be reached.
+type Cache struct {
+	mu   sync.Mutex
+	dir  string
+	opts Options
+
+	index     map[string]*meta // Disk entries by key
+	diskBytes int64
+
+	lru         *list.List // Front is the most recently used memory entry
+	memory      map[string]*list.Element
+	memoryBytes int64
+
+	// One download per URL at a time
+	fetching map[string]*sync.Mutex
+}
+
+// Open loads the cache kept in dir
+func Open(dir string, opts Options) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "create image cache directory %s", dir)
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	c := &Cache{
+		dir:      dir,
+		opts:     opts,
+		index:    make(map[string]*meta),
+		lru:      list.New(),
+		memory:   make(map[string]*list.Element),
+		fetching: make(map[string]*sync.Mutex),
+	}
+
+	metas, err := filepath.Glob(filepath.Join(dir, "*"+metaExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range metas {
+		key := strings.TrimSuffix(filepath.Base(path), metaExt)
+		m, err := readMeta(path)
+		if err != nil {
+			// Half written entry, download it again
+			c.removeFiles(key)
+			continue
+		}
+		if info, err := os.Stat(c.dataPath(key)); err != nil || info.Size() != m.Size {
+			c.removeFiles(key)
+			continue
+		}
+		c.index[key] = m
+		c.diskBytes += m.Size
+	}
+	c.mu.Lock()
+	c.evictDisk()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Get returns the content of the image at url
+func (c *Cache) Get(ctx context.Context, url string) ([]byte, error) {
+	if url == "" {
+		return nil, errors.New("image url is empty")
+	}
+	key := cacheKey(url)
+
+	// Serialize the downloads of a URL so a batch fetches each image once
+	c.mu.Lock()
+	lock, ok := c.fetching[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.fetching[key] = lock
+	}
+	c.mu.Unlock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	c.mu.Lock()
+	m, cached := c.index[key]
+	var current meta
+	if cached {
+		current = *m
+	}
+	c.mu.Unlock()
+
+	if cached && time.Since(current.CheckedAt) < c.opts.Revalidate {
+		if data, err := c.read(key); err == nil {
+			return data, nil
+		}
+		cached = false
+	}
+
+	data, fresh, err := c.fetch(ctx, url, current, cached)
+	if err != nil {
+		if cached {
+			// Serve the stale copy while the server is unreachable
+			if data, readErr := c.read(key); readErr == nil {
+				return data, nil
+			}
+		}
+		return nil, err
+	}
+	if !fresh {
+		// 304, the cached copy is still current
+		c.touchChecked(key)
+		if data, err := c.read(key); err == nil {
+			return data, nil
+		}
+		// The copy vanished meanwhile, download it unconditionally
+		data, _, err = c.fetch(ctx, url, meta{}, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// fetch downloads url, conditionally when a cached copy exists. fresh is false on 304.
+func (c *Cache) fetch(ctx context.Context, url string, current meta, conditional bool) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if conditional {
+		if current.ETag != "" {
+			req.Header.Set("If-None-Match", current.ETag)
+		}
+		if current.LastModified != "" {
+			req.Header.Set("If-Modified-Since", current.LastModified)
+		}
+	}
+
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, errors.Errorf("download %s: status %d", url, resp.StatusCode)
+	}
+
+	reader := io.Reader(resp.Body)
+	if c.opts.MaxImageBytes > 0 {
+		if resp.ContentLength > c.opts.MaxImageBytes {
+			return nil, false, errors.Errorf("image %s is %d bytes, the limit is %d", url, resp.ContentLength, c.opts.MaxImageBytes)
+		}
+		reader = io.LimitReader(resp.Body, c.opts.MaxImageBytes+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.opts.MaxImageBytes > 0 && int64(len(data)) > c.opts.MaxImageBytes {
+		return nil, false, errors.Errorf("image %s exceeds the limit of %d bytes", url, c.opts.MaxImageBytes)
+	}
+
+	now := time.Now()
+	m := &meta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Size:         int64(len(data)),
+		CheckedAt:    now,
+		UsedAt:       now,
+	}
+	// A failed write keeps the image usable, it is downloaded again next time
+	_ = c.store(cacheKey(url), m, data)
+	return data, true, nil
+}
+
+// store writes the image to disk and memory
+func (c *Cache) store(key string, m *meta, data []byte) error {
+	if err := writeFile(c.dataPath(key), data); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(c.metaPath(key), encoded); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.index[key]; ok {
+		c.diskBytes -= old.Size
+	}
+	c.index[key] = m
+	c.diskBytes += m.Size
+	c.remember(key, data)
+	c.evictDisk()
+	return nil
+}
+
+// read returns the content of a cached image, from memory when possible
+func (c *Cache) read(key string) ([]byte, error) {
+	c.mu.Lock()
+	if el, ok := c.memory[key]; ok {
+		c.lru.MoveToFront(el)
+		if m, ok := c.index[key]; ok {
+			m.UsedAt = time.Now()
+		}
+		data := el.Value.(*memoryEntry).data
+		c.mu.Unlock()
+		return data, nil
+	}
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(c.dataPath(key))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m, ok := c.index[key]; ok {
+		m.UsedAt = time.Now()
+	}
+	c.remember(key, data)
+	return data, nil
+}
+
+// touchChecked records a successful revalidation
+func (c *Cache) touchChecked(key string) {
+	c.mu.Lock()
+	m, ok := c.index[key]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	m.CheckedAt = time.Now()
+	encoded, err := json.Marshal(m)
+	c.mu.Unlock()
+	if err == nil {
+		_ = writeFile(c.metaPath(key), encoded)
+	}
+}
+
+// remember keeps data in memory, evicting the least recently used images. Caller holds mu.
+func (c *Cache) remember(key string, data []byte) {
+	size := int64(len(data))
+	if c.opts.MaxMemoryBytes <= 0 || size > c.opts.MaxMemoryBytes {
+		return
+	}
+	if el, ok := c.memory[key]; ok {
+		c.memoryBytes -= int64(len(el.Value.(*memoryEntry).data))
+		el.Value.(*memoryEntry).data = data
+		c.lru.MoveToFront(el)
+	} else {
+		c.memory[key] = c.lru.PushFront(&memoryEntry{key: key, data: data})
+	}
+	c.memoryBytes += size
+
+	for c.memoryBytes > c.opts.MaxMemoryBytes {
+		el := c.lru.Back()
+		entry := el.Value.(*memoryEntry)
+		c.lru.Remove(el)
+		delete(c.memory, entry.key)
+		c.memoryBytes -= int64(len(entry.data))
+	}
+}
+
+// evictDisk removes the least recently used images until the disk limit holds. Caller holds mu.
+func (c *Cache) evictDisk() {
+	if c.opts.MaxDiskBytes <= 0 || c.diskBytes <= c.opts.MaxDiskBytes {
+		return
+	}
+	keys := make([]string, 0, len(c.index))
+	for key := range c.index {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.index[keys[i]].UsedAt.Before(c.index[keys[j]].UsedAt)
+	})
+	for _, key := range keys {
+		if c.diskBytes <= c.opts.MaxDiskBytes {
+			return
+		}
+		c.diskBytes -= c.index[key].Size
+		delete(c.index, key)
+		c.removeFiles(key)
+	}
+}
+
+// Sync downloads every image to dir under its file name, files already up to date are kept
+func (c *Cache) Sync(ctx context.Context, dir string, files map[string]string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "create image directory %s", dir)
+	}
+	var failed []string
+	for name, url := range files {
+		data, err := c.Get(ctx, url)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if current, err := os.ReadFile(path); err == nil && string(current) == string(data) {
+			continue
+		}
+		if err := writeFile(path, data); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return errors.Errorf("failed to sync %d images: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (c *Cache) dataPath(key string) string {
+	return filepath.Join(c.dir, key+dataExt)
+}
+
+func (c *Cache) metaPath(key string) string {
+	return filepath.Join(c.dir, key+metaExt)
+}
+
+func (c *Cache) removeFiles(key string) {
+	_ = os.Remove(c.dataPath(key))
+	_ = os.Remove(c.metaPath(key))
+}
+
+func cacheKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+func readMeta(path string) (*meta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &meta{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// writeFile replaces path through a temporary file so readers never see a partial image
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,176 @@
+package imagecache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// imageServer serves 100 byte images at any path with an ETag, counting the full downloads
+type imageServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	downloads map[string]int
+	down      bool
+}
+
+func newImageServer(t *testing.T) *imageServer {
+	s := &imageServer{downloads: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.down {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		etag := `"` + r.URL.Path + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		s.downloads[r.URL.Path]++
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(strings.Repeat(r.URL.Path[1:2], 100)))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *imageServer) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func TestCacheEviction(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		gets      []string       // Paths read in order
+		downloads map[string]int // Full downloads per path
+		onDisk    []string       // Paths left on disk
+	}{
+		{
+			name:      "no limit",
+			gets:      []string{"/a", "/b", "/c", "/a", "/b", "/c"},
+			downloads: map[string]int{"/a": 1, "/b": 1, "/c": 1},
+			onDisk:    []string{"/a", "/b", "/c"},
+		},
+		{
+			name:      "least recently used leaves the disk first",
+			opts:      Options{MaxDiskBytes: 250},
+			gets:      []string{"/a", "/b", "/a", "/c"},
+			downloads: map[string]int{"/a": 1, "/b": 1, "/c": 1},
+			onDisk:    []string{"/a", "/c"},
+		},
+		{
+			name:      "evicted image is downloaded again",
+			opts:      Options{MaxDiskBytes: 250},
+			gets:      []string{"/a", "/b", "/c", "/a"},
+			downloads: map[string]int{"/a": 2, "/b": 1, "/c": 1},
+			onDisk:    []string{"/a", "/c"},
+		},
+		{
+			name:      "memory limit keeps the disk copies",
+			opts:      Options{MaxMemoryBytes: 150},
+			gets:      []string{"/a", "/b", "/c", "/a"},
+			downloads: map[string]int{"/a": 1, "/b": 1, "/c": 1},
+			onDisk:    []string{"/a", "/b", "/c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newImageServer(t)
+			tt.opts.Revalidate = time.Hour
+			c, err := Open(t.TempDir(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range tt.gets {
+				data, err := c.Get(context.Background(), server.URL+path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != strings.Repeat(path[1:], 100) {
+					t.Fatalf("Get(%s) returned another image", path)
+				}
+				// Distinct use times on coarse clocks
+				time.Sleep(2 * time.Millisecond)
+			}
+
+			for path, want := range tt.downloads {
+				if got := server.downloads[path]; got != want {
+					t.Errorf("%s downloaded %d times, want %d", path, got, want)
+				}
+			}
+			var onDisk []string
+			for _, path := range []string{"/a", "/b", "/c"} {
+				if _, err := os.Stat(c.dataPath(cacheKey(server.URL + path))); err == nil {
+					onDisk = append(onDisk, path)
+				}
+			}
+			if strings.Join(onDisk, ",") != strings.Join(tt.onDisk, ",") {
+				t.Errorf("disk holds %v, want %v", onDisk, tt.onDisk)
+			}
+			if tt.opts.MaxMemoryBytes > 0 && c.memoryBytes > tt.opts.MaxMemoryBytes {
+				t.Errorf("memory holds %d bytes, limit %d", c.memoryBytes, tt.opts.MaxMemoryBytes)
+			}
+		})
+	}
+}
+
+// The disk limit also holds for the images found when the cache is opened again
+func TestOpenEvictsOverLimit(t *testing.T) {
+	server := newImageServer(t)
+	dir := t.TempDir()
+	c, err := Open(dir, Options{Revalidate: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/a", "/b", "/c"} {
+		if _, err := c.Get(context.Background(), server.URL+path); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	c, err = Open(dir, Options{MaxDiskBytes: 150, Revalidate: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.index) != 1 || c.index[cacheKey(server.URL+"/c")] == nil {
+		t.Errorf("reopened cache holds %d images, want only the last used one", len(c.index))
+	}
+}
+
+// Past the revalidation window the server is asked again, a 304 or an unreachable server
+// serves the cached copy
+func TestCacheRevalidation(t *testing.T) {
+	server := newImageServer(t)
+	c, err := Open(t.TempDir(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := server.URL + "/a"
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(context.Background(), url); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if server.downloads["/a"] != 1 {
+		t.Errorf("downloaded %d times, want 1 and a 304", server.downloads["/a"])
+	}
+
+	server.setDown(true)
+	if data, err := c.Get(context.Background(), url); err != nil || len(data) != 100 {
+		t.Errorf("Get while the server is down = %d bytes %v, want the cached copy", len(data), err)
+	}
+	if _, err := c.Get(context.Background(), server.URL+"/b"); err == nil {
+		t.Error("image never cached was served while the server is down")
+	}
+}
@@ -0,0 +1,428 @@
+package jobqueue
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrFull is returned by Put when the queue already holds its capacity of jobs
+var ErrFull = errors.New("job queue full")
+
+// ErrClosed is returned once the queue has been closed
+var ErrClosed = errors.New("job queue closed")
+
+const (
+	logFileName = "queue.log"
+
+	opPut  = "put"
+	opAck  = "ack"  // The job finished, its id is remembered for the retention
+	opDrop = "drop" // The job was given up without finishing, its id is forgotten
+
+	// Rewrite the log once it holds this many records that are no longer needed
+	compactThreshold = 1000
+)
+
+// record is one line of the append-only log
+type record struct {
+	Op   string          `json:"op"`
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data,omitempty"`
+	At   int64           `json:"at,omitempty"` // Unix nanoseconds of an ack
+}
+
+// entry is a pending job, either ready to be handed out or leased by a worker
+type entry struct {
+	id     string
+	data   []byte
+	seq    uint64 // order of the last put, keeps leased jobs ordered across compactions
+	leased bool
+	elem   *list.Element // position in the ready list while not leased
+}
+
+// Queue is a FIFO of jobs persisted in an append-only log so that pending and
+// in-flight jobs survive a restart. A job stays in the log until it is acknowledged,
+// the ids of acknowledged jobs are kept for the retention so that a redelivery of
+// their source can be recognised.
+type Queue struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	capacity  int
+	retention time.Duration
+	entries   map[string]*entry
+	done      map[string]time.Time // acknowledged ids and when
+	ready     *list.List
+	notify    chan struct{}
+	garbage   int // records in the log that are superseded or acknowledged
+	seq       uint64
+	closed    bool
+	logf      func(format string, args ...interface{}) // Errors the queue recovered from
+}
+
+// Open loads the queue stored in dir, recovering every job that was not acknowledged
+// in the order it was last enqueued. capacity <= 0 means unbounded, retention is how
+// long Completed remembers an acknowledged job, <= 0 forgets it at once.
+func Open(dir string, capacity int, retention time.Duration) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "create queue directory %s", dir)
+	}
+
+	q := &Queue{
+		path:      filepath.Join(dir, logFileName),
+		capacity:  capacity,
+		retention: retention,
+		entries:   make(map[string]*entry),
+		done:      make(map[string]time.Time),
+		ready:     list.New(),
+		notify:    make(chan struct{}, 1),
+		logf:      func(string, ...interface{}) {},
+	}
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+	// Start from a compact log, this also drops a torn record left by a crash
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// replay rebuilds the pending jobs from the log
+func (q *Queue) replay() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "open queue log %s", q.path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// Only the last record can be incomplete, it was never acknowledged to the caller
+			continue
+		}
+		switch r.Op {
+		case opPut:
+			q.put(r.ID, r.Data)
+		case opAck:
+			q.remove(r.ID)
+			if r.At != 0 {
+				q.done[r.ID] = time.Unix(0, r.At)
+			}
+		case opDrop:
+			q.remove(r.ID)
+		}
+	}
+	return scanner.Err()
+}
+
+// Put appends a job to the tail of the queue. Putting an id that is already pending
+// replaces its data and moves it to the tail, which is how leased jobs are requeued.
+func (q *Queue) Put(id string, data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if _, exists := q.entries[id]; !exists && q.capacity > 0 && len(q.entries) >= q.capacity {
+		return ErrFull
+	}
+
+	if err := q.append(record{Op: opPut, ID: id, Data: data}); err != nil {
+		return err
+	}
+	q.put(id, data)
+	q.signal()
+	return nil
+}
+
+// Get blocks until a job is ready and leases it to the caller. The job is handed out
+// again after a restart unless it is acknowledged.
+func (q *Queue) Get(ctx context.Context) (string, []byte, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return "", nil, ErrClosed
+		}
+		if front := q.ready.Front(); front != nil {
+			e := q.ready.Remove(front).(*entry)
+			e.elem = nil
+			e.leased = true
+			// Wake up another waiter if there is more work
+			if q.ready.Len() > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return e.id, e.data, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		case <-q.notify:
+		}
+	}
+}
+
+// Ack removes a job for good once it reached a terminal state, Completed reports it
+// for the retention
+func (q *Queue) Ack(id string) error {
+	return q.finish(id, true)
+}
+
+// Drop removes a job without completing it, a redelivery of its source is a new job
+func (q *Queue) Drop(id string) error {
+	return q.finish(id, false)
+}
+
+// finish writes the ack or drop record of a pending job
+func (q *Queue) finish(id string, completed bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if _, exists := q.entries[id]; !exists {
+		return nil
+	}
+	r := record{Op: opDrop, ID: id}
+	now := time.Now()
+	if completed && q.retention > 0 {
+		r = record{Op: opAck, ID: id, At: now.UnixNano()}
+	}
+	if err := q.append(r); err != nil {
+		return err
+	}
+	q.remove(id)
+	if r.Op == opAck {
+		q.done[id] = now
+	}
+
+	if q.garbage >= compactThreshold && q.garbage > 2*(len(q.entries)+len(q.done)) {
+		// The record is already synced, a failed compaction is tried again by the next one
+		if err := q.compact(); err != nil {
+			q.logf("Failed to compact job queue log %s: %v", q.path, err)
+		}
+	}
+	return nil
+}
+
+// SetErrorLog reports the errors the queue recovers from, such as a failed compaction, to
+// logf. They are discarded by default.
+func (q *Queue) SetErrorLog(logf func(format string, args ...interface{})) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.logf = logf
+}
+
+// Contains reports whether the job is still pending
+func (q *Queue) Contains(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, exists := q.entries[id]
+	return exists
+}
+
+// Completed reports whether the job was acknowledged within the retention
+func (q *Queue) Completed(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	at, exists := q.done[id]
+	return exists && time.Since(at) < q.retention
+}
+
+// Full reports whether Put of a new job would fail with ErrFull
+func (q *Queue) Full() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.capacity > 0 && len(q.entries) >= q.capacity
+}
+
+// Len returns the number of pending jobs, leased ones included
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Pending returns the data of every pending job, leased ones included
+func (q *Queue) Pending() [][]byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result := make([][]byte, 0, len(q.entries))
+	for _, e := range q.entries {
+		result = append(result, e.data)
+	}
+	return result
+}
+
+// Close flushes and closes the log, pending jobs are recovered by the next Open
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.notify)
+	if q.file == nil {
+		return nil
+	}
+	return q.file.Close()
+}
+
+// put updates the in-memory state for a put record
+func (q *Queue) put(id string, data []byte) {
+	q.seq++
+	if e, exists := q.entries[id]; exists {
+		q.garbage++
+		if e.elem != nil {
+			q.ready.Remove(e.elem)
+		}
+		e.data = data
+		e.seq = q.seq
+		e.leased = false
+		e.elem = q.ready.PushBack(e)
+		return
+	}
+
+	e := &entry{id: id, data: data, seq: q.seq}
+	e.elem = q.ready.PushBack(e)
+	q.entries[id] = e
+}
+
+// remove updates the in-memory state for an ack record
+func (q *Queue) remove(id string) {
+	e, exists := q.entries[id]
+	if !exists {
+		return
+	}
+	if e.elem != nil {
+		q.ready.Remove(e.elem)
+	}
+	delete(q.entries, id)
+	// The put and the ack record are both garbage now
+	q.garbage += 2
+}
+
+// signal wakes up one waiting Get
+func (q *Queue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// append writes a record to the log and syncs it to disk
+func (q *Queue) append(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if _, err := q.file.Write(line); err != nil {
+		return errors.Wrap(err, "write queue log")
+	}
+	return errors.Wrap(q.file.Sync(), "sync queue log")
+}
+
+// compact rewrites the log with the acknowledged ids still in the retention and the
+// pending jobs, leased ones first so that in-flight jobs are resumed before the jobs
+// that were still waiting
+func (q *Queue) compact() error {
+	tmpPath := q.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "create compacted queue log")
+	}
+
+	w := bufio.NewWriter(tmp)
+	writeRecord := func(r record) error {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(line, '\n'))
+		return err
+	}
+	write := func(e *entry) error {
+		return writeRecord(record{Op: opPut, ID: e.id, Data: e.data})
+	}
+
+	var writeErr error
+	for id, at := range q.done {
+		if time.Since(at) >= q.retention {
+			delete(q.done, id)
+			continue
+		}
+		if writeErr == nil {
+			writeErr = writeRecord(record{Op: opAck, ID: id, At: at.UnixNano()})
+		}
+	}
+
+	var leased []*entry
+	for _, e := range q.entries {
+		if e.leased {
+			leased = append(leased, e)
+		}
+	}
+	sort.Slice(leased, func(i, j int) bool { return leased[i].seq < leased[j].seq })
+
+	for _, e := range leased {
+		if writeErr == nil {
+			writeErr = write(e)
+		}
+	}
+	for el := q.ready.Front(); el != nil && writeErr == nil; el = el.Next() {
+		writeErr = write(el.Value.(*entry))
+	}
+	if writeErr == nil {
+		writeErr = w.Flush()
+	}
+	if writeErr == nil {
+		writeErr = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(writeErr, "write compacted queue log")
+	}
+
+	if q.file != nil {
+		q.file.Close()
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return errors.Wrap(err, "replace queue log")
+	}
+
+	f, err := os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open queue log")
+	}
+	q.file = f
+	q.garbage = 0
+	return nil
+}
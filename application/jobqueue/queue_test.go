@@ -0,0 +1,256 @@
+package jobqueue
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func openQueue(t *testing.T, dir string, capacity int, retention time.Duration) *Queue {
+	t.Helper()
+	q, err := Open(dir, capacity, retention)
+	if err != nil {
+		t.Fatalf("open queue: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func get(t *testing.T, q *Queue) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	id, _, err := q.Get(ctx)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	return id
+}
+
+func logLines(t *testing.T, dir string) int {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestQueueRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		put     []string
+		lease   int      // Jobs taken by Get before the restart
+		ack     []string // Jobs acknowledged before the restart
+		drop    []string // Jobs dropped before the restart
+		pending []string // Order of the jobs handed out after the restart
+	}{
+		{name: "waiting jobs keep their order", put: []string{"a", "b", "c"}, pending: []string{"a", "b", "c"}},
+		{name: "acknowledged jobs are gone", put: []string{"a", "b", "c"}, lease: 2, ack: []string{"a"}, pending: []string{"b", "c"}},
+		{name: "dropped jobs are gone", put: []string{"a", "b"}, drop: []string{"b"}, pending: []string{"a"}},
+		{name: "leased jobs come first", put: []string{"a", "b", "c"}, lease: 3, ack: []string{"b"}, pending: []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q, err := Open(dir, 0, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range tt.put {
+				if err := q.Put(id, []byte(`"`+id+`"`)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < tt.lease; i++ {
+				get(t, q)
+			}
+			for _, id := range tt.ack {
+				if err := q.Ack(id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, id := range tt.drop {
+				if err := q.Drop(id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			q.Close()
+
+			q = openQueue(t, dir, 0, time.Hour)
+			if q.Len() != len(tt.pending) {
+				t.Fatalf("recovered %d jobs, want %d", q.Len(), len(tt.pending))
+			}
+			for _, want := range tt.pending {
+				if id := get(t, q); id != want {
+					t.Errorf("got job %s, want %s", id, want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueRequeueMovesToTail(t *testing.T) {
+	q := openQueue(t, t.TempDir(), 0, 0)
+	q.Put("a", []byte(`1`))
+	q.Put("b", []byte(`1`))
+	get(t, q)
+	if err := q.Put("a", []byte(`2`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if id := get(t, q); id != "b" {
+		t.Fatalf("got job %s, want b", id)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	id, data, err := q.Get(ctx)
+	if err != nil || id != "a" || string(data) != "2" {
+		t.Fatalf("got job %s %s %v, want a with the new data", id, data, err)
+	}
+}
+
+func TestQueueCapacity(t *testing.T) {
+	q := openQueue(t, t.TempDir(), 2, 0)
+	q.Put("a", nil)
+	q.Put("b", nil)
+	if !q.Full() {
+		t.Error("queue at capacity is not full")
+	}
+	if err := q.Put("c", nil); err != ErrFull {
+		t.Errorf("put over capacity = %v, want ErrFull", err)
+	}
+	// Updating a pending job needs no room
+	if err := q.Put("a", []byte(`1`)); err != nil {
+		t.Errorf("requeue at capacity = %v", err)
+	}
+	get(t, q)
+	q.Ack("a")
+	if q.Full() {
+		t.Error("queue is still full after an ack")
+	}
+}
+
+func TestQueueCompletedAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Put("printed", nil)
+	q.Put("parked", nil)
+	q.Put("waiting", nil)
+	q.Ack("printed")
+	q.Drop("parked")
+	q.Close()
+
+	q = openQueue(t, dir, 0, time.Hour)
+	tests := []struct {
+		id        string
+		completed bool
+		pending   bool
+	}{
+		{id: "printed", completed: true},
+		{id: "parked"},
+		{id: "waiting", pending: true},
+		{id: "unknown"},
+	}
+	for _, tt := range tests {
+		if got := q.Completed(tt.id); got != tt.completed {
+			t.Errorf("Completed(%s) = %v, want %v", tt.id, got, tt.completed)
+		}
+		if got := q.Contains(tt.id); got != tt.pending {
+			t.Errorf("Contains(%s) = %v, want %v", tt.id, got, tt.pending)
+		}
+	}
+}
+
+func TestQueueCompletedExpires(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, 0, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Put("a", nil)
+	q.Ack("a")
+	if !q.Completed("a") {
+		t.Fatal("acknowledged job is not completed")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if q.Completed("a") {
+		t.Error("job is still completed after the retention")
+	}
+	q.Close()
+
+	// The compaction of the next open forgets it
+	openQueue(t, dir, 0, 50*time.Millisecond)
+	if n := logLines(t, dir); n != 0 {
+		t.Errorf("compacted log has %d records, want 0", n)
+	}
+}
+
+func TestQueueCompaction(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, 0, 0)
+	for i := 0; i < compactThreshold; i++ {
+		id := "job-" + strconv.Itoa(i)
+		q.Put(id, nil)
+		get(t, q)
+		if err := q.Ack(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Put("kept", []byte(`1`))
+
+	if n := logLines(t, dir); n >= compactThreshold {
+		t.Errorf("log has %d records after %d acks, it was not compacted", n, compactThreshold)
+	}
+	if !q.Contains("kept") || q.Len() != 1 {
+		t.Errorf("compaction lost the pending job, len %d", q.Len())
+	}
+}
+
+// The ack is durable before the compaction, a failed compaction is logged and not returned
+func TestQueueCompactionFailureIsNotReturned(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, 0, 0)
+	var logged int
+	q.SetErrorLog(func(string, ...interface{}) { logged++ })
+	// The compacted log cannot be created over a directory
+	tmpPath := filepath.Join(dir, logFileName+".tmp")
+	if err := os.Mkdir(tmpPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < compactThreshold; i++ {
+		id := "job-" + strconv.Itoa(i)
+		q.Put(id, nil)
+		get(t, q)
+		if err := q.Ack(id); err != nil {
+			t.Fatalf("Ack = %v, want nil", err)
+		}
+	}
+	if logged == 0 {
+		t.Error("failed compaction was not logged")
+	}
+
+	// The next compaction succeeds once it can write
+	os.Remove(tmpPath)
+	q.Put("last", nil)
+	get(t, q)
+	if err := q.Ack("last"); err != nil {
+		t.Fatal(err)
+	}
+	if n := logLines(t, dir); n >= compactThreshold {
+		t.Errorf("log has %d records, it was not compacted again", n)
+	}
+}
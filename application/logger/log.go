@@ -52,6 +52,7 @@ type ILogger interface {
 	DPanicf(template string, args ...interface{})
 	Fatal(args ...interface{})
 	Fatalf(template string, args ...interface{})
+	SetLevel(level string) error
 }
 
 type logger struct {
@@ -59,6 +60,7 @@ type logger struct {
 	logger      *zap.Logger
 	key         string
 	zapSugar    bool
+	level       zap.AtomicLevel
 }
 
 var Logger *logger = &logger{}
@@ -155,7 +157,8 @@ func Newlogger(cfg ConfigLogger) ILogger {
 		encoder = zapcore.NewJSONEncoder(encoderCfg)
 	}
 
-	core := zapcore.NewCore(encoder, configure(cfg), zap.NewAtomicLevelAt(logLevel))
+	level := zap.NewAtomicLevelAt(logLevel)
+	core := zapcore.NewCore(encoder, configure(cfg), level)
 	loggerzap := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(0))
 	sugarLogger := loggerzap.Sugar()
 
@@ -164,6 +167,7 @@ func Newlogger(cfg ConfigLogger) ILogger {
 		logger:      loggerzap,
 		key:         uuid.NewString(),
 		zapSugar:    strings.Contains(cfg.ZapType, "sugar"),
+		level:       level,
 	}
 
 	Logger = logging
@@ -174,6 +178,16 @@ func (l *logger) SetLogID(key string) {
 	l.key = key
 }
 
+// SetLevel changes the level of the running logger
+func (l *logger) SetLevel(level string) error {
+	logLevel, exist := loggerLevelMap[level]
+	if !exist {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	l.level.SetLevel(logLevel)
+	return nil
+}
+
 func (l *logger) Debug(args ...interface{}) {
 	if l.zapSugar {
 		l.sugarLogger.Debug(args...)
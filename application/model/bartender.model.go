@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type BartenderApIResponse struct {
 	Id        string `json:"Id"`
@@ -9,11 +12,13 @@ type BartenderApIResponse struct {
 }
 
 type BartenderTrackingStatusResponse struct {
-	KeepStatusMinutes float64   `json:"KeepStatusMinutes"`
-	Id                string    `json:"Id"`
-	SubmittedBy       string    `json:"SubmittedBy"`
-	SubmittedTime     time.Time `json:"SubmittedTime"`
-	Status            string    `json:"Status"`
+	KeepStatusMinutes float64            `json:"KeepStatusMinutes"`
+	Id                string             `json:"Id"`
+	SubmittedBy       string             `json:"SubmittedBy"`
+	SubmittedTime     time.Time          `json:"SubmittedTime"`
+	Status            string             `json:"Status"`
+	Variables         BartenderVariables `json:"Variables"` // Requested with Variables=PrintJobStatus,Response
+	Messages          []BartenderMessage `json:"Messages"`  // Requested with MessageCount and MessageSeverity
 }
 
 //{
@@ -23,3 +28,96 @@ type BartenderTrackingStatusResponse struct {
 //"SubmittedTime": "2025-07-16T22:51:55.2797474+07:00",
 //"Status": "RanToCompletion"
 //}
+
+type BartenderMessage struct {
+	ActionName string `json:"ActionName"`
+	Category   string `json:"Category"`
+	Level      string `json:"Level"` // Verbose, Info, Warning, Error
+	Text       string `json:"Text"`
+	Time       string `json:"Time"`
+}
+
+// BartenderVariables holds the action variables by name, e.g. PrintJobStatus and Response
+type BartenderVariables map[string]string
+
+// UnmarshalJSON accepts both a name/value list and a plain object
+func (v *BartenderVariables) UnmarshalJSON(data []byte) error {
+	var list []struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+	}
+	if err := json.Unmarshal(data, &list); err == nil {
+		vars := make(BartenderVariables, len(list))
+		for _, item := range list {
+			vars[item.Name] = item.Value
+		}
+		*v = vars
+		return nil
+	}
+
+	var object map[string]string
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	*v = object
+	return nil
+}
+
+// BartenderActionRequest is the Integration Builder payload posted to /api/actions
+type BartenderActionRequest struct {
+	ActionGroup BartenderActionGroup `yaml:"ActionGroup" json:"ActionGroup"`
+}
+
+type BartenderActionGroup struct {
+	Actions []BartenderAction `yaml:"Actions" json:"Actions"`
+}
+
+// BartenderAction holds exactly one action
+type BartenderAction struct {
+	TransformTextToRecordSetAction *TransformTextToRecordSetAction `yaml:"TransformTextToRecordSetAction,omitempty" json:"TransformTextToRecordSetAction,omitempty"`
+	PrintBTWAction                 *PrintBTWAction                 `yaml:"PrintBTWAction,omitempty" json:"PrintBTWAction,omitempty"`
+}
+
+type TransformTextToRecordSetAction struct {
+	ConnectionSetup       BartenderFile `yaml:"ConnectionSetup" json:"ConnectionSetup"`
+	Text                  BartenderFile `yaml:"Text" json:"Text"`
+	RecordSetVariableName string        `yaml:"RecordSetVariableName" json:"RecordSetVariableName"`
+	TextFormat            string        `yaml:"TextFormat,omitempty" json:"TextFormat,omitempty"` // JSON, XML or Excel, empty for delimited text
+}
+
+type BartenderFile struct {
+	File string `yaml:"File" json:"File"`
+}
+
+type PrintBTWAction struct {
+	DocumentFile      string                      `yaml:"DocumentFile" json:"DocumentFile"`
+	Printer           string                      `yaml:"Printer" json:"Printer"`
+	SaveAfterPrint    bool                        `yaml:"SaveAfterPrint" json:"SaveAfterPrint"`
+	Copies            int                         `yaml:"Copies" json:"Copies"`
+	NamedDataSources  map[string]string           `yaml:"NamedDataSources,omitempty" json:"NamedDataSources,omitempty"`
+	DatabaseOverrides []BartenderDatabaseOverride `yaml:"DatabaseOverrides,omitempty" json:"DatabaseOverrides,omitempty"`
+}
+
+type BartenderDatabaseOverride struct {
+	Name                   string `yaml:"Name" json:"Name"`
+	Type                   string `yaml:"Type" json:"Type"`
+	DataSourceVariableName string `yaml:"DataSourceVariableName" json:"DataSourceVariableName"`
+}
+
+//ActionGroup:
+//  Actions:
+//    - TransformTextToRecordSetAction:
+//        ConnectionSetup:
+//          File: D:\hsk-bar\kid_vn\db.xml
+//        Text:
+//          File: D:\hsk-bar\data\test_20250716_225155_1752681115279747400_120.txt
+//        RecordSetVariableName: datum
+//    - PrintBTWAction:
+//        DocumentFile: D:\hsk-bar\kid_vn\kid_vn_noprice.btw
+//        Printer: HASAKI-RFID
+//        SaveAfterPrint: false
+//        Copies: 1
+//        DatabaseOverrides:
+//          - Name: db
+//            Type: VariableName
+//            DataSourceVariableName: datum
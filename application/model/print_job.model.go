@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// PrintJobStatusEvent is published to the print job status topic for every lifecycle step of a job
+type PrintJobStatusEvent struct {
+	CorrelationKey     string         `json:"correlation_key"`
+	OrderId            string         `json:"order_id,omitempty"`
+	JobId              string         `json:"job_id,omitempty"`
+	Event              string         `json:"event"` // received, partial_duplicate, exported, submitted, running, completed, failed, duplicate
+	Template           string         `json:"template,omitempty"`
+	Quantity           int            `json:"quantity,omitempty"`
+	Filename           string         `json:"filename,omitempty"`
+	Printer            string         `json:"printer,omitempty"`
+	BartenderId        string         `json:"bartender_id,omitempty"`
+	BartenderStatus    string         `json:"bartender_status,omitempty"`
+	BartenderStatusUrl string         `json:"bartender_status_url,omitempty"`
+	RetryCount         int            `json:"retry_count"`
+	Error              string         `json:"error,omitempty"`
+	InvalidProducts    []ProductError `json:"invalid_products,omitempty"` // Products rejected by the validation
+	DuplicateRfids     []string       `json:"duplicate_rfids,omitempty"`  // RFIDs skipped as already printed or queued
+	Timestamp          time.Time      `json:"timestamp"`
+}
+
+//{
+//"correlation_key": "MO-2025-000123",
+//"order_id": "MO-2025-000123",
+//"job_id": "local.bom-product-bartender-0-42",
+//"event": "submitted",
+//"template": "adultvn",
+//"quantity": 120,
+//"filename": "MO-2025-000123_adultvn_120_20250716_225155_0-42.txt",
+//"printer": "HASAKI-RFID",
+//"bartender_id": "c623be16-da9b-46e1-80f4-fb8f12f7dad5",
+//"bartender_status": "WaitingToRun",
+//"bartender_status_url": "http://127.0.0.1:5159/api/actions/c623be16-da9b-46e1-80f4-fb8f12f7dad5",
+//"retry_count": 0,
+//"timestamp": "2025-07-16T22:51:55.2797474+07:00"
+//}
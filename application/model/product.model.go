@@ -18,11 +18,77 @@ type Product struct {
 	RfidBarcode        string `json:"rfid_barcode"`
 	Price              string `json:"price"` // Price in string format, e.g., "100.00"
 	Currency           string `json:"currency"`
+	Category           string `json:"category"` // Optional, selects the size conversion rows, not exported by default
+}
+
+// ProductFields lists the product fields that can be exported to a label record set, in the default column order
+var ProductFields = []string{
+	"name", "code", "color", "material", "manufacture_office", "manufacture_company", "manufacture_date",
+	"us_size", "vn_size", "uk_size", "gender", "attribute", "size_available",
+	"qr_code", "rfid_barcode", "price", "currency",
+}
+
+// FieldValue returns the value of a field by its json name
+func (p *Product) FieldValue(field string) (string, bool) {
+	switch field {
+	case "name":
+		return p.Name, true
+	case "code":
+		return p.Code, true
+	case "color":
+		return p.Color, true
+	case "material":
+		return p.Material, true
+	case "manufacture_office":
+		return p.ManufactureOffice, true
+	case "manufacture_company":
+		return p.ManuFactureCompany, true
+	case "manufacture_date":
+		return p.ManufactureDate, true
+	case "us_size":
+		return p.USSize, true
+	case "vn_size":
+		return p.VNSize, true
+	case "uk_size":
+		return p.UKSize, true
+	case "gender":
+		return p.Gender, true
+	case "attribute":
+		return p.Attribute, true
+	case "size_available":
+		return p.SizeAvailable, true
+	case "qr_code":
+		return p.QrCode, true
+	case "rfid_barcode":
+		return p.RfidBarcode, true
+	case "price":
+		return p.Price, true
+	case "currency":
+		return p.Currency, true
+	case "category":
+		return p.Category, true
+	default:
+		return "", false
+	}
 }
 
 type ProductPrinterMsgKafkaRequest struct {
-	Template string     `json:"template"`
-	Products []*Product `json:"products"`
+	MessageId string     `json:"message_id"` // Unique per print request, a re-send keeps the same id
+	OrderId   string     `json:"order_id"`   // Manufacture order, used as correlation key of the status events
+	Template  string     `json:"template"`
+	Printer   string     `json:"printer"` // Optional, prints on this printer only
+	Station   string     `json:"station"` // Optional, prints on any printer of this station
+	Products  []*Product `json:"products"`
+}
+
+// ProductError is a validation rule broken by a product of a print request
+type ProductError struct {
+	Index       int    `json:"index"` // Position in products
+	Code        string `json:"code,omitempty"`
+	RfidBarcode string `json:"rfid_barcode,omitempty"`
+	Field       string `json:"field"`
+	Rule        string `json:"rule"` // required, enum, pattern, max_length or size_chart
+	Message     string `json:"message"`
 }
 
 //https://docs.google.com/spreadsheets/d/17jBvS6Gz2wkiFaxOErFhk_eN449Dev3u3e9eQAK3Wuc/edit?gid=926956614#gid=926956614
@@ -0,0 +1,147 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// EncryptedPrefix marks a value encrypted with the key file
+	EncryptedPrefix = "enc:"
+
+	keySize = 32 // AES-256
+)
+
+// reference is ${env:NAME} or ${file:path}
+var reference = regexp.MustCompile(`^\$\{(env|file):([^}]+)\}$`)
+
+// Resolver turns the secret references of the settings into their values
+type Resolver struct {
+	KeyFile   string                           // Key of the encrypted values, read on the first encrypted value
+	Dir       string                           // Directory of the relative ${file:...} paths
+	LookupEnv func(name string) (string, bool) // Variables of ${env:NAME}, default os.LookupEnv
+
+	key []byte
+}
+
+// Resolve returns the value a setting refers to: the environment variable of ${env:NAME},
+// the trimmed content of ${file:path}, the decryption of enc:... or the value itself
+func (r *Resolver) Resolve(value string) (string, error) {
+	if strings.HasPrefix(value, EncryptedPrefix) {
+		if r.key == nil {
+			key, err := LoadKey(r.KeyFile)
+			if err != nil {
+				return "", err
+			}
+			r.key = key
+		}
+		return Decrypt(r.key, value)
+	}
+
+	m := reference.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return value, nil
+	}
+	name := strings.TrimSpace(m[2])
+	if m[1] == "env" {
+		lookupEnv := r.LookupEnv
+		if lookupEnv == nil {
+			lookupEnv = os.LookupEnv
+		}
+		v, ok := lookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	}
+	path := name
+	if !filepath.IsAbs(path) && r.Dir != "" {
+		path = filepath.Join(r.Dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "read secret file")
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// LoadKey reads a key file written by GenerateKey
+func LoadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read secret key")
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, errors.Errorf("secret key %s is not %d hex encoded bytes", path, keySize)
+	}
+	return key, nil
+}
+
+// GenerateKey writes a random key to path, readable by its owner only. An existing key is
+// returned unchanged, replacing it would lose the values encrypted with it.
+func GenerateKey(path string) ([]byte, error) {
+	if _, err := os.Stat(path); err == nil {
+		return LoadKey(path)
+	}
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "create secret key directory")
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, errors.Wrap(err, "write secret key")
+	}
+	return key, nil
+}
+
+// Encrypt seals the value with AES-GCM, the result is enc: followed by the base64 nonce and
+// ciphertext
+func Encrypt(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value returned by Encrypt
+func Decrypt(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is malformed")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("encrypted value does not match the secret key")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
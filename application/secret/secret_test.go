@@ -0,0 +1,136 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := GenerateKey(filepath.Join(t.TempDir(), "secret.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"", "hasaki123@", "mật khẩu with spaces"} {
+		encrypted, err := Encrypt(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(encrypted, EncryptedPrefix) || (value != "" && strings.Contains(encrypted, value)) {
+			t.Errorf("Encrypt(%q) = %s", value, encrypted)
+		}
+		if again, _ := Encrypt(key, value); again == encrypted {
+			t.Errorf("Encrypt(%q) returned the same value twice, the nonce is not random", value)
+		}
+		if got, err := Decrypt(key, encrypted); err != nil || got != value {
+			t.Errorf("Decrypt = %q %v, want %q", got, err, value)
+		}
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := GenerateKey(filepath.Join(dir, "a.key"))
+	other, _ := GenerateKey(filepath.Join(dir, "b.key"))
+	encrypted, err := Encrypt(key, "hasaki123@")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another first character of the nonce
+	first := "A"
+	if encrypted[len(EncryptedPrefix)] == 'A' {
+		first = "B"
+	}
+	tampered := EncryptedPrefix + first + encrypted[len(EncryptedPrefix)+1:]
+	tests := []struct {
+		name  string
+		key   []byte
+		value string
+	}{
+		{name: "wrong key", key: other, value: encrypted},
+		{name: "tampered", key: key, value: tampered},
+		{name: "not base64", key: key, value: EncryptedPrefix + "%%%"},
+		{name: "too short", key: key, value: EncryptedPrefix + "AAAA"},
+		{name: "invalid key", key: []byte("short"), value: encrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Decrypt(tt.key, tt.value); err == nil {
+				t.Errorf("Decrypt = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestGenerateKeyKeepsExistingKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "secret.key")
+	key, err := GenerateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v %v, want 0600", info.Mode().Perm(), err)
+	}
+	again, err := GenerateKey(path)
+	if err != nil || string(again) != string(key) {
+		t.Errorf("existing key was replaced: %v", err)
+	}
+
+	os.WriteFile(path, []byte("abcd\n"), 0600)
+	if _, err := LoadKey(path); err == nil {
+		t.Error("short key was loaded")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "secret.key")
+	key, err := GenerateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, _ := Encrypt(key, "from-enc")
+	os.WriteFile(filepath.Join(dir, "password.txt"), []byte("from-file\r\n"), 0600)
+	variables := map[string]string{"SECRET_TEST_PASSWORD": "from-env"}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := variables[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		fails bool
+	}{
+		{name: "plain value", value: "hasaki123@", want: "hasaki123@"},
+		{name: "environment variable", value: "${env:SECRET_TEST_PASSWORD}", want: "from-env"},
+		{name: "missing variable", value: "${env:SECRET_TEST_MISSING}", fails: true},
+		{name: "relative file", value: " ${file:password.txt} ", want: "from-file"},
+		{name: "absolute file", value: "${file:" + filepath.Join(dir, "password.txt") + "}", want: "from-file"},
+		{name: "missing file", value: "${file:missing.txt}", fails: true},
+		{name: "encrypted", value: encrypted, want: "from-enc"},
+		{name: "not a reference", value: "${vault:password}", want: "${vault:password}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Resolver{KeyFile: keyFile, Dir: dir, LookupEnv: lookupEnv}
+			got, err := r.Resolve(tt.value)
+			if tt.fails {
+				if err == nil {
+					t.Errorf("Resolve = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Resolve = %q %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	r := &Resolver{KeyFile: filepath.Join(dir, "missing.key")}
+	if _, err := r.Resolve(encrypted); err == nil {
+		t.Error("encrypted value resolved without a key file")
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/export"
+	"kafka-consumer/application/model"
+	"kafka-consumer/config"
+)
+
+// Content types accepted by the Integration Builder actions endpoint
+const (
+	contentTypeYaml = "text/vnd.yaml"
+	contentTypeJson = "application/json"
+)
+
+// defaultBartenderRootPath is where the templates live on the Bartender host
+const defaultBartenderRootPath = config.DefaultBartenderRootPath
+
+// ActionTemplateData is the data available to an action_template_file
+type ActionTemplateData struct {
+	JobID                 string
+	Template              string
+	DocumentFile          string // Absolute on the Bartender host
+	ConnectionSetupFile   string // Absolute on the Bartender host
+	TextFile              string // Exported record set, absolute on the Bartender host
+	TextFormat            string // JSON, XML or Excel, empty for delimited text
+	Printer               string
+	Copies                int
+	SaveAfterPrint        bool
+	RecordSetVariableName string
+	DatabaseName          string
+	NamedDataSources      map[string]string
+}
+
+// actionTemplates caches the parsed action template files
+type actionTemplates struct {
+	mu        sync.Mutex
+	templates map[string]*template.Template
+}
+
+func (at *actionTemplates) get(path string) (*template.Template, error) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if t, ok := at.templates[path]; ok {
+		return t, nil
+	}
+	t, err := template.ParseFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if at.templates == nil {
+		at.templates = make(map[string]*template.Template)
+	}
+	at.templates[path] = t
+	return t, nil
+}
+
+// reset drops the parsed files, they are read again on the next action
+func (at *actionTemplates) reset() {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	at.templates = nil
+}
+
+// renderBartenderAction builds the action payload of the job with its content type
+func (ks *KafkaService) renderBartenderAction(job *BartenderPrinterJob) ([]byte, string, error) {
+	if job.DocumentFilePath == "" || job.ConnectionSetupPath == "" {
+		return nil, "", errors.New("templatePath is empty, cannot call Bartender Printer API")
+	}
+
+	data := ks.actionTemplateData(job)
+	format := constant.PayloadFormat(ks.cfg().BartenderPrinterAPI.PayloadFormat)
+	templateFile := ks.cfg().BartenderPrinterAPI.ActionTemplateFile
+	if t, ok := ks.cfg().Template(job.Template); ok {
+		format = constant.PayloadFormat(t.PayloadFormat)
+		templateFile = t.ActionTemplateFile
+	}
+
+	contentType := contentTypeYaml
+	if format == constant.PayloadFormatJson {
+		contentType = contentTypeJson
+	}
+
+	if templateFile != "" {
+		t, err := ks.actionTemplates.get(templateFile)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "load action template %s", templateFile)
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, "", errors.Wrapf(err, "render action template %s", templateFile)
+		}
+		return buf.Bytes(), contentType, nil
+	}
+
+	request := newBartenderActionRequest(data)
+	if format == constant.PayloadFormatJson {
+		payload, err := json.Marshal(request)
+		return payload, contentType, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(request); err != nil {
+		return nil, "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), contentType, nil
+}
+
+// actionTemplateData resolves the job paths on the Bartender host and the template action settings
+func (ks *KafkaService) actionTemplateData(job *BartenderPrinterJob) *ActionTemplateData {
+	rootPath := ks.cfg().BartenderPrinterAPI.RootPath
+	if rootPath == "" {
+		rootPath = defaultBartenderRootPath
+	}
+	dataPath := ks.cfg().BartenderPrinterAPI.DataPath
+	if dataPath == "" {
+		dataPath = windowsJoin(rootPath, "data")
+	}
+
+	data := &ActionTemplateData{
+		JobID:                 job.ID,
+		Template:              job.Template,
+		DocumentFile:          windowsJoin(rootPath, job.DocumentFilePath),
+		ConnectionSetupFile:   windowsJoin(rootPath, job.ConnectionSetupPath),
+		TextFile:              windowsJoin(dataPath, job.Filename),
+		Printer:               job.Printer,
+		Copies:                job.Copies,
+		RecordSetVariableName: "datum",
+		DatabaseName:          "db",
+	}
+	if t, ok := ks.cfg().Template(job.Template); ok {
+		applyTemplateActionSettings(data, t)
+	}
+	return data
+}
+
+// applyTemplateActionSettings copies the action settings of the template
+func applyTemplateActionSettings(data *ActionTemplateData, t *config.TemplateConfig) {
+	data.SaveAfterPrint = t.SaveAfterPrint
+	if exporter, ok := export.Get(t.ExportFormat); ok {
+		data.TextFormat = exporter.TextFormat()
+	}
+	data.NamedDataSources = t.NamedDataSources
+	if t.RecordSetVariableName != "" {
+		data.RecordSetVariableName = t.RecordSetVariableName
+	}
+	if t.DatabaseName != "" {
+		data.DatabaseName = t.DatabaseName
+	}
+}
+
+// newBartenderActionRequest builds the transform + print action group
+func newBartenderActionRequest(data *ActionTemplateData) *model.BartenderActionRequest {
+	return &model.BartenderActionRequest{
+		ActionGroup: model.BartenderActionGroup{
+			Actions: []model.BartenderAction{
+				{
+					TransformTextToRecordSetAction: &model.TransformTextToRecordSetAction{
+						ConnectionSetup:       model.BartenderFile{File: data.ConnectionSetupFile},
+						Text:                  model.BartenderFile{File: data.TextFile},
+						RecordSetVariableName: data.RecordSetVariableName,
+						TextFormat:            data.TextFormat,
+					},
+				},
+				{
+					PrintBTWAction: &model.PrintBTWAction{
+						DocumentFile:     data.DocumentFile,
+						Printer:          data.Printer,
+						SaveAfterPrint:   data.SaveAfterPrint,
+						Copies:           data.Copies,
+						NamedDataSources: data.NamedDataSources,
+						DatabaseOverrides: []model.BartenderDatabaseOverride{
+							{
+								Name:                   data.DatabaseName,
+								Type:                   "VariableName",
+								DataSourceVariableName: data.RecordSetVariableName,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// windowsJoin joins a path on the Bartender Windows host regardless of the OS the service runs on
+func windowsJoin(root string, name string) string {
+	return strings.TrimRight(root, `\/`) + `\` + strings.TrimLeft(name, `\/`)
+}
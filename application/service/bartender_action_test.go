@@ -0,0 +1,141 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"kafka-consumer/application/model"
+	"kafka-consumer/config"
+)
+
+func TestRenderBartenderAction(t *testing.T) {
+	actionTemplate := filepath.Join(t.TempDir(), "action.yml.tmpl")
+	if err := os.WriteFile(actionTemplate, []byte("Print: {{.DocumentFile}} on {{.Printer}} from {{.TextFile}} x{{.Copies}} as {{.TextFormat}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		template    config.TemplateConfig
+		contentType string
+		want        string // Rendered payload of an action template file
+		check       func(t *testing.T, request *model.BartenderActionRequest)
+	}{
+		{
+			name:        "yaml by default",
+			contentType: contentTypeYaml,
+			check: func(t *testing.T, r *model.BartenderActionRequest) {
+				transform, printAction := r.ActionGroup.Actions[0].TransformTextToRecordSetAction, r.ActionGroup.Actions[1].PrintBTWAction
+				if transform.Text.File != `E:\share\kidvn_1.txt` || transform.ConnectionSetup.File != `D:\hsk-bar\setup\kidvn.xml` || transform.TextFormat != "" {
+					t.Errorf("transform action = %+v", transform)
+				}
+				if printAction.DocumentFile != `D:\hsk-bar\kidvn.btw` || printAction.Printer != "HASAKI-RFID" || printAction.Copies != 2 {
+					t.Errorf("print action = %+v", printAction)
+				}
+				if o := printAction.DatabaseOverrides; len(o) != 1 || o[0].Name != "db" || o[0].DataSourceVariableName != "datum" {
+					t.Errorf("database overrides = %+v", o)
+				}
+			},
+		},
+		{
+			name:        "template action settings",
+			template:    config.TemplateConfig{PayloadFormat: "json", ExportFormat: "xlsx", RecordSetVariableName: "rows", DatabaseName: "labels", SaveAfterPrint: true},
+			contentType: contentTypeJson,
+			check: func(t *testing.T, r *model.BartenderActionRequest) {
+				transform, printAction := r.ActionGroup.Actions[0].TransformTextToRecordSetAction, r.ActionGroup.Actions[1].PrintBTWAction
+				if transform.TextFormat != "Excel" || transform.RecordSetVariableName != "rows" {
+					t.Errorf("transform action = %+v", transform)
+				}
+				if !printAction.SaveAfterPrint || printAction.DatabaseOverrides[0].Name != "labels" || printAction.DatabaseOverrides[0].DataSourceVariableName != "rows" {
+					t.Errorf("print action = %+v", printAction)
+				}
+			},
+		},
+		{
+			name:        "action template file",
+			template:    config.TemplateConfig{ActionTemplateFile: actionTemplate, ExportFormat: "json"},
+			contentType: contentTypeYaml,
+			want:        `Print: D:\hsk-bar\kidvn.btw on HASAKI-RFID from E:\share\kidvn_1.txt x2 as JSON` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.BartenderPrinterAPI.DataPath = `E:\share\`
+			tt.template.Key = "kidvn"
+			cfg.Templates = []config.TemplateConfig{tt.template}
+			ks := &KafkaService{}
+			ks.config.Store(cfg)
+			job := &BartenderPrinterJob{
+				ID:                  "bom-0-1",
+				Template:            "KIDVN",
+				Filename:            "kidvn_1.txt",
+				DocumentFilePath:    "kidvn.btw",
+				ConnectionSetupPath: `\setup\kidvn.xml`,
+				Printer:             "HASAKI-RFID",
+				Copies:              2,
+			}
+
+			payload, contentType, err := ks.renderBartenderAction(job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentType != tt.contentType {
+				t.Errorf("content type = %s, want %s", contentType, tt.contentType)
+			}
+			if tt.check == nil {
+				if string(payload) != tt.want {
+					t.Errorf("payload = %q, want %q", payload, tt.want)
+				}
+				return
+			}
+			request := &model.BartenderActionRequest{}
+			if contentType == contentTypeJson {
+				err = json.Unmarshal(payload, request)
+			} else {
+				err = yaml.Unmarshal(payload, request)
+			}
+			if err != nil {
+				t.Fatalf("payload does not parse: %v\n%s", err, payload)
+			}
+			if len(request.ActionGroup.Actions) != 2 {
+				t.Fatalf("got %d actions, want transform and print", len(request.ActionGroup.Actions))
+			}
+			tt.check(t, request)
+		})
+	}
+}
+
+func TestRenderBartenderActionErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template config.TemplateConfig
+		job      BartenderPrinterJob
+		want     string
+	}{
+		{name: "no document", job: BartenderPrinterJob{ConnectionSetupPath: "setup.xml"}, want: "templatePath is empty"},
+		{name: "missing action template", template: config.TemplateConfig{ActionTemplateFile: filepath.Join(t.TempDir(), "missing.tmpl")}, want: "load action template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			tt.template.Key = "kidvn"
+			cfg.Templates = []config.TemplateConfig{tt.template}
+			ks := &KafkaService{}
+			ks.config.Store(cfg)
+			job := tt.job
+			job.Template = "kidvn"
+			if job.DocumentFilePath == "" && job.ConnectionSetupPath == "" {
+				job.DocumentFilePath, job.ConnectionSetupPath = "kidvn.btw", "setup.xml"
+			}
+			if _, _, err := ks.renderBartenderAction(&job); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("renderBartenderAction = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/logger"
+)
+
+// circuitBreaker stops the workers from calling Bartender after consecutive failures.
+// Once the open timeout expires the health checker probes Bartender, half-open, and the
+// breaker closes again when the probe succeeds.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	logger      logger.ILogger
+	state       constant.CircuitState
+	failures    int
+	threshold   int
+	openTimeout time.Duration
+	openedAt    time.Time
+	changed     chan struct{} // Closed and replaced on every state change
+}
+
+func newCircuitBreaker(logger logger.ILogger, threshold int, openTimeout time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		logger:      logger,
+		state:       constant.CircuitClosed,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		changed:     make(chan struct{}),
+	}
+}
+
+// State returns the current state
+func (cb *circuitBreaker) State() constant.CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// wait blocks while the breaker is not closed
+func (cb *circuitBreaker) wait(ctx context.Context) error {
+	for {
+		cb.mu.Lock()
+		if cb.state == constant.CircuitClosed {
+			cb.mu.Unlock()
+			return nil
+		}
+		changed := cb.changed
+		cb.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// recordSuccess closes the breaker
+func (cb *circuitBreaker) recordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	if cb.state != constant.CircuitClosed {
+		cb.setState(constant.CircuitClosed, "Bartender responded")
+	}
+}
+
+// recordFailure opens the breaker after threshold consecutive failures, a failed probe reopens it
+func (cb *circuitBreaker) recordFailure(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	switch cb.state {
+	case constant.CircuitHalfOpen:
+		cb.openedAt = time.Now()
+		cb.setState(constant.CircuitOpen, "probe failed: "+err.Error())
+	case constant.CircuitClosed:
+		if cb.failures >= cb.threshold {
+			cb.openedAt = time.Now()
+			cb.setState(constant.CircuitOpen, err.Error())
+		}
+	}
+}
+
+// untilProbe returns how long until the open breaker may be probed, ok is false when it is not open
+func (cb *circuitBreaker) untilProbe() (time.Duration, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state != constant.CircuitOpen {
+		return 0, false
+	}
+	return time.Until(cb.openedAt.Add(cb.openTimeout)), true
+}
+
+// tryHalfOpen moves an open breaker whose timeout expired to half-open, the caller sends the probe
+func (cb *circuitBreaker) tryHalfOpen() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state != constant.CircuitOpen || time.Since(cb.openedAt) < cb.openTimeout {
+		return false
+	}
+	cb.setState(constant.CircuitHalfOpen, "probing Bartender")
+	return true
+}
+
+// changes returns a channel closed on the next state change
+func (cb *circuitBreaker) changes() <-chan struct{} {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.changed
+}
+
+// setState logs the transition and wakes up the waiters, the caller holds the lock
+func (cb *circuitBreaker) setState(state constant.CircuitState, reason string) {
+	if state == constant.CircuitClosed {
+		cb.logger.Infof("Bartender circuit breaker %s -> %s: %s", cb.state, state, reason)
+	} else {
+		cb.logger.Warnf("Bartender circuit breaker %s -> %s after %d failures: %s", cb.state, state, cb.failures, reason)
+	}
+	cb.state = state
+	close(cb.changed)
+	cb.changed = make(chan struct{})
+}
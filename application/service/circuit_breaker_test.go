@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"kafka-consumer/application/constant"
+)
+
+var errBartenderDown = errors.New("connection refused")
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		success  bool // A success after the failures
+		want     constant.CircuitState
+	}{
+		{name: "below threshold", failures: 2, want: constant.CircuitClosed},
+		{name: "at threshold", failures: 3, want: constant.CircuitOpen},
+		{name: "success resets the count", failures: 2, success: true, want: constant.CircuitClosed},
+		{name: "success closes", failures: 4, success: true, want: constant.CircuitClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := newCircuitBreaker(nopLogger{}, 3, time.Minute)
+			for i := 0; i < tt.failures; i++ {
+				cb.recordFailure(errBartenderDown)
+			}
+			if tt.success {
+				cb.recordSuccess()
+				// One more failure must not open the breaker again
+				cb.recordFailure(errBartenderDown)
+			}
+			if got := cb.State(); got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	cb := newCircuitBreaker(nopLogger{}, 1, 30*time.Millisecond)
+	if cb.tryHalfOpen() {
+		t.Fatal("closed breaker moved to half-open")
+	}
+	if _, ok := cb.untilProbe(); ok {
+		t.Fatal("closed breaker has a probe time")
+	}
+
+	cb.recordFailure(errBartenderDown)
+	if wait, ok := cb.untilProbe(); !ok || wait <= 0 {
+		t.Fatalf("untilProbe = %v %v, want the open timeout", wait, ok)
+	}
+	if cb.tryHalfOpen() {
+		t.Fatal("breaker moved to half-open before the open timeout")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if !cb.tryHalfOpen() || cb.State() != constant.CircuitHalfOpen {
+		t.Fatalf("breaker did not move to half-open after the open timeout, state %s", cb.State())
+	}
+	if cb.tryHalfOpen() {
+		t.Error("a second probe was allowed while half-open")
+	}
+
+	// A failed probe reopens the breaker for another timeout
+	cb.recordFailure(errBartenderDown)
+	if cb.State() != constant.CircuitOpen || cb.tryHalfOpen() {
+		t.Fatalf("state after a failed probe = %s, want open", cb.State())
+	}
+	time.Sleep(40 * time.Millisecond)
+	cb.tryHalfOpen()
+	cb.recordSuccess()
+	if cb.State() != constant.CircuitClosed {
+		t.Errorf("state after a successful probe = %s, want closed", cb.State())
+	}
+}
+
+func TestCircuitBreakerWait(t *testing.T) {
+	cb := newCircuitBreaker(nopLogger{}, 1, time.Minute)
+	if err := cb.wait(context.Background()); err != nil {
+		t.Fatalf("wait on a closed breaker = %v", err)
+	}
+
+	cb.recordFailure(errBartenderDown)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := cb.wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("wait on an open breaker = %v, want the context error", err)
+	}
+
+	released := make(chan error, 1)
+	go func() { released <- cb.wait(context.Background()) }()
+	changed := cb.changes()
+	cb.recordSuccess()
+	select {
+	case <-changed:
+	default:
+		t.Error("state change was not signaled")
+	}
+	select {
+	case err := <-released:
+		if err != nil {
+			t.Errorf("wait = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait was not released when the breaker closed")
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"kafka-consumer/config"
+)
+
+// RestartRequiredError lists the changed settings that only apply after a restart
+type RestartRequiredError struct {
+	Settings []string
+}
+
+func (e *RestartRequiredError) Error() string {
+	return fmt.Sprintf("restart required to apply %s", strings.Join(e.Settings, ", "))
+}
+
+// Reload applies a new configuration to the running service and returns the settings that
+// changed. The rate limits, the concurrency of the API calls, the log level, the templates and
+// the printers change live. When a setting needs a restart, such as the Kafka group id,
+// nothing is applied and a *RestartRequiredError lists those settings.
+func (ks *KafkaService) Reload(cfg *config.Config) ([]config.Change, error) {
+	if ks.ctx.Err() != nil {
+		return nil, errors.New("service is shutting down")
+	}
+	changes := config.Diff(ks.cfg(), cfg)
+	var restart []string
+	for _, c := range changes {
+		if !c.Live() {
+			restart = append(restart, c.Setting)
+		}
+	}
+	if len(restart) > 0 {
+		return changes, &RestartRequiredError{Settings: restart}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	old := ks.config.Swap(cfg)
+	if cfg.Logger.Level != old.Logger.Level {
+		if err := ks.logger.SetLevel(cfg.Logger.Level); err != nil {
+			ks.logger.Warnf("Keeping the log level: %v", err)
+		}
+	}
+	limit, burst := bartenderRate(cfg)
+	ks.rateLimiter.SetLimit(limit)
+	ks.rateLimiter.SetBurst(burst)
+
+	for _, pw := range ks.printers.update(cfg) {
+		ks.logger.Infof("Printer %s added to the registry", pw.name)
+		ks.startPrinterWorker(pw)
+	}
+
+	// Calls in flight release the semaphore they acquired, the new one takes the next calls
+	ks.semaphoreMu.Lock()
+	if n := apiConcurrency(cfg, ks.printers.size()); n != cap(ks.semaphore) {
+		ks.semaphore = make(chan struct{}, n)
+		ks.logger.Infof("Bartender API calls now limited to %d at a time", n)
+	}
+	ks.semaphoreMu.Unlock()
+
+	// Templates and their validation rules are compiled again on their next use
+	ks.validators.reset()
+	ks.actionTemplates.reset()
+	return changes, nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/pkg/errors"
+
+	"kafka-consumer/application/constant"
+)
+
+// Deliveries of a dead-letter record before the service stops with its message uncommitted
+const deadLetterAttempts = 3
+
+// Headers attached to every dead-letter record so operators can inspect and replay it
+const (
+	headerFailureStage    = "x-failure-stage"
+	headerFailureError    = "x-failure-error"
+	headerErrorClass      = "x-error-class"
+	headerRetryCount      = "x-retry-count"
+	headerSourceTopic     = "x-source-topic"
+	headerSourcePartition = "x-source-partition"
+	headerSourceOffset    = "x-source-offset"
+	headerSourceTimestamp = "x-source-timestamp"
+	headerFailedAt        = "x-failed-at"
+)
+
+// deadLetter describes a message that could not be parsed, exported or printed
+type deadLetter struct {
+	Stage           constant.FailureStage
+	Cause           error
+	Class           constant.ErrorClass // Set for print failures
+	RetryCount      int
+	Key             []byte
+	Payload         []byte
+	Source          kafka.TopicPartition
+	SourceTimestamp time.Time
+}
+
+// newDeadLetterFromMessage builds a dead letter for a failure that happened before a job was created
+func newDeadLetterFromMessage(msg *kafka.Message, stage constant.FailureStage, cause error) *deadLetter {
+	return &deadLetter{
+		Stage:           stage,
+		Cause:           cause,
+		Key:             msg.Key,
+		Payload:         msg.Value,
+		Source:          msg.TopicPartition,
+		SourceTimestamp: msg.Timestamp,
+	}
+}
+
+// newDeadLetterFromJob builds a dead letter for a print job that was given up
+func newDeadLetterFromJob(job *BartenderPrinterJob, stage constant.FailureStage, cause error) *deadLetter {
+	return &deadLetter{
+		Stage:           stage,
+		Cause:           cause,
+		RetryCount:      job.RetryCount,
+		Key:             job.MessageKey,
+		Payload:         job.Payload,
+		Source:          job.sourceTopicPartition(),
+		SourceTimestamp: job.CreatedAt,
+	}
+}
+
+// headers returns the Kafka headers of the dead-letter record
+func (dl *deadLetter) headers() []kafka.Header {
+	errText := ""
+	if dl.Cause != nil {
+		errText = dl.Cause.Error()
+	}
+	sourceTopic := ""
+	if dl.Source.Topic != nil {
+		sourceTopic = *dl.Source.Topic
+	}
+
+	headers := []kafka.Header{
+		{Key: headerFailureStage, Value: []byte(dl.Stage)},
+		{Key: headerFailureError, Value: []byte(errText)},
+		{Key: headerRetryCount, Value: []byte(strconv.Itoa(dl.RetryCount))},
+		{Key: headerSourceTopic, Value: []byte(sourceTopic)},
+		{Key: headerSourcePartition, Value: []byte(strconv.Itoa(int(dl.Source.Partition)))},
+		{Key: headerSourceOffset, Value: []byte(strconv.FormatInt(int64(dl.Source.Offset), 10))},
+		{Key: headerSourceTimestamp, Value: []byte(dl.SourceTimestamp.Format(time.RFC3339Nano))},
+		{Key: headerFailedAt, Value: []byte(time.Now().Format(time.RFC3339Nano))},
+	}
+	if dl.Class != "" {
+		headers = append(headers, kafka.Header{Key: headerErrorClass, Value: []byte(dl.Class)})
+	}
+	return headers
+}
+
+// sendToDeadLetter publishes the original payload to the dead-letter topic and waits for the
+// broker acknowledgement, a failed delivery is retried with the backoff of the print jobs. The
+// caller must not commit the offset of the message when it returns an error.
+func (ks *KafkaService) sendToDeadLetter(dl *deadLetter) error {
+	topic := ks.cfg().ProducerTopicInfo.TopicDeadLetter
+	if topic == "" {
+		err := errors.New("dead-letter topic is not configured")
+		ks.logger.Errorf("Cannot park message at stage %s: %v, cause: %v", dl.Stage, err, dl.Cause)
+		return err
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = ks.produce(topic, dl.Key, dl.Payload, dl.headers()); err == nil {
+			ks.logger.Warnf("Sent message from %v to dead-letter topic %s at stage %s: %v", dl.Source, topic, dl.Stage, dl.Cause)
+			return nil
+		}
+		ks.logger.Errorf("Failed to publish message to dead-letter topic %s (stage %s, cause: %v, attempt %d/%d): %v", topic, dl.Stage, dl.Cause, attempt, deadLetterAttempts, err)
+		if attempt == deadLetterAttempts {
+			return err
+		}
+		timer := time.NewTimer(ks.retryPolicy.backoff(attempt))
+		select {
+		case <-ks.ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/config"
+)
+
+// deadLetterService publishes dead letters to topic, retried a millisecond apart
+func deadLetterService(producer RecordProducer, topic string) *KafkaService {
+	cfg := &config.Config{}
+	cfg.ProducerTopicInfo.TopicDeadLetter = topic
+	ks := &KafkaService{
+		logger:      nopLogger{},
+		ctx:         context.Background(),
+		producer:    producer,
+		retryPolicy: newRetryPolicy(&config.BartenderPrinterAPIConfig{RetryBaseDelayMs: 1, RetryMaxDelayMs: 1}),
+	}
+	ks.config.Store(cfg)
+	return ks
+}
+
+func TestSendToDeadLetter(t *testing.T) {
+	tests := []struct {
+		name     string
+		topic    string
+		failures int // Deliveries rejected before the broker accepts
+		wantErr  bool
+	}{
+		{name: "delivered", topic: "dlq"},
+		{name: "delivered on the last attempt", topic: "dlq", failures: deadLetterAttempts - 1},
+		{name: "every attempt fails", topic: "dlq", failures: deadLetterAttempts, wantErr: true},
+		{name: "no topic", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := NewMemoryRecordProducer()
+			attempts := 0
+			producer.Fail = func(msg *kafka.Message) error {
+				if attempts++; attempts <= tt.failures {
+					return errors.New("broker unavailable")
+				}
+				return nil
+			}
+			ks := deadLetterService(producer, tt.topic)
+			topic := "local.bom-product-bartender"
+			dl := &deadLetter{
+				Stage:           constant.FailureStagePrint,
+				Cause:           errors.New("action faulted"),
+				Class:           constant.ErrorClassTransient,
+				RetryCount:      2,
+				Key:             []byte("MO-0001"),
+				Payload:         []byte(`{"order_id":"MO-0001"}`),
+				Source:          kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 42},
+				SourceTimestamp: time.Date(2025, 7, 16, 22, 51, 55, 0, time.UTC),
+			}
+
+			err := ks.sendToDeadLetter(dl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sendToDeadLetter = %v, want error %v", err, tt.wantErr)
+			}
+			records := producer.Records("dlq")
+			if tt.wantErr {
+				if len(records) != 0 {
+					t.Errorf("got %d dead-letter records, want none", len(records))
+				}
+				return
+			}
+			if len(records) != 1 {
+				t.Fatalf("got %d dead-letter records, want 1", len(records))
+			}
+			record := records[0]
+			if string(record.Key) != "MO-0001" || string(record.Value) != string(dl.Payload) {
+				t.Errorf("record %s = %s, want the original message", record.Key, record.Value)
+			}
+			headers := make(map[string]string)
+			for _, h := range record.Headers {
+				headers[h.Key] = string(h.Value)
+			}
+			want := map[string]string{
+				headerFailureStage:    "print",
+				headerFailureError:    "action faulted",
+				headerErrorClass:      "transient",
+				headerRetryCount:      "2",
+				headerSourceTopic:     topic,
+				headerSourcePartition: "1",
+				headerSourceOffset:    "42",
+				headerSourceTimestamp: "2025-07-16T22:51:55Z",
+			}
+			for key, value := range want {
+				if headers[key] != value {
+					t.Errorf("header %s = %q, want %q", key, headers[key], value)
+				}
+			}
+			if _, err := time.Parse(time.RFC3339Nano, headers[headerFailedAt]); err != nil {
+				t.Errorf("header %s: %v", headerFailedAt, err)
+			}
+		})
+	}
+}
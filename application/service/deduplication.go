@@ -0,0 +1,140 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+)
+
+// Prefixes of the deduplication keys
+const (
+	dedupKeyMessage = "msg:"
+	dedupKeyOrder   = "order:"
+	dedupKeyContent = "sha256:"
+	dedupKeyRfid    = "rfid:"
+)
+
+// messageDedupKey identifies a print request: by message id (falling back to the content hash),
+// by manufacture order id or by content hash depending on deduplication.message_key
+func (ks *KafkaService) messageDedupKey(req *model.ProductPrinterMsgKafkaRequest) string {
+	switch constant.DedupMessageKey(strings.ToLower(ks.cfg().Deduplication.MessageKey)) {
+	case constant.DedupMessageKeyOrderId:
+		if req.OrderId != "" {
+			return dedupKeyOrder + req.OrderId
+		}
+	case constant.DedupMessageKeyContentHash:
+		return dedupKeyContent + contentHash(req)
+	default:
+		if req.MessageId != "" {
+			return dedupKeyMessage + req.MessageId
+		}
+	}
+	return dedupKeyContent + contentHash(req)
+}
+
+// contentHash hashes the print request without its message id, so a re-send with a new id still matches
+func contentHash(req *model.ProductPrinterMsgKafkaRequest) string {
+	content := *req
+	content.MessageId = ""
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// reserveDedupKeys claims the message key and the RFID of every product for the job.
+// Products whose RFID is already printed or queued are removed from the request, their
+// RFIDs are kept in job.DuplicateRfids for the status events.
+// It returns true when the whole request is a duplicate and nothing is left to print.
+func (ks *KafkaService) reserveDedupKeys(job *BartenderPrinterJob, req *model.ProductPrinterMsgKafkaRequest) (bool, error) {
+	if ks.dedupStore == nil {
+		return false, nil
+	}
+
+	// A RFID tag must only be encoded once, even inside the same message
+	seen := make(map[string]bool)
+	unique := req.Products[:0]
+	for _, p := range req.Products {
+		if p.RfidBarcode != "" && seen[p.RfidBarcode] {
+			ks.logger.Warnf("Skipping product %s: RFID %s appears twice in message %s", p.Code, p.RfidBarcode, job.ID)
+			job.DuplicateRfids = append(job.DuplicateRfids, p.RfidBarcode)
+			continue
+		}
+		seen[p.RfidBarcode] = true
+		unique = append(unique, p)
+	}
+	req.Products = unique
+
+	messageKey := ks.messageDedupKey(req)
+	keys := append(rfidDedupKeys(req.Products), messageKey)
+	conflicts, err := ks.dedupStore.Reserve(job.ID, keys)
+	if err != nil {
+		return false, err
+	}
+	if len(conflicts) == 0 {
+		job.DedupKeys = keys
+		return false, nil
+	}
+
+	if owner, ok := conflicts[messageKey]; ok {
+		ks.logger.Warnf("Message %s is a duplicate of job %s (%s)", job.ID, owner.JobID, owner.State)
+		return true, nil
+	}
+
+	// Keep the products that were never printed
+	var remaining []*model.Product
+	for _, p := range req.Products {
+		if owner, ok := conflicts[dedupKeyRfid+p.RfidBarcode]; ok {
+			ks.logger.Warnf("Skipping product %s: RFID %s already handled by job %s (%s)", p.Code, p.RfidBarcode, owner.JobID, owner.State)
+			job.DuplicateRfids = append(job.DuplicateRfids, p.RfidBarcode)
+			continue
+		}
+		remaining = append(remaining, p)
+	}
+	if len(remaining) == 0 {
+		return true, nil
+	}
+	req.Products = remaining
+
+	keys = append(rfidDedupKeys(remaining), messageKey)
+	if _, err := ks.dedupStore.Reserve(job.ID, keys); err != nil {
+		return false, err
+	}
+	job.DedupKeys = keys
+	return false, nil
+}
+
+// markDedupPrinted keeps the job keys for the retention window so re-sends are not printed again
+func (ks *KafkaService) markDedupPrinted(job *BartenderPrinterJob) {
+	if ks.dedupStore == nil || len(job.DedupKeys) == 0 {
+		return
+	}
+	if err := ks.dedupStore.MarkPrinted(job.ID, job.DedupKeys); err != nil {
+		ks.logger.Errorf("Failed to record printed keys of job %s: %v", job.ID, err)
+	}
+}
+
+// releaseDedupKeys frees the job keys after a failure so the request can be printed again
+func (ks *KafkaService) releaseDedupKeys(job *BartenderPrinterJob) {
+	if ks.dedupStore == nil || len(job.DedupKeys) == 0 {
+		return
+	}
+	if err := ks.dedupStore.Release(job.ID, job.DedupKeys); err != nil {
+		ks.logger.Errorf("Failed to release keys of job %s: %v", job.ID, err)
+	}
+}
+
+// rfidDedupKeys returns one key per product RFID
+func rfidDedupKeys(products []*model.Product) []string {
+	keys := make([]string, 0, len(products))
+	for _, p := range products {
+		if p.RfidBarcode == "" {
+			continue
+		}
+		keys = append(keys, dedupKeyRfid+p.RfidBarcode)
+	}
+	return keys
+}
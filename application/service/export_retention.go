@@ -0,0 +1,158 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/datashare"
+	"kafka-consumer/config"
+)
+
+// maxFilenamePart keeps the export file names short enough for the Windows share
+const maxFilenamePart = 64
+
+// exportFilePattern matches the names of exportFilename, the retention sweeper leaves the
+// other files of the share alone
+var exportFilePattern = regexp.MustCompile(`^[A-Za-z0-9-]+_[A-Za-z0-9-]+_[0-9]+_[0-9]{8}_[0-9]{6}_[0-9]+-[0-9]+\.[a-z0-9]+$`)
+
+// exportFilename names the export after the order, the template and the quantity. The Kafka
+// position keeps two exports of the same order apart.
+func exportFilename(job *BartenderPrinterJob, template *config.TemplateConfig, now time.Time) string {
+	return fmt.Sprintf("%s_%s_%d_%s_%d-%d.%s",
+		sanitizeFilename(job.OrderId, "order"), sanitizeFilename(template.Key, "template"), job.Quantity,
+		now.Format("20060102_150405"), job.SourcePartition, job.SourceOffset, template.ExportFormat)
+}
+
+// sanitizeFilename keeps letters, digits and dashes, anything else becomes a dash
+func sanitizeFilename(value, fallback string) string {
+	value = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.TrimSpace(value))
+	value = strings.Trim(value, "-")
+	if len(value) > maxFilenamePart {
+		value = value[:maxFilenamePart]
+	}
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// activeExports holds the files being exported, before their job is queued
+type activeExports struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func newActiveExports() *activeExports {
+	return &activeExports{names: make(map[string]bool)}
+}
+
+func (a *activeExports) add(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.names[name] = true
+}
+
+func (a *activeExports) remove(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.names, name)
+}
+
+// activeFiles returns the exports of the jobs that did not complete, queued, leased and
+// waiting for a retry ones included
+func (ks *KafkaService) activeFiles() map[string]bool {
+	active := make(map[string]bool)
+	ks.exporting.mu.Lock()
+	for name := range ks.exporting.names {
+		active[name] = true
+	}
+	ks.exporting.mu.Unlock()
+
+	for _, data := range ks.jobQueue.Pending() {
+		var job BartenderPrinterJob
+		if err := json.Unmarshal(data, &job); err == nil && job.Filename != "" {
+			active[job.Filename] = true
+		}
+	}
+	return active
+}
+
+// startRetentionSweeper archives or deletes the exports of completed jobs
+func (ks *KafkaService) startRetentionSweeper() error {
+	r := ks.cfg().ExportRetention
+	if !r.Enabled {
+		return nil
+	}
+	maxAgeHours := r.MaxAgeHours
+	if maxAgeHours <= 0 {
+		maxAgeHours = 24 // Default keep completed exports for a day
+	}
+	maxSizeMB := r.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = 500 // Default cap the exports and the archive at 500 MB
+	}
+	minAgeMinutes := r.MinAgeMinutes
+	if minAgeMinutes <= 0 {
+		minAgeMinutes = 60 // Default give Bartender an hour to read a completed export
+	}
+	archiveMaxAgeDays := r.ArchiveMaxAgeDays
+	if archiveMaxAgeDays <= 0 {
+		archiveMaxAgeDays = 30 // Default keep archived exports for a month
+	}
+	intervalMinutes := r.IntervalMinutes
+	if intervalMinutes <= 0 {
+		intervalMinutes = 10 // Default sweep every 10 minutes
+	}
+
+	opts := datashare.Options{
+		Pattern:       exportFilePattern,
+		MaxAge:        time.Duration(maxAgeHours) * time.Hour,
+		MaxBytes:      int64(maxSizeMB) << 20,
+		MinAge:        time.Duration(minAgeMinutes) * time.Minute,
+		ArchiveMaxAge: time.Duration(archiveMaxAgeDays) * 24 * time.Hour,
+	}
+	if constant.RetentionAction(strings.ToLower(r.Action)) == constant.RetentionActionArchive {
+		opts.ArchiveDir = r.ArchivePath
+		if opts.ArchiveDir == "" {
+			opts.ArchiveDir = filepath.Join(ks.cfg().FileSharePath, ".archive")
+		}
+	}
+	sweeper, err := datashare.NewSweeper(ks.cfg().FileSharePath, opts)
+	if err != nil {
+		return err
+	}
+
+	ks.wg.Add(1)
+	go func() {
+		defer ks.wg.Done()
+		ticker := time.NewTicker(time.Duration(intervalMinutes) * time.Minute)
+		defer ticker.Stop()
+		for {
+			result, err := sweeper.Sweep(time.Now(), ks.activeFiles())
+			if err != nil {
+				ks.logger.Errorf("Export retention sweep: %v", err)
+			}
+			if result.Archived > 0 || result.Deleted > 0 {
+				ks.logger.Infof("Export retention archived %d and deleted %d files, freed %d bytes",
+					result.Archived, result.Deleted, result.FreedBytes)
+			}
+			select {
+			case <-ks.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"kafka-consumer/config"
+)
+
+// The sweeper only touches the files matching exportFilePattern, every export name must match it
+func TestExportFilenameMatchesSweeperPattern(t *testing.T) {
+	now := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+	tests := []struct {
+		name     string
+		job      BartenderPrinterJob
+		template config.TemplateConfig
+		want     string
+	}{
+		{name: "plain", job: BartenderPrinterJob{OrderId: "MO-1001", Quantity: 12, SourcePartition: 2, SourceOffset: 345},
+			template: config.TemplateConfig{Key: "care-label", ExportFormat: "csv"}, want: "MO-1001_care-label_12_20240305_140709_2-345.csv"},
+		{name: "unsafe characters", job: BartenderPrinterJob{OrderId: " MO/1001:A ", Quantity: 1},
+			template: config.TemplateConfig{Key: "size chart", ExportFormat: "xlsx"}, want: "MO-1001-A_size-chart_1_20240305_140709_0-0.xlsx"},
+		{name: "empty parts", job: BartenderPrinterJob{OrderId: "//"},
+			template: config.TemplateConfig{ExportFormat: "txt"}, want: "order_template_0_20240305_140709_0-0.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exportFilename(&tt.job, &tt.template, now)
+			if got != tt.want {
+				t.Errorf("exportFilename = %s, want %s", got, tt.want)
+			}
+			if !exportFilePattern.MatchString(got) {
+				t.Errorf("%s does not match the sweeper pattern", got)
+			}
+		})
+	}
+	for _, name := range []string{"readme.txt", "MO-1001_care-label_12.csv", ".MO-1001_care-label_12_20240305_140709_2-345.csv.tmp"} {
+		if exportFilePattern.MatchString(name) {
+			t.Errorf("%s matches the sweeper pattern", name)
+		}
+	}
+}
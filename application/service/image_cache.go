@@ -0,0 +1,85 @@
+package service
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kafka-consumer/application/imagecache"
+	"kafka-consumer/config"
+)
+
+// openImageCache opens the cache of the SizeAvailable images
+func openImageCache(config *config.Config) (*imagecache.Cache, error) {
+	c := config.ImageCache
+	dir := c.Path
+	if dir == "" {
+		dir = filepath.Join(config.FileSharePath, ".images")
+	}
+	maxSizeMB := c.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = 200 // Default keep 200 MB of images on disk
+	}
+	memorySizeMB := c.MemorySizeMB
+	if memorySizeMB <= 0 {
+		memorySizeMB = 32 // Default keep 32 MB of images in memory
+	}
+	maxImageSizeMB := c.MaxImageSizeMB
+	if maxImageSizeMB <= 0 {
+		maxImageSizeMB = 5 // Default refuse images over 5 MB
+	}
+	revalidateSeconds := c.RevalidateSeconds
+	if revalidateSeconds <= 0 {
+		revalidateSeconds = 300 // Default check the ETag every 5 minutes
+	}
+	timeoutSeconds := c.TimeoutSeconds
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = 10 // Default give up a download after 10 seconds
+	}
+
+	return imagecache.Open(dir, imagecache.Options{
+		MaxDiskBytes:   int64(maxSizeMB) << 20,
+		MaxMemoryBytes: int64(memorySizeMB) << 20,
+		MaxImageBytes:  int64(maxImageSizeMB) << 20,
+		Revalidate:     time.Duration(revalidateSeconds) * time.Second,
+		Client:         &http.Client{Timeout: time.Duration(timeoutSeconds) * time.Second},
+	})
+}
+
+// sizeAvailableFiles returns the size chart images to pre-sync by file name. The image name
+// of the chart is used when it has the extension of the URL, the URL file name otherwise.
+func sizeAvailableFiles(config *config.Config) map[string]string {
+	files := make(map[string]string)
+	for _, e := range config.SizeCharts.Entries {
+		if e.ImageUrl == "" {
+			continue
+		}
+		name := path.Base(strings.SplitN(e.ImageUrl, "?", 2)[0])
+		if e.Image != "" && strings.EqualFold(filepath.Ext(e.Image), path.Ext(name)) {
+			name = e.Image
+		}
+		files[name] = e.ImageUrl
+	}
+	return files
+}
+
+// startImageSync downloads the size chart images to file_size_available_path
+func (ks *KafkaService) startImageSync() {
+	files := sizeAvailableFiles(ks.cfg())
+	if len(files) == 0 {
+		return
+	}
+
+	ks.wg.Add(1)
+	go func() {
+		defer ks.wg.Done()
+		dir := ks.cfg().FileSizeAvailablePath
+		if err := ks.images.Sync(ks.ctx, dir, files); err != nil {
+			ks.logger.Errorf("Size available image sync: %v", err)
+			return
+		}
+		ks.logger.Infof("Synced %d size available images to %s", len(files), dir)
+	}()
+}
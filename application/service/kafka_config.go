@@ -0,0 +1,35 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"kafka-consumer/config"
+)
+
+// newKafkaConfigMap returns the settings of a Kafka client: the brokers and their security
+// from the configuration, the settings of the client, then the extra properties over them
+func newKafkaConfigMap(k config.KafkaConfig, settings kafka.ConfigMap) *kafka.ConfigMap {
+	m := kafka.ConfigMap{"bootstrap.servers": k.BootstrapServers}
+	set := func(key, value string) {
+		if value != "" {
+			m[key] = value
+		}
+	}
+	set("security.protocol", strings.ToLower(k.SecurityProtocol))
+	set("sasl.mechanisms", strings.ToUpper(k.SaslMechanism))
+	set("sasl.username", k.SaslUsername)
+	set("sasl.password", k.SaslPassword)
+	set("ssl.ca.location", k.SslCaLocation)
+	set("ssl.certificate.location", k.SslCertificateLocation)
+	set("ssl.key.location", k.SslKeyLocation)
+	set("ssl.key.password", k.SslKeyPassword)
+	for key, value := range settings {
+		m[key] = value
+	}
+	for key, value := range k.Properties {
+		m[strings.TrimSpace(key)] = value
+	}
+	return &m
+}
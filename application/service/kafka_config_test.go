@@ -0,0 +1,87 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"kafka-consumer/config"
+)
+
+func TestNewKafkaConfigMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		kafka    config.KafkaConfig
+		settings kafka.ConfigMap
+		want     kafka.ConfigMap
+	}{
+		{
+			name:  "plaintext",
+			kafka: config.KafkaConfig{BootstrapServers: "broker:9092"},
+			want:  kafka.ConfigMap{"bootstrap.servers": "broker:9092"},
+		},
+		{
+			name: "sasl scram over tls",
+			kafka: config.KafkaConfig{
+				BootstrapServers: "broker:9093",
+				SecurityProtocol: "SASL_SSL",
+				SaslMechanism:    "scram-sha-512",
+				SaslUsername:     "printer",
+				SaslPassword:     "secret",
+				SslCaLocation:    "ca.pem",
+			},
+			want: kafka.ConfigMap{
+				"bootstrap.servers": "broker:9093",
+				"security.protocol": "sasl_ssl",
+				"sasl.mechanisms":   "SCRAM-SHA-512",
+				"sasl.username":     "printer",
+				"sasl.password":     "secret",
+				"ssl.ca.location":   "ca.pem",
+			},
+		},
+		{
+			name: "mutual tls",
+			kafka: config.KafkaConfig{
+				BootstrapServers:       "broker:9093",
+				SecurityProtocol:       "ssl",
+				SslCertificateLocation: "client.pem",
+				SslKeyLocation:         "client.key",
+				SslKeyPassword:         "key-secret",
+			},
+			want: kafka.ConfigMap{
+				"bootstrap.servers":        "broker:9093",
+				"security.protocol":        "ssl",
+				"ssl.certificate.location": "client.pem",
+				"ssl.key.location":         "client.key",
+				"ssl.key.password":         "key-secret",
+			},
+		},
+		{
+			name: "properties over the client settings",
+			kafka: config.KafkaConfig{
+				BootstrapServers: "broker:9092",
+				Properties:       map[string]string{" session.timeout.ms ": "45000", "socket.timeout.ms": "30000"},
+			},
+			settings: kafka.ConfigMap{"group.id": "printer", "session.timeout.ms": 10000},
+			want: kafka.ConfigMap{
+				"bootstrap.servers":  "broker:9092",
+				"group.id":           "printer",
+				"session.timeout.ms": "45000",
+				"socket.timeout.ms":  "30000",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := *newKafkaConfigMap(tt.kafka, tt.settings)
+			if len(got) != len(tt.want) {
+				t.Errorf("config map = %v, want %v", got, tt.want)
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s = %v, want %v", key, got[key], want)
+				}
+			}
+		})
+	}
+}
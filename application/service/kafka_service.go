@@ -1,28 +1,26 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
-	facker "kafka-consumer/application/faker"
-	"math/rand"
-	"net/http"
-	"os"
-	"strconv"
-	"strings"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/Azure/go-ntlmssp"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/pkg/errors"
 	"golang.org/x/time/rate"
 
 	"kafka-consumer/application/constant"
+	"kafka-consumer/application/datashare"
+	"kafka-consumer/application/dedup"
+	"kafka-consumer/application/export"
+	"kafka-consumer/application/imagecache"
+	"kafka-consumer/application/jobqueue"
 	"kafka-consumer/application/logger"
 	"kafka-consumer/application/model"
 	"kafka-consumer/config"
@@ -30,245 +28,628 @@ import (
 
 // BartenderPrinterJob represents a print job
 type BartenderPrinterJob struct {
+	ID                  string
+	CorrelationKey      string // Reported with every status event so BOM can match it to the manufacture order
+	OrderId             string
+	Template            string
+	Quantity            int
 	Filename            string
 	DocumentFilePath    string
 	ConnectionSetupPath string
+	Printer             string   // Printer the job is assigned to
+	Candidates          []string // Printers able to serve the job, preferred first
+	Copies              int
 	RetryCount          int
 	MaxRetries          int
 	CreatedAt           time.Time
 	LastAttemptAt       time.Time
+
+	// Bartender action of the current attempt
+	BartenderId        string
+	BartenderStatusUrl string
+	Status             constant.BartenderActionStatus
+
+	// Products dropped by the validation, reported with the status events
+	InvalidProducts []model.ProductError
+
+	// RFIDs of the products skipped as already printed or queued, reported with the status events
+	DuplicateRfids []string
+
+	// Message and RFID keys reserved in the deduplication store
+	DedupKeys []string
+
+	// Source Kafka message, the offset is committed once the job reaches a terminal state
+	SourceTopic     string
+	SourcePartition int32
+	SourceOffset    int64
+	// Original message, published to the dead-letter topic when the job fails permanently
+	MessageKey []byte
+	Payload    []byte
+}
+
+// sourceTopicPartition returns the Kafka position of the message that created the job
+func (job *BartenderPrinterJob) sourceTopicPartition() kafka.TopicPartition {
+	topic := job.SourceTopic
+	return kafka.TopicPartition{
+		Topic:     &topic,
+		Partition: job.SourcePartition,
+		Offset:    kafka.Offset(job.SourceOffset),
+	}
 }
 
 // KafkaService contains all dependencies needed for Kafka operations
 type KafkaService struct {
 	logger logger.ILogger
-	config *config.Config
+	// Current configuration, replaced by Reload
+	config atomic.Pointer[config.Config]
 
 	// Bartender Printer optimization
-	bartenderClient   *http.Client
-	rateLimiter       *rate.Limiter
-	jobQueue          chan *BartenderPrinterJob
-	workerCount       int
-	maxConcurrentJobs int
-	healthCheckTicker *time.Ticker
-	bartenderHealthy  bool
-	healthMutex       sync.RWMutex
-	ctx               context.Context
-	cancel            context.CancelFunc
-	wg                sync.WaitGroup
-	// Semaphore to ensure only 1 API call at a time
-	semaphore chan struct{}
+	backend          PrintBackend
+	rateLimiter      *rate.Limiter
+	jobQueue         *jobqueue.Queue
+	workerCount      int
+	bartenderHealthy bool
+	healthMutex      sync.RWMutex
+	ctx              context.Context
+	cancel           context.CancelFunc
+	wg               sync.WaitGroup
+	// Why the service stopped on its own, set by stop
+	stopErr   error
+	stopMutex sync.Mutex
+	// Semaphore to ensure only 1 API call at a time, replaced by Reload
+	semaphore   chan struct{}
+	semaphoreMu sync.Mutex
+	// Offsets of messages whose print jobs have not reached a terminal state yet
+	offsets *offsetTracker
+	// Producer for dead-letter records and print job status events, a Kafka producer unless
+	// given with WithProducer
+	producer RecordProducer
+	// Printed messages and RFIDs, nil when deduplication is disabled
+	dedupStore *dedup.Store
+	// Parsed action_template_file of the templates
+	actionTemplates actionTemplates
+	// Compiled validation rules of the templates
+	validators productValidators
+	// Downloaded SizeAvailable images, nil when the local image paths are printed
+	images *imagecache.Cache
+	// Printers of the registry, each with its own worker
+	printers *printerPool
+	// Pauses the workers while Bartender keeps failing
+	breaker *circuitBreaker
+	// Backoff of failed jobs and the timer heap requeuing them
+	retryPolicy *retryPolicy
+	retries     *retryScheduler
+	// Print request messages, a Kafka consumer unless given with WithMessageSource
+	source MessageSource
+	// Files being exported, protected from the retention sweeper until their job is queued
+	exporting *activeExports
 }
 
-// NewKafkaService creates a new KafkaService instance
-func NewKafkaService(logger logger.ILogger, config *config.Config) *KafkaService {
-	ctx, cancel := context.WithCancel(context.Background())
+// Option customizes a KafkaService
+type Option func(ks *KafkaService)
 
-	// Create optimized HTTP client with connection pooling
-	transport := &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		IdleConnTimeout:     90 * time.Second,
+// WithMessageSource reads the print requests from source instead of a Kafka consumer
+func WithMessageSource(source MessageSource) Option {
+	return func(ks *KafkaService) {
+		ks.source = source
 	}
+}
 
-	// Wrap with NTLM authentication
-	ntlmTransport := ntlmssp.Negotiator{
-		RoundTripper: transport,
+// WithPrintBackend sends the print actions to backend instead of the Bartender REST API
+func WithPrintBackend(backend PrintBackend) Option {
+	return func(ks *KafkaService) {
+		ks.backend = backend
 	}
+}
 
-	client := &http.Client{
-		Transport: ntlmTransport,
-		Timeout:   30 * time.Second, // Add timeout
+// WithProducer publishes the dead-letter records and the status events with producer instead
+// of a Kafka producer
+func WithProducer(producer RecordProducer) Option {
+	return func(ks *KafkaService) {
+		ks.producer = producer
 	}
+}
+
+// NewKafkaService creates a new KafkaService instance
+func NewKafkaService(logger logger.ILogger, config *config.Config, opts ...Option) (*KafkaService, error) {
+	ctx, cancel := context.WithCancel(context.Background())
 
 	// Configure rate limiting from config or use defaults
-	rateLimit := config.BartenderPrinterAPI.RateLimit
-	if rateLimit <= 0 {
-		rateLimit = 10 // Default 10 RPS
-	}
-	rateLimiter := rate.NewLimiter(rate.Limit(rateLimit), rateLimit/2) // Burst = rate/2
+	rateLimiter := rate.NewLimiter(bartenderRate(config))
 
 	// Configure job queue and workers from config or use defaults
+	// worker_count 0 caps parallel mode at one API call per printer, see below
 	workerCount := config.BartenderPrinterAPI.WorkerCount
-	//if workerCount <= 0 {
-	//	workerCount = 3 // Default 3 workers
-	//}
 
 	queueSize := config.BartenderPrinterAPI.QueueSize
 	if queueSize <= 0 {
 		queueSize = 100 // Default queue size
 	}
 
+	// Persist queued jobs next to the exported files so they survive a restart
+	queuePath := config.BartenderPrinterAPI.QueuePath
+	if queuePath == "" {
+		queuePath = filepath.Join(config.FileSharePath, ".queue")
+	}
+	// Finished jobs are remembered to recognise their messages redelivered after a restart
+	completedRetentionHours := config.BartenderPrinterAPI.CompletedRetentionHours
+	if completedRetentionHours <= 0 {
+		completedRetentionHours = 24 // Default remember finished jobs for a day
+	}
+	jobQueue, err := jobqueue.Open(queuePath, queueSize, time.Duration(completedRetentionHours)*time.Hour)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to open job queue")
+	}
+	jobQueue.SetErrorLog(logger.Errorf)
+	if pending := jobQueue.Len(); pending > 0 {
+		logger.Infof("Recovered %d pending print jobs from %s", pending, queuePath)
+	}
+
 	ks := &KafkaService{
-		logger:            logger,
-		config:            config,
-		bartenderClient:   client,
-		rateLimiter:       rateLimiter,
-		jobQueue:          make(chan *BartenderPrinterJob, queueSize),
-		workerCount:       workerCount,
-		maxConcurrentJobs: workerCount, // Use worker count as max concurrent
-		bartenderHealthy:  true,
-		ctx:               ctx,
-		cancel:            cancel,
-		semaphore:         make(chan struct{}, 1), // Only 1 API call at a time
-	}
-
-	//// Start health check goroutine
-	//ks.startHealthCheck()
+		logger:           logger,
+		rateLimiter:      rateLimiter,
+		jobQueue:         jobQueue,
+		workerCount:      workerCount,
+		bartenderHealthy: true,
+		ctx:              ctx,
+		cancel:           cancel,
+		offsets:          newOffsetTracker(),
+		printers:         newPrinterPool(logger, config),
+		retryPolicy:      newRetryPolicy(&config.BartenderPrinterAPI),
+		retries:          newRetryScheduler(),
+		exporting:        newActiveExports(),
+	}
+	ks.config.Store(config)
+	ks.backend = newHTTPPrintBackend(logger, ks.cfg)
+	for _, opt := range opts {
+		opt(ks)
+	}
+
+	circuitThreshold := config.BartenderPrinterAPI.CircuitFailureThreshold
+	if circuitThreshold <= 0 {
+		circuitThreshold = 5 // Default open after 5 consecutive failures
+	}
+	circuitOpenSeconds := config.BartenderPrinterAPI.CircuitOpenSeconds
+	if circuitOpenSeconds <= 0 {
+		circuitOpenSeconds = 30 // Default probe again after 30 seconds
+	}
+	ks.breaker = newCircuitBreaker(logger, circuitThreshold, time.Duration(circuitOpenSeconds)*time.Second)
+	ks.semaphore = make(chan struct{}, apiConcurrency(config, len(ks.printers.workers)))
+
+	if config.Deduplication.Enabled {
+		dedupPath := config.Deduplication.Path
+		if dedupPath == "" {
+			dedupPath = filepath.Join(config.FileSharePath, ".dedup")
+		}
+		retentionHours := config.Deduplication.RetentionHours
+		if retentionHours <= 0 {
+			retentionHours = 72 // Default remember printed labels for 3 days
+		}
+		store, err := dedup.Open(dedupPath, time.Duration(retentionHours)*time.Hour)
+		if err != nil {
+			cancel()
+			jobQueue.Close()
+			return nil, errors.Wrap(err, "failed to open deduplication store")
+		}
+		ks.dedupStore = store
+	}
+
+	if !config.IsUsedImgLocalPath || config.ImageCache.PreSync {
+		images, err := openImageCache(config)
+		if err != nil {
+			cancel()
+			jobQueue.Close()
+			if ks.dedupStore != nil {
+				ks.dedupStore.Close()
+			}
+			return nil, errors.Wrap(err, "failed to open image cache")
+		}
+		ks.images = images
+		if config.ImageCache.PreSync {
+			ks.startImageSync()
+		}
+	}
+
+	if err := ks.startRetentionSweeper(); err != nil {
+		ks.cancel()
+		ks.wg.Wait()
+		jobQueue.Close()
+		if ks.dedupStore != nil {
+			ks.dedupStore.Close()
+		}
+		return nil, errors.Wrap(err, "failed to start export retention")
+	}
+
+	// The workers publish status events and dead letters from their first job, recovered
+	// jobs included, so the producer exists before they start
+	if err := ks.startProducer(); err != nil {
+		ks.cancel()
+		ks.wg.Wait()
+		jobQueue.Close()
+		if ks.dedupStore != nil {
+			ks.dedupStore.Close()
+		}
+		return nil, errors.Wrap(err, "failed to create Kafka producer")
+	}
+
+	// Start health check goroutine, it also probes Bartender while the circuit breaker is open
+	ks.startHealthCheck()
 
 	// Start worker goroutines
 	ks.startWorkers()
 
-	return ks
+	return ks, nil
+}
+
+// cfg returns the current configuration
+func (ks *KafkaService) cfg() *config.Config {
+	return ks.config.Load()
+}
+
+// bartenderRate returns the rate limit of the Bartender API calls and its burst
+func bartenderRate(cfg *config.Config) (rate.Limit, int) {
+	rateLimit := cfg.BartenderPrinterAPI.RateLimit
+	if rateLimit <= 0 {
+		rateLimit = 10 // Default 10 RPS
+	}
+	return rate.Limit(rateLimit), rateLimit / 2 // Burst = rate/2
+}
+
+// apiConcurrency returns how many Bartender API calls may run at once
+func apiConcurrency(cfg *config.Config, printers int) int {
+	if cfg.BartenderPrinterAPI.SequentialMode {
+		return 1 // Only 1 API call at a time
+	}
+	// Parallel mode: worker_count caps the API calls across printers, default 1 per printer
+	maxConcurrent := cfg.BartenderPrinterAPI.WorkerCount
+	if maxConcurrent <= 0 {
+		maxConcurrent = printers
+	}
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	return maxConcurrent
+}
+
+// apiSlots returns the semaphore of the API calls, a call releases the slot it acquired even
+// when a reload replaced the semaphore meanwhile
+func (ks *KafkaService) apiSlots() chan struct{} {
+	ks.semaphoreMu.Lock()
+	defer ks.semaphoreMu.Unlock()
+	return ks.semaphore
+}
+
+// acquireAPISlot waits for a free Bartender API call, the caller runs release once its call
+// returned. A slot is only held for one request, a job tracking its action takes one per poll.
+func (ks *KafkaService) acquireAPISlot(ctx context.Context) (func(), error) {
+	semaphore := ks.apiSlots()
+	select {
+	case semaphore <- struct{}{}:
+		return func() { <-semaphore }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 // startHealthCheck starts periodic health check of Bartender Printer
 func (ks *KafkaService) startHealthCheck() {
-	ks.healthCheckTicker = time.NewTicker(30 * time.Second) // Check every 30 seconds
+	interval := time.Duration(ks.cfg().BartenderPrinterAPI.HealthCheckIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second // Default check every 30 seconds
+	}
 
 	ks.wg.Add(1)
 	go func() {
 		defer ks.wg.Done()
 		for {
+			// Probe as soon as an open breaker may half-open
+			wait := interval
+			if untilProbe, open := ks.breaker.untilProbe(); open && untilProbe < wait {
+				wait = untilProbe
+			}
+
+			timer := time.NewTimer(wait)
 			select {
 			case <-ks.ctx.Done():
+				timer.Stop()
 				return
-			case <-ks.healthCheckTicker.C:
-				ks.checkBartenderHealth()
+			case <-ks.breaker.changes():
+				// Reschedule, the breaker may just have opened
+				timer.Stop()
+				continue
+			case <-timer.C:
 			}
+
+			ks.checkBartenderHealth(ks.breaker.tryHalfOpen())
 		}
 	}()
 }
 
-// checkBartenderHealth checks if Bartender Printer is healthy
-func (ks *KafkaService) checkBartenderHealth() {
-	// Simple health check - try to connect to Bartender API
-	req, err := http.NewRequest("GET", ks.config.BartenderPrinterAPI.URL, nil)
-	if err != nil {
-		ks.setHealthStatus(false)
+// checkBartenderHealth checks if Bartender Printer is healthy. Only the probe of a half-open
+// breaker decides its state, otherwise the breaker follows the print calls: a health check
+// passing while the actions fail must not reset the failure count.
+func (ks *KafkaService) checkBartenderHealth(probe bool) {
+	err := ks.backend.Health(ks.ctx)
+	if err != nil && ks.ctx.Err() != nil {
 		return
 	}
-
-	req.Header.Set("accept", "application/json")
-	req.SetBasicAuth(ks.config.BartenderPrinterAPI.Username, ks.config.BartenderPrinterAPI.Password)
-
-	ctx, cancel := context.WithTimeout(ks.ctx, 5*time.Second)
-	defer cancel()
-	req = req.WithContext(ctx)
-
-	resp, err := ks.bartenderClient.Do(req)
 	if err != nil {
 		ks.logger.Warnf("Bartender health check failed: %v", err)
-		ks.setHealthStatus(false)
+	}
+	ks.setHealthStatus(err)
+	if !probe {
 		return
 	}
-	defer resp.Body.Close()
-
-	// Consider healthy if we get any response (even error responses)
-	ks.setHealthStatus(resp.StatusCode < 500)
+	if err == nil {
+		ks.breaker.recordSuccess()
+	} else {
+		ks.breaker.recordFailure(err)
+	}
 }
 
 // setHealthStatus updates the health status with thread safety
-func (ks *KafkaService) setHealthStatus(healthy bool) {
+func (ks *KafkaService) setHealthStatus(err error) {
+	healthy := err == nil
+
 	ks.healthMutex.Lock()
-	defer ks.healthMutex.Unlock()
+	changed := ks.bartenderHealthy != healthy
 	ks.bartenderHealthy = healthy
+	ks.healthMutex.Unlock()
+
+	if changed {
+		ks.logger.Infof("Bartender health changed, healthy: %v", healthy)
+	}
 }
 
-// isHealthy checks if Bartender is healthy
+// isHealthy checks if Bartender is healthy, a failed health check alone does not pause the
+// workers, the circuit breaker decides
 func (ks *KafkaService) isHealthy() bool {
-	ks.healthMutex.RLock()
-	defer ks.healthMutex.RUnlock()
-	return ks.bartenderHealthy
+	return ks.breaker.State() == constant.CircuitClosed
 }
 
-// startWorkers starts worker goroutines to process print jobs
+// startWorkers starts the dispatcher and one worker per printer
 func (ks *KafkaService) startWorkers() {
-	if ks.config.BartenderPrinterAPI.SequentialMode {
-		// Sequential mode: only 1 worker to ensure 1 API call at a time
+	if ks.cfg().BartenderPrinterAPI.SequentialMode {
+		// Sequential mode: printers share 1 API call at a time
 		ks.logger.Info("Starting in SEQUENTIAL mode - only 1 API call at a time")
-		ks.wg.Add(1)
-		go func() {
-			defer ks.wg.Done()
-			ks.worker(0)
-		}()
 	} else {
-		// Parallel mode: multiple workers for concurrent API calls
-		ks.logger.Infof("Starting in PARALLEL mode with %d workers", ks.workerCount)
-		for i := 0; i < ks.workerCount; i++ {
-			ks.wg.Add(1)
-			go func(workerID int) {
-				defer ks.wg.Done()
-				ks.worker(workerID)
-			}(i)
+		// Parallel mode: printers call the API concurrently
+		ks.logger.Infof("Starting in PARALLEL mode with up to %d concurrent API calls", cap(ks.apiSlots()))
+	}
+
+	ks.wg.Add(1)
+	go func() {
+		defer ks.wg.Done()
+		ks.dispatcher()
+	}()
+
+	ks.wg.Add(1)
+	go func() {
+		defer ks.wg.Done()
+		ks.retries.run(ks.ctx, ks.requeueRetry)
+	}()
+
+	for _, pw := range ks.printers.workers {
+		ks.startPrinterWorker(pw)
+	}
+}
+
+// startPrinterWorker starts the worker of a printer
+func (ks *KafkaService) startPrinterWorker(pw *printerWorker) {
+	ks.wg.Add(1)
+	go func() {
+		defer ks.wg.Done()
+		ks.worker(pw)
+	}()
+}
+
+// dispatcher assigns the queued print jobs to the printers
+func (ks *KafkaService) dispatcher() {
+	for {
+		id, data, err := ks.jobQueue.Get(ks.ctx)
+		if err != nil {
+			ks.logger.Info("Print job dispatcher shutting down")
+			return
+		}
+
+		job := &BartenderPrinterJob{}
+		if err := json.Unmarshal(data, job); err != nil {
+			ks.logger.Errorf("Dispatcher dropping unreadable job %s: %v", id, err)
+			if err := ks.jobQueue.Ack(id); err != nil {
+				ks.logger.Errorf("Failed to acknowledge job %s: %v", id, err)
+			}
+			continue
 		}
+
+		pw, err := ks.printers.assign(job)
+		if err != nil {
+			// The printers of the job were removed from the registry since it was queued
+			ks.logger.Errorf("Cannot assign job %s to a printer: %v", job.ID, err)
+			ks.failJob(job, newDeadLetterFromJob(job, constant.FailureStageRoute, err), err)
+			continue
+		}
+		ks.logger.Infof("Assigned job %s to printer %s", job.ID, pw.name)
 	}
 }
 
-// worker processes print jobs from the queue
-func (ks *KafkaService) worker(workerID int) {
-	ks.logger.Infof("Bartender worker %d started", workerID)
+// worker processes the print jobs assigned to a printer
+func (ks *KafkaService) worker(pw *printerWorker) {
+	ks.logger.Infof("Bartender worker for printer %s started", pw.name)
 
 	for {
-		select {
-		case <-ks.ctx.Done():
-			ks.logger.Infof("Bartender worker %d shutting down", workerID)
+		// Leave the jobs queued while the circuit breaker is open
+		if !ks.isHealthy() {
+			ks.logger.Infof("Bartender worker for printer %s paused, circuit breaker %s", pw.name, ks.breaker.State())
+			if err := ks.breaker.wait(ks.ctx); err != nil {
+				ks.logger.Infof("Bartender worker for printer %s shutting down", pw.name)
+				return
+			}
+			ks.logger.Infof("Bartender worker for printer %s resumed", pw.name)
+		}
+
+		job, err := ks.printers.next(ks.ctx, pw)
+		if err == errPrinterRemoved {
+			ks.logger.Infof("Bartender worker for printer %s stopped, printer removed from the registry", pw.name)
 			return
-		case job := <-ks.jobQueue:
-			ks.processPrintJob(job, workerID)
 		}
+		if err != nil {
+			ks.logger.Infof("Bartender worker for printer %s shutting down", pw.name)
+			return
+		}
+		err = ks.processPrintJob(job, pw)
+		if err != nil && (ks.ctx.Err() != nil || !ks.isHealthy() || classifyError(err) == constant.ErrorClassPermanent) {
+			// Interrupted by the shutdown, Bartender is down or the request is wrong, not a printer failure
+			ks.printers.release(pw)
+			continue
+		}
+		ks.printers.done(pw, err)
 	}
 }
 
-// processPrintJob processes a single print job with retry logic
-func (ks *KafkaService) processPrintJob(job *BartenderPrinterJob, workerID int) {
-	ks.semaphore <- struct{}{} // Acquire semaphore at the start
-	defer func() { <-ks.semaphore }()
+// requeueRetry puts a job whose backoff expired back in the queue, a failed put is tried again later
+func (ks *KafkaService) requeueRetry(job *BartenderPrinterJob) (time.Duration, bool) {
+	if err := ks.enqueueJob(job); err != nil {
+		retryIn := ks.retryPolicy.backoff(1)
+		ks.logger.Errorf("Failed to requeue job %s for retry, trying again in %v: %v", job.Filename, retryIn, err)
+		return retryIn, false
+	}
+	ks.logger.Infof("Requeued job %s for retry %d", job.Filename, job.RetryCount)
+	return 0, true
+}
+
+// enqueueJob persists the job at the tail of the queue, a job that is already queued is updated in place
+func (ks *KafkaService) enqueueJob(job *BartenderPrinterJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return ks.jobQueue.Put(job.ID, data)
+}
+
+// finishJob removes a job that reached a terminal state and releases its Kafka offset.
+// Printed jobs keep their deduplication keys, failed ones free them for a re-send.
+func (ks *KafkaService) finishJob(job *BartenderPrinterJob, printed bool) {
+	if printed {
+		ks.markDedupPrinted(job)
+	} else {
+		ks.releaseDedupKeys(job)
+	}
+	if err := ks.jobQueue.Ack(job.ID); err != nil {
+		ks.logger.Errorf("Failed to acknowledge job %s: %v", job.ID, err)
+	}
+	ks.offsets.markDone(job.sourceTopicPartition())
+}
+
+// handOffJob finishes a job Bartender accepted while its status is not tracked. The offset is
+// committed so the labels are not submitted twice, but the job is neither marked printed nor
+// reported completed: its deduplication keys stay pending until the retention expires.
+func (ks *KafkaService) handOffJob(job *BartenderPrinterJob) {
+	if err := ks.jobQueue.Ack(job.ID); err != nil {
+		ks.logger.Errorf("Failed to acknowledge job %s: %v", job.ID, err)
+	}
+	ks.offsets.markDone(job.sourceTopicPartition())
+}
+
+// failJob parks a job that failed permanently on the dead-letter topic and finishes it. When
+// the dead-letter topic cannot take it the offset stays uncommitted and the service stops,
+// so the message is redelivered after a restart instead of being lost or stalling the
+// commits of its partition.
+func (ks *KafkaService) failJob(job *BartenderPrinterJob, dl *deadLetter, cause error) {
+	dlErr := ks.sendToDeadLetter(dl)
+	ks.publishJobEvent(job, constant.PrintJobEventFailed, cause)
+	if dlErr == nil {
+		ks.finishJob(job, false)
+		return
+	}
+	ks.releaseDedupKeys(job)
+	if err := ks.jobQueue.Drop(job.ID); err != nil {
+		ks.logger.Errorf("Failed to drop job %s: %v", job.ID, err)
+	}
+	ks.stop(errors.Wrapf(dlErr, "job %s at offset %v could not be parked on the dead-letter topic", job.ID, job.sourceTopicPartition()))
+}
+
+// stop shuts the service down on its own after a failure it cannot get past, the messages
+// not committed are redelivered after a restart. Done is closed and Err returns the cause.
+func (ks *KafkaService) stop(err error) {
+	ks.stopMutex.Lock()
+	if ks.stopErr == nil {
+		ks.stopErr = err
+	}
+	ks.stopMutex.Unlock()
+	ks.logger.Errorf("Stopping the consumer, the uncommitted messages are redelivered after a restart: %v", err)
+	ks.cancel()
+}
 
+// Done is closed once the service stops, by Close or after a failure reported by Err
+func (ks *KafkaService) Done() <-chan struct{} {
+	return ks.ctx.Done()
+}
+
+// Err returns the failure that stopped the service, nil while it runs or after Close
+func (ks *KafkaService) Err() error {
+	ks.stopMutex.Lock()
+	defer ks.stopMutex.Unlock()
+	return ks.stopErr
+}
+
+// processPrintJob processes a single print job with retry logic, it returns the error of the attempt
+func (ks *KafkaService) processPrintJob(job *BartenderPrinterJob, pw *printerWorker) error {
 	for {
-		job.LastAttemptAt = time.Now()
-		// Wait for rate limiter
+		// The breaker may have opened while the job was waiting for the printer
+		if err := ks.breaker.wait(ks.ctx); err != nil {
+			return err
+		}
+		// Wait for the Bartender and the printer rate limiters
 		if err := ks.rateLimiter.Wait(ks.ctx); err != nil {
 			ks.logger.Errorf("Rate limiter error: %v", err)
-			return
+			return err
+		}
+		if err := pw.limiter.Wait(ks.ctx); err != nil {
+			ks.logger.Errorf("Rate limiter error for printer %s: %v", pw.name, err)
+			return err
 		}
+		job.LastAttemptAt = time.Now()
 
-		// Process the job
-		resp, err := ks.callBartenderPrinterAPI(job.Filename, false, job.DocumentFilePath, job.ConnectionSetupPath)
-		if err != nil {
-			ks.logger.Errorf("Worker %d failed to process job %s: %v", workerID, job.Filename, err)
-			// Check if we can still retry
-			if job.RetryCount < job.MaxRetries {
-				job.RetryCount++
-				backoff := time.Duration(job.RetryCount) * 2 * time.Second
-				ks.logger.Infof("Retrying job %s in %v (attempt %d/%d)", job.Filename, backoff, job.RetryCount, job.MaxRetries)
-
-				// Schedule retry with backoff
-				go func() {
-					time.Sleep(backoff)
-					select {
-					case ks.jobQueue <- job:
-						ks.logger.Infof("Requeued job %s for retry %d", job.Filename, job.RetryCount)
-					default:
-						ks.logger.Errorf("Job queue full, dropping retry job: %s", job.Filename)
-					}
-				}()
-			} else {
-				// Max retries reached, log and stop
-				ks.logger.Errorf("Job %s FAILED PERMANENTLY after %d retries - STOPPING RETRY", job.Filename, job.MaxRetries)
-				time.Sleep(5 * time.Second)
-				// Job is now considered failed permanently, no more retries
-				return
-			}
-		} else {
-			ks.logger.Infof("Worker %d successfully processed job: %s", workerID, job.Filename)
-			if resp != nil && resp.Status == "WaitingToRun" {
-				time.Sleep(15 * time.Second)
-			} else {
-				time.Sleep(5 * time.Second)
-			}
-			return
+		// Submit the job and follow it until the printer is done
+		err := ks.submitAndTrackPrintJob(job)
+		if err == nil && job.Status != constant.BartenderActionRanToCompletion {
+			ks.logger.Warnf("Printer %s accepted job %s as Bartender action %s (%s), status tracking is off so the print outcome is unknown",
+				pw.name, job.Filename, job.BartenderId, job.Status)
+			ks.handOffJob(job)
+			return nil
 		}
+		if err == nil {
+			ks.logger.Infof("Printer %s successfully printed job: %s", pw.name, job.Filename)
+			ks.publishJobEvent(job, constant.PrintJobEventCompleted, nil)
+			ks.finishJob(job, true)
+			return nil
+		}
+
+		ks.logger.Errorf("Printer %s failed to process job %s: %v", pw.name, job.Filename, err)
+		if ks.ctx.Err() != nil {
+			// Shutting down, the message is not committed and will be redelivered
+			return err
+		}
+		class := classifyError(err)
+		if class == constant.ErrorClassTransient && job.RetryCount < job.MaxRetries {
+			job.RetryCount++
+			backoff := ks.retryPolicy.backoff(job.RetryCount)
+			ks.logger.Infof("Retrying job %s in %v (attempt %d/%d)", job.Filename, backoff, job.RetryCount, job.MaxRetries)
+
+			// Schedule retry with backoff, the job stays leased in the queue meanwhile
+			// so a restart resumes it right away
+			ks.retries.schedule(job, backoff)
+			return err
+		}
+
+		// Permanent error or max retries reached, log and stop
+		ks.logger.Errorf("Job %s FAILED PERMANENTLY (%s error) after %d retries - STOPPING RETRY", job.Filename, class, job.RetryCount)
+		dl := newDeadLetterFromJob(job, constant.FailureStagePrint, err)
+		dl.Class = class
+		ks.failJob(job, dl, err)
+		// Job is now considered failed permanently, no more retries
+		return err
 	}
 }
 
@@ -276,58 +657,126 @@ func (ks *KafkaService) processPrintJob(job *BartenderPrinterJob, workerID int)
 func (ks *KafkaService) Close() error {
 	ks.logger.Info("Shutting down KafkaService...")
 
-	// Stop health check
-	if ks.healthCheckTicker != nil {
-		ks.healthCheckTicker.Stop()
-	}
-
 	// Cancel context to stop all goroutines
 	ks.cancel()
 
 	// Wait for all goroutines to finish
 	ks.wg.Wait()
 
-	// Close job queue
-	close(ks.jobQueue)
+	// Close job queue, pending jobs are resumed on the next start
+	if err := ks.jobQueue.Close(); err != nil {
+		ks.logger.Errorf("Failed to close job queue: %v", err)
+	}
+
+	// Flush dead-letter records once nothing can produce anymore
+	ks.closeProducer()
+
+	if ks.dedupStore != nil {
+		if err := ks.dedupStore.Close(); err != nil {
+			ks.logger.Errorf("Failed to close deduplication store: %v", err)
+		}
+	}
 
 	ks.logger.Info("KafkaService shutdown complete")
 	return nil
 }
 
-// StartConsumer starts the Kafka consumer
+// StartConsumer subscribes to the topic and consumes it in the background until Close
 func (ks *KafkaService) StartConsumer() error {
-	c, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers": ks.config.Kafka.BootstrapServers,
-		"group.id":          ks.config.Kafka.GroupID,
-		"auto.offset.reset": ks.config.Kafka.AutoOffsetReset,
-	})
-	if err != nil {
-		return err
-	}
-	defer func(c *kafka.Consumer) {
-		err := c.Close()
+	c := ks.source
+	if c == nil {
+		consumer, err := kafka.NewConsumer(newKafkaConfigMap(ks.cfg().Kafka, kafka.ConfigMap{
+			"group.id":          ks.cfg().Kafka.GroupID,
+			"auto.offset.reset": ks.cfg().Kafka.AutoOffsetReset,
+			// Offsets are committed manually once the print jobs reach a terminal state
+			"enable.auto.commit": false,
+		}))
 		if err != nil {
-			ks.logger.Errorf("Failed to close consumer: %s", err)
+			return err
 		}
-	}(c)
+		c = consumer
+	}
 
-	err = c.SubscribeTopics([]string{ks.config.ConsumerTopicInfo.TopicBomBartenderPrinter}, nil)
+	err := c.SubscribeTopics([]string{ks.cfg().ConsumerTopicInfo.TopicBomBartenderPrinter}, ks.rebalanceCallback)
 	if err != nil {
 		ks.logger.Errorf("Failed to subscribe to topic: %s", err)
+		ks.closeConsumer(c)
 		return err
 	}
 
 	ks.logger.Infof("[Consumer Application Started] Listening to server: %s, topic: %s",
-		ks.config.Kafka.BootstrapServers, ks.config.ConsumerTopicInfo.TopicBomBartenderPrinter)
+		ks.cfg().Kafka.BootstrapServers, ks.cfg().ConsumerTopicInfo.TopicBomBartenderPrinter)
+
+	// Added before the goroutine starts, so Close always waits for it
+	ks.wg.Add(1)
+	go ks.consume(c)
+	return nil
+}
+
+// closeConsumer closes the message source
+func (ks *KafkaService) closeConsumer(c MessageSource) {
+	if err := c.Close(); err != nil {
+		ks.logger.Errorf("Failed to close consumer: %s", err)
+	}
+}
+
+// consume reads the messages until the service is closed, then commits the finished
+// offsets and closes the consumer
+func (ks *KafkaService) consume(c MessageSource) {
+	defer ks.wg.Done()
+	defer ks.closeConsumer(c)
+
+	commitInterval := time.Duration(ks.cfg().Kafka.CommitIntervalMs) * time.Millisecond
+	if commitInterval <= 0 {
+		commitInterval = time.Second // Default commit every second
+	}
+	commitTicker := time.NewTicker(commitInterval)
+	defer commitTicker.Stop()
 
 	// Start consuming messages
+	paused := false
 	for {
-		msg, err := c.ReadMessage(-1)
+		select {
+		case <-ks.ctx.Done():
+			ks.commitOffsets(c)
+			ks.logger.Infof("Consumer stopped, %d messages not committed will be redelivered", ks.offsets.pending())
+			return
+		case <-commitTicker.C:
+			ks.commitOffsets(c)
+		default:
+		}
+
+		// Hold back the consumer while the job queue is full, the printers drain it. The
+		// jobs assigned to the printers stay in the queue, so this also bounds their backlog.
+		if ks.jobQueue.Full() {
+			if !paused {
+				ks.logger.Warnf("Job queue full with %d jobs, pausing the consumer until the printers catch up", ks.jobQueue.Len())
+				paused = true
+			}
+			timer := time.NewTimer(100 * time.Millisecond)
+			select {
+			case <-ks.ctx.Done():
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+		if paused {
+			ks.logger.Info("Job queue has room again, consumer resumed")
+			paused = false
+		}
+
+		msg, err := c.ReadMessage(100 * time.Millisecond)
 		if err != nil {
+			var kafkaErr kafka.Error
+			if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrTimedOut {
+				continue
+			}
 			ks.logger.Errorf("Consumer error: %v", err)
 			continue
 		}
 
+		ks.offsets.track(msg.TopicPartition)
 		if err := ks.processMessage(msg); err != nil {
 			ks.logger.Errorf("Error processing message: %v", err)
 			continue
@@ -335,334 +784,304 @@ func (ks *KafkaService) StartConsumer() error {
 	}
 }
 
+// rebalanceCallback commits finished offsets before partitions are taken away from this consumer
+func (ks *KafkaService) rebalanceCallback(c *kafka.Consumer, event kafka.Event) error {
+	switch e := event.(type) {
+	case kafka.AssignedPartitions:
+		ks.logger.Infof("Partitions assigned: %v", e.Partitions)
+	case kafka.RevokedPartitions:
+		ks.logger.Infof("Partitions revoked: %v", e.Partitions)
+		ks.commitOffsets(c)
+		ks.offsets.revoke(e.Partitions)
+	}
+	return nil
+}
+
+// commitOffsets commits the offsets whose messages all reached a terminal state
+func (ks *KafkaService) commitOffsets(c MessageSource) {
+	offsets := ks.offsets.committable()
+	if len(offsets) == 0 {
+		return
+	}
+
+	if _, err := c.CommitOffsets(offsets); err != nil {
+		ks.logger.Errorf("Failed to commit offsets %v: %v", offsets, err)
+		ks.offsets.restore(offsets)
+		return
+	}
+	ks.logger.Debugf("Committed offsets: %v", offsets)
+}
+
 // processMessage handles individual Kafka messages
 func (ks *KafkaService) processMessage(msg *kafka.Message) error {
+	// Every path that does not hand the message to a print job is terminal for its offset,
+	// unless the message could not be parked on the dead-letter topic, which stops the service
+	enqueued, uncommitted := false, false
+	var job *BartenderPrinterJob
+	defer func() {
+		if enqueued {
+			return
+		}
+		if job != nil {
+			ks.releaseDedupKeys(job)
+		}
+		if uncommitted {
+			// Later offsets of the partition could never be committed past this one
+			ks.stop(errors.Errorf("message at offset %v could not be parked on the dead-letter topic", msg.TopicPartition))
+			return
+		}
+		ks.offsets.markDone(msg.TopicPartition)
+	}()
+
 	var productPrinterMsg model.ProductPrinterMsgKafkaRequest
 	if err := json.Unmarshal(msg.Value, &productPrinterMsg); err != nil {
 		ks.logger.Errorf("JSON unmarshal error: %v", err)
+		uncommitted = ks.sendToDeadLetter(newDeadLetterFromMessage(msg, constant.FailureStageParse, err)) != nil
+		ks.publishMessageEvent(msg, constant.PrintJobEventFailed, err)
 		return err
 	}
 
+	now := time.Now()
+	job = &BartenderPrinterJob{
+		ID:              jobIDFromMessage(msg),
+		CorrelationKey:  correlationKey(msg, &productPrinterMsg),
+		OrderId:         productPrinterMsg.OrderId,
+		Template:        productPrinterMsg.Template,
+		Quantity:        len(productPrinterMsg.Products),
+		RetryCount:      0,
+		MaxRetries:      ks.cfg().BartenderPrinterAPI.MaxRetries,
+		CreatedAt:       now,
+		LastAttemptAt:   now,
+		SourcePartition: msg.TopicPartition.Partition,
+		SourceOffset:    int64(msg.TopicPartition.Offset),
+		MessageKey:      msg.Key,
+		Payload:         msg.Value,
+	}
+	if msg.TopicPartition.Topic != nil {
+		job.SourceTopic = *msg.TopicPartition.Topic
+	}
+
+	// A redelivered message whose job was recovered from disk is already queued,
+	// the recovered job releases the offset once it finishes
+	if ks.jobQueue.Contains(job.ID) {
+		ks.logger.Infof("Print job %s recovered from disk is still pending, skipping redelivered message", job.ID)
+		enqueued = true
+		return nil
+	}
+	// The recovered job may also have finished before its message was redelivered
+	if ks.jobQueue.Completed(job.ID) {
+		ks.logger.Infof("Print job %s already finished, committing redelivered message", job.ID)
+		return nil
+	}
+	ks.publishJobEvent(job, constant.PrintJobEventReceived, nil)
+
 	if len(productPrinterMsg.Products) == 0 {
 		ks.logger.Warn("No products to export")
+		ks.publishJobEvent(job, constant.PrintJobEventFailed, errors.New("no products to export"))
 		return nil
 	}
 
-	documentFilePath, err := ks.getDocumentFilePath(productPrinterMsg.Template)
+	template, err := ks.getTemplate(productPrinterMsg.Template)
 	if err != nil {
-		ks.logger.Errorf("Error getting document file path: %v", err)
+		ks.logger.Errorf("Error getting template: %v", err)
+		uncommitted = ks.sendToDeadLetter(newDeadLetterFromMessage(msg, constant.FailureStageTemplate, err)) != nil
+		ks.publishJobEvent(job, constant.PrintJobEventFailed, err)
 		return err
 	}
 
-	connectionSetupFile, err := ks.getConnectionFilePath(productPrinterMsg.Template)
+	// BOM usually sends the size of one market, the others are converted before the checks
+	ks.convertSizes(productPrinterMsg.Products)
+
+	// Invalid products print bad labels, the template policy rejects the request or drops them
+	products, err := ks.validateProducts(job, template, productPrinterMsg.Products)
 	if err != nil {
-		ks.logger.Errorf("Error getting connection setup file path: %v", err)
+		ks.logger.Errorf("Validation error for message %s: %v", job.ID, err)
+		uncommitted = ks.sendToDeadLetter(newDeadLetterFromMessage(msg, constant.FailureStageValidate, err)) != nil
+		ks.publishJobEvent(job, constant.PrintJobEventFailed, err)
 		return err
 	}
+	productPrinterMsg.Products = products
 
-	now := time.Now()
-	quantity := len(productPrinterMsg.Products)
-	fileFormat := constant.FileTypeTxt
-	randomTime := strconv.FormatInt(time.Now().UnixNano(), 10) // random string based on timestamp
-	filename := "test" + "_" + now.Format("20060102_150405") + "_" + randomTime + "_" + strconv.Itoa(quantity) + "." + string(fileFormat)
-	filepath := ks.config.FileSharePath + string(os.PathSeparator) + filename
-
-	ks.populateAndRemakeProducts(productPrinterMsg.Products)
-
-	if err := ks.exportProducts(productPrinterMsg.Products, filepath, fileFormat); err != nil {
-		ks.logger.Errorf("Export error: %v", err)
+	duplicate, err := ks.reserveDedupKeys(job, &productPrinterMsg)
+	if err != nil {
+		// Printing twice wastes RFID tags, park the message for a replay rather than guessing
+		ks.logger.Errorf("Deduplication store error for message %s: %v", job.ID, err)
+		uncommitted = ks.sendToDeadLetter(newDeadLetterFromMessage(msg, constant.FailureStageDeduplicate, err)) != nil
+		ks.publishJobEvent(job, constant.PrintJobEventFailed, err)
 		return err
 	}
-	ks.logger.Infof("Exported products to %s at time: %s", filepath, now)
+	if duplicate {
+		ks.publishJobEvent(job, constant.PrintJobEventDuplicate, nil)
+		return nil
+	}
+	job.Quantity = len(productPrinterMsg.Products)
+	if len(job.DuplicateRfids) > 0 {
+		ks.publishJobEvent(job, constant.PrintJobEventPartialDuplicate, nil)
+	}
 
-	job := &BartenderPrinterJob{
-		Filename:            filename,
-		DocumentFilePath:    documentFilePath,
-		ConnectionSetupPath: connectionSetupFile,
-		RetryCount:          0,
-		MaxRetries:          ks.config.BartenderPrinterAPI.MaxRetries,
-		CreatedAt:           time.Now(),
-		LastAttemptAt:       time.Now(),
+	candidates, err := routePrinters(ks.cfg(), &productPrinterMsg, template)
+	if err != nil {
+		ks.logger.Errorf("Error routing message %s to a printer: %v", job.ID, err)
+		uncommitted = ks.sendToDeadLetter(newDeadLetterFromMessage(msg, constant.FailureStageRoute, err)) != nil
+		ks.publishJobEvent(job, constant.PrintJobEventFailed, err)
+		return err
 	}
 
-	select {
-	case ks.jobQueue <- job:
-		ks.logger.Infof("Enqueued print job for %s", filename)
-	default:
-		ks.logger.Errorf("Job queue full, dropping print job for %s", filename)
+	filename := exportFilename(job, template, now)
+	exportPath := filepath.Join(ks.cfg().FileSharePath, filename)
+
+	ks.populateAndRemakeProducts(productPrinterMsg.Products, template)
+
+	// The sweeper leaves the file alone until the job is queued
+	ks.exporting.add(filename)
+	defer ks.exporting.remove(filename)
+	if err := ks.exportProducts(productPrinterMsg.Products, template, exportPath); err != nil {
+		ks.logger.Errorf("Export error: %v", err)
+		uncommitted = ks.sendToDeadLetter(newDeadLetterFromMessage(msg, constant.FailureStageExport, err)) != nil
+		ks.publishJobEvent(job, constant.PrintJobEventFailed, err)
+		return err
 	}
+	ks.logger.Infof("Exported products to %s at time: %s", exportPath, now)
+
+	job.Filename = filename
+	job.DocumentFilePath = template.DocumentFile
+	job.ConnectionSetupPath = template.ConnectionSetupFile
+	job.Printer = candidates[0]
+	job.Candidates = candidates
+	job.Copies = template.Copies
+	ks.publishJobEvent(job, constant.PrintJobEventExported, nil)
+
+	if err := ks.enqueueJob(job); err != nil {
+		ks.logger.Errorf("Failed to enqueue print job for %s: %v", filename, err)
+		uncommitted = ks.sendToDeadLetter(newDeadLetterFromMessage(msg, constant.FailureStageEnqueue, err)) != nil
+		ks.publishJobEvent(job, constant.PrintJobEventFailed, err)
+		return err
+	}
+	enqueued = true
+	ks.logger.Infof("Enqueued print job for %s", filename)
 
 	return nil
 }
 
-// exportProducts exports products to file based on format
-func (ks *KafkaService) exportProducts(products []*model.Product, filename string, filetype constant.FileType) error {
-	switch filetype {
-	case constant.FileTypeTxt:
-		return ks.exportProductDataToTxtFile(products, filename)
-	case constant.FileTypeCsv:
-		return ks.exportProductDataToCsvFile(products, filename)
-	default:
-		return fmt.Errorf("unsupported file type: %s", filetype)
+// jobIDFromMessage derives the job id from the Kafka position so a redelivered message maps to the same job
+func jobIDFromMessage(msg *kafka.Message) string {
+	topic := ""
+	if msg.TopicPartition.Topic != nil {
+		topic = *msg.TopicPartition.Topic
 	}
+	return fmt.Sprintf("%s-%d-%d", topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset)
 }
 
-// exportProductDataToTxtFile exports product data to TXT file
-func (ks *KafkaService) exportProductDataToTxtFile(products []*model.Product, filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
+// exportProducts exports the template columns of the products in the export format of the
+// template, the file appears complete or not at all
+func (ks *KafkaService) exportProducts(products []*model.Product, template *config.TemplateConfig, filename string) error {
+	exporter, ok := export.Get(template.ExportFormat)
+	if !ok {
+		return fmt.Errorf("unsupported export format %q", template.ExportFormat)
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			ks.logger.Errorf("Failed to close file: %s", err)
-		}
-	}(file)
-
-	// Write header
-	headerFields := []string{"name", "code", "color", "material", "manufacture_office", "manufacture_company", "manufacture_date", "us_size", "vn_size", "uk_size", "gender", "attribute", "size_available", "qr_code", "rfid_barcode", "price", "currency"}
-	headerLine := strings.Join(headerFields, ";") + "\n"
-	_, err = file.WriteString(headerLine)
+	set := newRecordSet(products, template)
+	err := datashare.WriteFile(filename, func(file io.Writer) error {
+		return exporter.Write(file, set)
+	})
 	if err != nil {
-		return err
-	}
-
-	// Write data
-	for _, p := range products {
-		line := fmt.Sprintf("%s;%s;%s;%s;%s;%s;%s;%s;%s;%s;%s;%s;%s;%s;%s;%s;%s\n",
-			p.Name, p.Code, p.Color, p.Material, p.ManufactureOffice, p.ManuFactureCompany, p.ManufactureDate, p.USSize,
-			p.VNSize, p.UKSize, p.Gender, p.Attribute, p.SizeAvailable,
-			p.QrCode, p.RfidBarcode, p.Price, p.Currency)
-		_, err = file.WriteString(line)
-		if err != nil {
-			return err
-		}
+		return fmt.Errorf("failed to write file: %w", err)
 	}
 	return nil
 }
 
-// exportProductDataToCsvFile exports product data to CSV file
-func (ks *KafkaService) exportProductDataToCsvFile(products []*model.Product, filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+// newRecordSet returns the columns of the template with a row per product
+func newRecordSet(products []*model.Product, template *config.TemplateConfig) *export.RecordSet {
+	set := &export.RecordSet{
+		Columns: make([]string, len(template.Columns)),
+		Rows:    make([][]string, len(products)),
+		Options: template.ExportOptions(),
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			ks.logger.Errorf("Failed to close file: %s", err)
-		}
-	}(file)
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Define header fields
-	headerFields := []string{
-		"name", "code", "color", "material", "manufacture_office", "manufacture_company", "manufacture_date",
-		"us_size", "vn_size", "uk_size", "gender", "attribute", "size_available",
-		"qr_code", "rfid_barcode", "price", "currency",
+	for i, column := range template.Columns {
+		set.Columns[i] = column.Name
 	}
-
-	// Write header row
-	if err := writer.Write(headerFields); err != nil {
-		return fmt.Errorf("failed to write header to CSV: %w", err)
+	for i, p := range products {
+		set.Rows[i] = productRecord(p, template.Columns)
 	}
+	return set
+}
 
-	// Write data rows
-	for _, p := range products {
-		record := []string{
-			p.Name, p.Code, p.Color, p.Material, p.ManufactureOffice, p.ManuFactureCompany, p.ManufactureDate,
-			p.USSize, p.VNSize, p.UKSize, p.Gender, p.Attribute, p.SizeAvailable,
-			p.QrCode, p.RfidBarcode, p.Price, p.Currency,
-		}
-		if err := writer.Write(record); err != nil {
-			return fmt.Errorf("failed to write record to CSV: %w", err)
+// productRecord returns the values of the columns of a product, in order
+func productRecord(p *model.Product, columns []config.ColumnConfig) []string {
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		if column.Field == "" {
+			record[i] = column.Value
+			continue
 		}
+		record[i], _ = p.FieldValue(column.Field)
 	}
-
-	return nil
+	return record
 }
 
-// callBartenderPrinterAPI calls the Bartender Printer API with optimized client
-func (ks *KafkaService) callBartenderPrinterAPI(filename string, isFakeCallApi bool, documentFilePath string, connectionSetupPath string) (*model.BartenderApIResponse, error) {
-	if isFakeCallApi {
-		resp := &http.Response{}
-		if rand.Intn(2) == 0 {
-			resp = facker.FakeAPICallRunning()
-		} else {
-			resp = facker.FakeAPICallWaitingToRun()
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			return nil, errors.Errorf("Fake API call failed with status: %s", resp.Status)
-		}
-
-		body, _ := io.ReadAll(resp.Body)
-		fmt.Println("========================================API Bartender Printer - RESPONSE====================================================")
-		ks.logger.Infof("API response: %s\n", string(body))
-		fmt.Println("========================================API Bartender Printer - RESPONSE====================================================")
-
-		bartenderResponse := &model.BartenderApIResponse{}
-		if err := json.Unmarshal(body, &bartenderResponse); err != nil {
-			ks.logger.Errorf("JSON unmarshal error at Bartender API response: %v", err)
-			return nil, nil
-		}
-
-		return bartenderResponse, nil
-	}
-
-	url := ks.config.BartenderPrinterAPI.URL
-	username := ks.config.BartenderPrinterAPI.Username
-	password := ks.config.BartenderPrinterAPI.Password
-
-	payload := ""
-	if documentFilePath != "" && connectionSetupPath != "" {
-		payload = fmt.Sprintf(`ActionGroup:
-  Actions:
-    - TransformTextToRecordSetAction:
-        ConnectionSetup:
-          File: D:\hsk-bar\%s
-        Text:
-          File: D:\hsk-bar\data\%s
-        RecordSetVariableName: datum
-    - PrintBTWAction:
-        DocumentFile: D:\hsk-bar\%s
-        Printer: HASAKI-RFID
-        SaveAfterPrint: false
-        Copies: 1
-        DatabaseOverrides:
-          - Name: db
-            Type: VariableName
-            DataSourceVariableName: datum`, connectionSetupPath, filename, documentFilePath)
-	} else {
-		return nil, errors.New("templatePath is empty, cannot call Bartender Printer API")
+// callBartenderPrinterAPI renders the action of the job and submits it to Bartender
+func (ks *KafkaService) callBartenderPrinterAPI(job *BartenderPrinterJob) (*model.BartenderApIResponse, error) {
+	payload, contentType, err := ks.renderBartenderAction(job)
+	if err != nil {
+		// Sending the same job again renders the same broken payload
+		return nil, permanent(err)
 	}
 
-	ks.logger.Infof("URL: %s, Payload: %s", url, payload)
+	// Credentials are never logged, the payload only at debug level
+	ks.logger.Infof("Sending job %s to %s, %d bytes", job.ID, config.RedactURL(ks.cfg().BartenderPrinterAPI.URL), len(payload))
+	ks.logger.Debugf("Payload of job %s: %s", job.ID, ks.cfg().Redact(string(payload)))
 
 	// Use context with timeout
 	ctx, cancel := context.WithTimeout(ks.ctx, 30*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, ks.config.BartenderPrinterAPI.Method, url, bytes.NewBuffer([]byte(payload)))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("accept", "application/json")
-	req.Header.Set("Content-Type", "text/vnd.yaml")
-	req.SetBasicAuth(username, password)
-
-	// Use the optimized client with connection pooling
-	resp, err := ks.bartenderClient.Do(req)
+	release, err := ks.acquireAPISlot(ctx)
 	if err != nil {
-		ks.logger.Errorf("Send request to Bartender Printer API error: %v", err)
 		return nil, err
 	}
-	ks.logger.Infof("Call API Printer Successfully: %s", filename)
-
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			ks.logger.Errorf("Failed to close response body: %s", err)
-		}
-	}(resp.Body)
-
-	body, _ := io.ReadAll(resp.Body)
-
-	bartenderResponse := &model.BartenderApIResponse{}
-	// Check response status
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("bartender API returned error status: %d, body: %s", resp.StatusCode, string(body))
-	} else {
-		fmt.Println("========================================API Bartender Printer - RESPONSE====================================================")
-		ks.logger.Infof("API response: %s\n", string(body))
-		fmt.Printf("API response: %s\n", string(body))
-		fmt.Println("========================================API Bartender Printer - RESPONSE====================================================")
-		// Parse the response body
-		if err := json.Unmarshal(body, &bartenderResponse); err != nil {
-			ks.logger.Errorf("JSON unmarshal error at Bartender API response: %v", err)
-			return nil, nil
-		}
-	}
-
-	// Optionally check job status for monitoring
-	// ks.checkBartenderPrinterAPIStatus(body)
-	return bartenderResponse, nil
+	resp, err := ks.backend.Submit(ctx, job, payload, contentType)
+	release()
+	ks.recordBartenderResult(err)
+	return resp, err
 }
 
-func (ks *KafkaService) checkBartenderPrinterAPIStatus(body []byte) {
-	//BartenderApIResponse: {"Id":"c6027b37-c08e-4284-b36d-d35122fdf798","Status":"Running","StatusUrl":"http://127.0.0.1:5159/api/actions/c6027b37-c08e-4284-b36d-d35122fdf798"}
-	var bartenderApIResponse model.BartenderApIResponse
-	if err := json.Unmarshal(body, &bartenderApIResponse); err != nil {
-		ks.logger.Errorf("JSON unmarshal error: %v", err)
+// recordBartenderResult feeds the circuit breaker with the outcome of a Bartender call
+func (ks *KafkaService) recordBartenderResult(err error) {
+	if err == nil {
+		ks.breaker.recordSuccess()
 		return
 	}
-
-	if bartenderApIResponse.Status == "Running" || bartenderApIResponse.Status == "WaitingToRun" ||
-		strings.Contains(bartenderApIResponse.Status, "run") {
-		ks.logger.Infof("Bartender Printer API is running: %s", bartenderApIResponse.Status)
-		// Call API to check the status of the job
-		err := ks.callBartenderPrinterAPIStatus(bartenderApIResponse.StatusUrl)
-		if err != nil {
-			ks.logger.Errorf("Error checking Bartender Printer API status: %v", err)
-			return
-		}
-	}
-
-}
-
-// checkBartenderPrinterAPIStatus checks the status of the job
-func (ks *KafkaService) callBartenderPrinterAPIStatus(statusUrl string) error {
-	// http://localhost:5159/api/actions/f39f0ab2-3db8-4ad0-a56a-6f3ba94c0410?MessageCount=200&MessageSeverity=Info&Variables=PrintJobStatus%2CResponse
-	buildUrl := statusUrl + "?MessageCount=200&MessageSeverity=Info&Variables=PrintJobStatus%2CResponse"
-
-	req, err := http.NewRequest(ks.config.BartenderTrackingScriptAPI.Method, buildUrl, nil)
-	if err != nil {
-		return err
-	}
-
-	username := ks.config.BartenderTrackingScriptAPI.Username
-	password := ks.config.BartenderTrackingScriptAPI.Password
-	req.Header.Set("accept", "application/json")
-	req.Header.Set("Content-Type", "text/vnd.yaml")
-	req.SetBasicAuth(username, password)
-
-	// Use NTLM authentication
-	client := http.Client{
-		Transport: ntlmssp.Negotiator{
-			RoundTripper: http.DefaultTransport,
-		},
+	if ks.ctx.Err() != nil {
+		// Shutting down, the call was cancelled
+		return
 	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		ks.logger.Errorf("Send request tracking script to Bartender Printer API error: %v", err)
-		return err
+	var statusErr *bartenderStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode < 500 {
+		// Bartender answered, a client error is a problem of the request, not of Bartender
+		ks.breaker.recordSuccess()
+		return
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			ks.logger.Errorf("Failed to close response body: %s", err)
-		}
-	}(resp.Body)
-
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Println("==============================API Tracking Script - RESPONSE============================")
-	ks.logger.Infof("API Tracking Script Response	: %s\n", string(body))
-	fmt.Println("==============================API Tracking Script - RESPONSE============================")
-	return nil
+	ks.breaker.recordFailure(err)
 }
 
-// populateAndRemakeProducts processes products and encodes SizeAvailable
-func (ks *KafkaService) populateAndRemakeProducts(products []*model.Product) {
+// populateAndRemakeProducts fills Attribute and SizeAvailable from the size chart of the template
+// and encodes SizeAvailable
+func (ks *KafkaService) populateAndRemakeProducts(products []*model.Product, template *config.TemplateConfig) {
 	for _, p := range products {
-		if ks.config.IsUsedImgLocalPath {
-			fileName := ks.getGenderSizeAvailablePath(p.USSize, p.Gender)
-			p.SizeAvailable = fileName
+		entry, found := ks.cfg().SizeChart(template.Market, p.Gender, ks.cfg().SizeOf(p))
+		if found && p.Attribute == "" {
+			p.Attribute = entry.Attribute
+		}
+		if ks.cfg().IsUsedImgLocalPath {
+			p.SizeAvailable = ""
+			if found {
+				p.SizeAvailable = entry.Image
+			}
 		} else {
-			sizeAvailableBase64, err := ks.base64Encode(p.SizeAvailable)
+			url := p.SizeAvailable
+			if found && entry.ImageUrl != "" {
+				url = entry.ImageUrl
+			}
+			sizeAvailableBase64, err := ks.base64Encode(url)
 			if err != nil {
 				ks.logger.Errorf("Error encoding SizeAvailable for product %s: %v", p.Name, err)
 				continue
@@ -672,107 +1091,22 @@ func (ks *KafkaService) populateAndRemakeProducts(products []*model.Product) {
 	}
 }
 
-// getDocumentFilePath returns the document file path based on template
-func (ks *KafkaService) getDocumentFilePath(template string) (string, error) {
-	switch strings.ToLower(template) {
-	case string(constant.KidVn):
-		return "kid_vn\\kid_vn_noprice.btw", nil
-	case string(constant.AdultVn):
-		return "adult_vn\\adult_vn_noprice.btw", nil
-	case string(constant.KidUs):
-		return "kid_us\\kid_us_noprice.btw", nil
-	case string(constant.AdultUs):
-		return "adult_us\\adult_us_noprice.btw", nil
-	default:
-		return "", errors.Errorf("Invalid template type: %s", template)
-	}
-}
-
-// getConnectionFilePath returns the connection file path based on template
-func (ks *KafkaService) getConnectionFilePath(template string) (string, error) {
-	switch strings.ToLower(template) {
-	case string(constant.KidVn):
-		return "kid_vn\\db.xml", nil
-	case string(constant.AdultVn):
-		return "adult_vn\\db.xml", nil
-	case string(constant.KidUs):
-		return "kid_us\\db.xml", nil
-	case string(constant.AdultUs):
-		return "adult_us\\db.xml", nil
-	default:
-		return "", errors.Errorf("Invalid template type: %s", template)
-	}
-}
-
-func (ks *KafkaService) getGenderSizeAvailablePath(usSize string, gender string) string {
-	switch strings.ToLower(gender) {
-	case string(constant.GenderTypeWomen), string(constant.GenderTypeMen):
-		return ks.getAdultSizeAvailablePath(usSize)
-	case string(constant.GenderTypeKid):
-		return ks.getKidSizeAvailablePath(usSize)
-	default:
-		return ""
-	}
-}
-
-func (ks *KafkaService) getAdultSizeAvailablePath(usSize string) string {
-	switch strings.ToLower(usSize) {
-	case string(constant.AdultSizeAvailableXS):
-		return "adult_xs.pdf"
-	case string(constant.AdultSizeAvailableS):
-		return "adult_s.pdf"
-	case string(constant.AdultSizeAvailableM):
-		return "adult_m.pdf"
-	case string(constant.AdultSizeAvailableL):
-		return "adult_l.pdf"
-	case string(constant.AdultSizeAvailableXL):
-		return "adult_xl.pdf"
-	case string(constant.AdultSizeAvailable2XL):
-		return "adult_2xl.pdf"
-	case string(constant.AdultSizeAvailable3XL):
-		return "adult_3xl.pdf"
-	default:
-		return ""
-	}
-}
-
-func (ks *KafkaService) getKidSizeAvailablePath(usSize string) string {
-	switch strings.ToLower(usSize) {
-	case string(constant.KidSizeAvailable3T):
-		return "kids_3t.pdf"
-	case string(constant.KidSizeAvailable4T):
-		return "kids_4t.pdf"
-	case string(constant.KidSizeAvailable5):
-		return "kids_5.pdf"
-	case string(constant.KidSizeAvailable6):
-		return "kids_6.pdf"
-	case string(constant.KidSizeAvailable7):
-		return "kids_7.pdf"
-	case string(constant.KidSizeAvailable8):
-		return "kids_8.pdf"
-	default:
-		return ""
-	}
-}
-
-// base64Encode fetches data from URL and encodes to base64
+// getTemplate returns the registered template selected by the message
+func (ks *KafkaService) getTemplate(key string) (*config.TemplateConfig, error) {
+	template, ok := ks.cfg().Template(key)
+	if !ok {
+		return nil, errors.Errorf("Invalid template type: %s", key)
+	}
+	return template, nil
+}
+
+// base64Encode fetches data from URL through the image cache and encodes to base64
 func (ks *KafkaService) base64Encode(url string) (string, error) {
 	if url == "" {
 		return "", errors.Errorf("Product attribute url is empty")
 	}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			ks.logger.Errorf("Failed to close response body: %s", err)
-		}
-	}(resp.Body)
-
-	body, err := io.ReadAll(resp.Body)
+	body, err := ks.images.Get(ks.ctx, url)
 	if err != nil {
 		return "", err
 	}
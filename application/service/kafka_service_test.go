@@ -0,0 +1,216 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/jobqueue"
+	"kafka-consumer/application/model"
+	"kafka-consumer/config"
+)
+
+// A job recovered after a restart can finish before Kafka redelivers its message, the
+// redelivery must be committed without printing again
+func TestRedeliveredMessageOfCompletedJobIsCommitted(t *testing.T) {
+	message, err := os.ReadFile(filepath.Join("testdata", "pipeline", "01_kidvn_print.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(filepath.Join("..", ".."))
+	cfg, err := config.Load(pipelineConfigFile)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg = pipelineConfig(cfg, t.TempDir())
+	os.MkdirAll(cfg.FileSharePath, 0755)
+
+	source := NewMemoryMessageSource(pipelineTopic)
+	msg := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &source.topic, Partition: 0, Offset: 0}}
+	queue, err := jobqueue.Open(cfg.BartenderPrinterAPI.QueuePath, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Put(jobIDFromMessage(msg), []byte(`{}`))
+	queue.Ack(jobIDFromMessage(msg))
+	queue.Close()
+
+	backend := NewMemoryPrintBackend()
+	ks, err := NewKafkaService(nopLogger{}, cfg, WithMessageSource(source), WithPrintBackend(backend), WithProducer(NewMemoryRecordProducer()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.Produce([]byte("MO-0001"), message, nil)
+	if err := ks.StartConsumer(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for source.Committed() < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ks.Close()
+	if source.Committed() != 1 {
+		t.Fatalf("committed offset %v, want 1", source.Committed())
+	}
+	if calls := backend.Calls(); len(calls) != 0 {
+		t.Errorf("redelivered message printed %d times", len(calls))
+	}
+}
+
+// Without status tracking nothing tells whether the labels were printed, the job is committed
+// but never reported completed, and its keys still stop a re-send
+func TestUntrackedJobIsNotReportedCompleted(t *testing.T) {
+	var messages [][]byte
+	for _, file := range []string{"01_kidvn_print.json", "02_kidvn_resend.json"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "pipeline", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, data)
+	}
+	t.Chdir(filepath.Join("..", ".."))
+	cfg, err := config.Load(pipelineConfigFile)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg = pipelineConfig(cfg, t.TempDir())
+	cfg.BartenderTrackingScriptAPI.IsCallAPI = false
+	os.MkdirAll(cfg.FileSharePath, 0755)
+
+	source := NewMemoryMessageSource(pipelineTopic)
+	backend := NewMemoryPrintBackend()
+	producer := NewMemoryRecordProducer()
+	ks, err := NewKafkaService(nopLogger{}, cfg, WithMessageSource(source), WithPrintBackend(backend), WithProducer(producer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range messages {
+		source.Produce([]byte("MO-0001"), message, nil)
+	}
+	if err := ks.StartConsumer(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for source.Committed() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ks.Close()
+	if source.Committed() != 2 {
+		t.Fatalf("committed offset %v, want 2", source.Committed())
+	}
+	if calls := backend.Calls(); len(calls) != 1 {
+		t.Errorf("got %d print actions, want 1", len(calls))
+	}
+
+	events := make(map[string]int)
+	for _, record := range producer.Records(pipelineStatusTopic) {
+		var event model.PrintJobStatusEvent
+		if err := json.Unmarshal(record.Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		events[event.Event]++
+	}
+	if events[string(constant.PrintJobEventSubmitted)] != 1 || events[string(constant.PrintJobEventCompleted)] != 0 {
+		t.Errorf("status events %v, want submitted without completed", events)
+	}
+	if events[string(constant.PrintJobEventDuplicate)] != 1 {
+		t.Errorf("status events %v, want the re-send reported duplicate", events)
+	}
+}
+
+// A faulted action may have encoded part of its RFID tags, it goes to the dead-letter topic
+// instead of being printed again
+func TestFaultedActionIsNotRetried(t *testing.T) {
+	message, err := os.ReadFile(filepath.Join("testdata", "pipeline", "01_kidvn_print.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(filepath.Join("..", ".."))
+	cfg, err := config.Load(pipelineConfigFile)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg = pipelineConfig(cfg, t.TempDir())
+	os.MkdirAll(cfg.FileSharePath, 0755)
+
+	source := NewMemoryMessageSource(pipelineTopic)
+	backend := NewMemoryPrintBackend()
+	backend.Fault = func(*BartenderPrinterJob) bool { return true }
+	producer := NewMemoryRecordProducer()
+	ks, err := NewKafkaService(nopLogger{}, cfg, WithMessageSource(source), WithPrintBackend(backend), WithProducer(producer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.Produce([]byte("MO-0001"), message, nil)
+	if err := ks.StartConsumer(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for source.Committed() < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ks.Close()
+	if source.Committed() != 1 {
+		t.Fatalf("committed offset %v, want 1", source.Committed())
+	}
+	if calls := backend.Calls(); len(calls) != 1 {
+		t.Errorf("faulted action submitted %d times, want once", len(calls))
+	}
+	if records := producer.Records(pipelineDeadLetterTopic); len(records) != 1 {
+		t.Errorf("got %d dead-letter records, want 1", len(records))
+	}
+}
+
+// Without a dead-letter topic a failed message cannot be parked, the service stops instead of
+// holding back the commits of its partition while it keeps consuming
+func TestUnparkedMessageStopsService(t *testing.T) {
+	message, err := os.ReadFile(filepath.Join("testdata", "pipeline", "01_kidvn_print.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(filepath.Join("..", ".."))
+	cfg, err := config.Load(pipelineConfigFile)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg = pipelineConfig(cfg, t.TempDir())
+	cfg.ProducerTopicInfo.TopicDeadLetter = ""
+	os.MkdirAll(cfg.FileSharePath, 0755)
+
+	source := NewMemoryMessageSource(pipelineTopic)
+	backend := NewMemoryPrintBackend()
+	ks, err := NewKafkaService(nopLogger{}, cfg, WithMessageSource(source), WithPrintBackend(backend), WithProducer(NewMemoryRecordProducer()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.Produce([]byte("MO-0001"), []byte("not json"), nil)
+	source.Produce([]byte("MO-0002"), message, nil)
+	if err := ks.StartConsumer(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ks.Done():
+	case <-time.After(10 * time.Second):
+		ks.Close()
+		t.Fatal("service still running after a message could not be parked")
+	}
+	ks.Close()
+	if ks.Err() == nil {
+		t.Error("Err = nil, want the unparked message reported")
+	}
+	if source.Committed() != kafka.OffsetInvalid {
+		t.Errorf("committed offset %v, want the failed message left uncommitted", source.Committed())
+	}
+	if calls := backend.Calls(); len(calls) != 0 {
+		t.Errorf("got %d print actions after the failure, want none", len(calls))
+	}
+}
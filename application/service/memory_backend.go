@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+)
+
+// PrintCall is an action received by the MemoryPrintBackend
+type PrintCall struct {
+	JobID        string
+	SourceOffset int64 // Offset of the message that created the job
+	Template     string
+	Printer      string
+	Filename     string
+	Copies       int
+	Payload      []byte
+	ContentType  string
+	ActionId     string
+	At           time.Time
+}
+
+// MemoryPrintBackend is an in-memory PrintBackend recording the submitted actions.
+// Actions run to completion on their first status request unless Fault says otherwise.
+type MemoryPrintBackend struct {
+	mu      sync.Mutex
+	calls   []PrintCall
+	faulted map[string]bool
+
+	// Fault decides whether the action of a job ends Faulted, nil never faults
+	Fault func(job *BartenderPrinterJob) bool
+	// SubmitError, when set, is returned by Submit instead of accepting the action
+	SubmitError func(job *BartenderPrinterJob) error
+}
+
+// NewMemoryPrintBackend creates a backend that prints everything
+func NewMemoryPrintBackend() *MemoryPrintBackend {
+	return &MemoryPrintBackend{faulted: make(map[string]bool)}
+}
+
+// Submit records the action
+func (b *MemoryPrintBackend) Submit(ctx context.Context, job *BartenderPrinterJob, payload []byte, contentType string) (*model.BartenderApIResponse, error) {
+	if b.SubmitError != nil {
+		if err := b.SubmitError(job); err != nil {
+			return nil, err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := fmt.Sprintf("memory-%d", len(b.calls)+1)
+	b.calls = append(b.calls, PrintCall{
+		JobID:        job.ID,
+		SourceOffset: job.SourceOffset,
+		Template:     job.Template,
+		Printer:      job.Printer,
+		Filename:     job.Filename,
+		Copies:       job.Copies,
+		Payload:      append([]byte(nil), payload...),
+		ContentType:  contentType,
+		ActionId:     id,
+		At:           time.Now(),
+	})
+	b.faulted[id] = b.Fault != nil && b.Fault(job)
+
+	return &model.BartenderApIResponse{
+		Id:        id,
+		Status:    string(constant.BartenderActionWaitingToRun),
+		StatusUrl: "memory://api/actions/" + id,
+	}, nil
+}
+
+// Status finishes the action
+func (b *MemoryPrintBackend) Status(ctx context.Context, statusUrl string) (*model.BartenderTrackingStatusResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	const prefix = "memory://api/actions/"
+	if len(statusUrl) <= len(prefix) {
+		return nil, errors.Errorf("unknown action %s", statusUrl)
+	}
+	id := statusUrl[len(prefix):]
+	faulted, ok := b.faulted[id]
+	if !ok {
+		return nil, &bartenderStatusError{API: "status API", StatusCode: 404, Body: "action not found"}
+	}
+
+	status := &model.BartenderTrackingStatusResponse{
+		Id:            id,
+		SubmittedTime: time.Now(),
+		Status:        string(constant.BartenderActionRanToCompletion),
+		Variables:     model.BartenderVariables{"PrintJobStatus": "Sent"},
+	}
+	if faulted {
+		status.Status = string(constant.BartenderActionFaulted)
+		status.Variables = model.BartenderVariables{"PrintJobStatus": "Failed"}
+		status.Messages = []model.BartenderMessage{{Level: "Error", Text: "simulated printer fault"}}
+	}
+	return status, nil
+}
+
+// Health always succeeds
+func (b *MemoryPrintBackend) Health(ctx context.Context) error {
+	return nil
+}
+
+// Calls returns the recorded actions in submission order
+func (b *MemoryPrintBackend) Calls() []PrintCall {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]PrintCall(nil), b.calls...)
+}
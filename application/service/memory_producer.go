@@ -0,0 +1,64 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// RecordProducer publishes the dead-letter records and the status events. *kafka.Producer
+// implements it.
+type RecordProducer interface {
+	Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error
+	Flush(timeoutMs int) int
+	Close()
+}
+
+// MemoryRecordProducer is an in-memory RecordProducer keeping the records per topic
+type MemoryRecordProducer struct {
+	mu      sync.Mutex
+	records map[string][]*kafka.Message
+
+	// Fail, when set, rejects the delivery of a record with the returned error
+	Fail func(msg *kafka.Message) error
+}
+
+// NewMemoryRecordProducer creates a producer that delivers everything
+func NewMemoryRecordProducer() *MemoryRecordProducer {
+	return &MemoryRecordProducer{records: make(map[string][]*kafka.Message)}
+}
+
+// Produce records the message and reports its delivery on deliveryChan
+func (p *MemoryRecordProducer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	delivered := *msg
+	if p.Fail != nil {
+		delivered.TopicPartition.Error = p.Fail(msg)
+	}
+	if delivered.TopicPartition.Error == nil {
+		p.mu.Lock()
+		topic := *msg.TopicPartition.Topic
+		delivered.TopicPartition.Partition = 0
+		delivered.TopicPartition.Offset = kafka.Offset(len(p.records[topic]))
+		p.records[topic] = append(p.records[topic], &delivered)
+		p.mu.Unlock()
+	}
+	if deliveryChan != nil {
+		deliveryChan <- &delivered
+	}
+	return nil
+}
+
+// Records returns the records delivered to topic
+func (p *MemoryRecordProducer) Records(topic string) []*kafka.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*kafka.Message(nil), p.records[topic]...)
+}
+
+// Flush has nothing to wait for
+func (p *MemoryRecordProducer) Flush(timeoutMs int) int {
+	return 0
+}
+
+// Close does nothing, the records stay readable
+func (p *MemoryRecordProducer) Close() {}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// MessageSource delivers the print request messages and takes the commits of the
+// offsets whose jobs finished. *kafka.Consumer implements it.
+type MessageSource interface {
+	SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+	Close() error
+}
+
+// MemoryMessageSource is an in-memory single partition MessageSource
+type MemoryMessageSource struct {
+	mu        sync.Mutex
+	topic     string
+	messages  []*kafka.Message
+	next      int
+	committed kafka.Offset
+	notify    chan struct{}
+}
+
+// NewMemoryMessageSource creates an empty source for topic
+func NewMemoryMessageSource(topic string) *MemoryMessageSource {
+	return &MemoryMessageSource{
+		topic:     topic,
+		committed: kafka.OffsetInvalid,
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+// Produce appends a message and returns its position
+func (s *MemoryMessageSource) Produce(key []byte, value []byte, headers []kafka.Header) kafka.TopicPartition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tp := kafka.TopicPartition{Topic: &s.topic, Partition: 0, Offset: kafka.Offset(len(s.messages))}
+	s.messages = append(s.messages, &kafka.Message{
+		TopicPartition: tp,
+		Key:            key,
+		Value:          value,
+		Headers:        headers,
+		Timestamp:      time.Now(),
+	})
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return tp
+}
+
+// SubscribeTopics accepts any topic, the source only has one
+func (s *MemoryMessageSource) SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error {
+	return nil
+}
+
+// ReadMessage returns the next message, or a timed out error like the Kafka consumer
+func (s *MemoryMessageSource) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		if s.next < len(s.messages) {
+			msg := s.messages[s.next]
+			s.next++
+			s.mu.Unlock()
+			return msg, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.notify:
+		case <-deadline:
+			return nil, kafka.NewError(kafka.ErrTimedOut, "no message", false)
+		}
+	}
+}
+
+// CommitOffsets records the committed offset
+func (s *MemoryMessageSource) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tp := range offsets {
+		if tp.Offset > s.committed {
+			s.committed = tp.Offset
+		}
+	}
+	return offsets, nil
+}
+
+// Committed returns the committed offset, the offset of the next message to process
+func (s *MemoryMessageSource) Committed() kafka.Offset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.committed
+}
+
+// Close does nothing, the messages stay readable
+func (s *MemoryMessageSource) Close() error {
+	return nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// partitionKey identifies a topic partition
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// partitionOffsets keeps the offsets of one partition that are still being processed
+type partitionOffsets struct {
+	// offset -> true once the message reached a terminal state (printed, dead-lettered, dropped)
+	offsets map[kafka.Offset]bool
+	// next offset to commit, kafka.OffsetInvalid until something is committable
+	commitOffset kafka.Offset
+	// true when commitOffset moved forward since the last commit
+	dirty bool
+}
+
+// offsetTracker tracks in-flight messages per partition so that an offset is only
+// committed once every message up to it reached a terminal state.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[partitionKey]*partitionOffsets),
+	}
+}
+
+// track registers a message offset as in-flight
+func (t *offsetTracker) track(tp kafka.TopicPartition) {
+	if tp.Topic == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+	p, ok := t.partitions[key]
+	if !ok {
+		p = &partitionOffsets{
+			offsets:      make(map[kafka.Offset]bool),
+			commitOffset: kafka.OffsetInvalid,
+		}
+		t.partitions[key] = p
+	}
+	if _, exists := p.offsets[tp.Offset]; !exists {
+		p.offsets[tp.Offset] = false
+	}
+}
+
+// markDone flags a message offset as terminal and advances the committable offset
+// when every lower offset of the partition is terminal too.
+func (t *offsetTracker) markDone(tp kafka.TopicPartition) {
+	if tp.Topic == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partitionKey{topic: *tp.Topic, partition: tp.Partition}]
+	if !ok {
+		// Partition was revoked in the meantime, nothing to commit
+		return
+	}
+	if _, exists := p.offsets[tp.Offset]; !exists {
+		return
+	}
+	p.offsets[tp.Offset] = true
+
+	offsets := make([]kafka.Offset, 0, len(p.offsets))
+	for o := range p.offsets {
+		offsets = append(offsets, o)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	for _, o := range offsets {
+		if !p.offsets[o] {
+			break
+		}
+		delete(p.offsets, o)
+		// Kafka expects the offset of the next message to consume
+		p.commitOffset = o + 1
+		p.dirty = true
+	}
+}
+
+// committable returns the offsets that moved forward since the last call
+func (t *offsetTracker) committable() []kafka.TopicPartition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var result []kafka.TopicPartition
+	for key, p := range t.partitions {
+		if !p.dirty {
+			continue
+		}
+		topic := key.topic
+		result = append(result, kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: key.partition,
+			Offset:    p.commitOffset,
+		})
+		p.dirty = false
+	}
+	return result
+}
+
+// restore flags offsets as dirty again after a failed commit so they are retried
+func (t *offsetTracker) restore(tps []kafka.TopicPartition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tp := range tps {
+		p, ok := t.partitions[partitionKey{topic: *tp.Topic, partition: tp.Partition}]
+		if ok && p.commitOffset == tp.Offset {
+			p.dirty = true
+		}
+	}
+}
+
+// revoke forgets partitions that are no longer assigned to this consumer
+func (t *offsetTracker) revoke(tps []kafka.TopicPartition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tp := range tps {
+		if tp.Topic == nil {
+			continue
+		}
+		delete(t.partitions, partitionKey{topic: *tp.Topic, partition: tp.Partition})
+	}
+}
+
+// pending returns the number of in-flight messages across all partitions
+func (t *offsetTracker) pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	count := 0
+	for _, p := range t.partitions {
+		for _, done := range p.offsets {
+			if !done {
+				count++
+			}
+		}
+	}
+	return count
+}
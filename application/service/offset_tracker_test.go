@@ -0,0 +1,102 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+func testPartition(topic string, partition int32, offset kafka.Offset) kafka.TopicPartition {
+	return kafka.TopicPartition{Topic: &topic, Partition: partition, Offset: offset}
+}
+
+func TestOffsetTrackerCommitsContiguousOffsets(t *testing.T) {
+	tests := []struct {
+		name   string
+		track  []kafka.Offset
+		done   []kafka.Offset
+		commit kafka.Offset // kafka.OffsetInvalid when nothing is committable
+	}{
+		{name: "nothing done", track: []kafka.Offset{0, 1, 2}, commit: kafka.OffsetInvalid},
+		{name: "in order", track: []kafka.Offset{0, 1, 2}, done: []kafka.Offset{0, 1}, commit: 2},
+		{name: "gap holds back", track: []kafka.Offset{0, 1, 2}, done: []kafka.Offset{1, 2}, commit: kafka.OffsetInvalid},
+		{name: "gap filled", track: []kafka.Offset{0, 1, 2}, done: []kafka.Offset{2, 1, 0}, commit: 3},
+		{name: "untracked offset ignored", track: []kafka.Offset{5}, done: []kafka.Offset{4}, commit: kafka.OffsetInvalid},
+		{name: "done twice", track: []kafka.Offset{7, 8}, done: []kafka.Offset{7, 7}, commit: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for _, o := range tt.track {
+				tracker.track(testPartition("orders", 0, o))
+			}
+			for _, o := range tt.done {
+				tracker.markDone(testPartition("orders", 0, o))
+			}
+
+			offsets := tracker.committable()
+			if tt.commit == kafka.OffsetInvalid {
+				if len(offsets) != 0 {
+					t.Fatalf("committable = %v, want nothing", offsets)
+				}
+				return
+			}
+			if len(offsets) != 1 || offsets[0].Offset != tt.commit {
+				t.Fatalf("committable = %v, want offset %v", offsets, tt.commit)
+			}
+			if again := tracker.committable(); len(again) != 0 {
+				t.Errorf("committable returned %v twice", again)
+			}
+		})
+	}
+}
+
+func TestOffsetTrackerPartitionsAreIndependent(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.track(testPartition("orders", 0, 10))
+	tracker.track(testPartition("orders", 1, 20))
+	tracker.track(testPartition("orders", 1, 21))
+	tracker.markDone(testPartition("orders", 1, 20))
+
+	offsets := tracker.committable()
+	if len(offsets) != 1 || offsets[0].Partition != 1 || offsets[0].Offset != 21 {
+		t.Fatalf("committable = %v, want partition 1 at 21", offsets)
+	}
+	if n := tracker.pending(); n != 2 {
+		t.Errorf("pending = %d, want 2", n)
+	}
+}
+
+func TestOffsetTrackerRestoreAfterFailedCommit(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.track(testPartition("orders", 0, 0))
+	tracker.markDone(testPartition("orders", 0, 0))
+
+	offsets := tracker.committable()
+	tracker.restore(offsets)
+	if again := tracker.committable(); len(again) != 1 || again[0].Offset != 1 {
+		t.Fatalf("committable after restore = %v, want offset 1", again)
+	}
+
+	// A restore of an offset that moved on meanwhile is stale
+	tracker.track(testPartition("orders", 0, 1))
+	tracker.markDone(testPartition("orders", 0, 1))
+	tracker.restore(offsets)
+	if again := tracker.committable(); len(again) != 1 || again[0].Offset != 2 {
+		t.Fatalf("committable = %v, want offset 2", again)
+	}
+}
+
+func TestOffsetTrackerRevoke(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.track(testPartition("orders", 0, 0))
+	tracker.revoke([]kafka.TopicPartition{testPartition("orders", 0, kafka.OffsetInvalid)})
+	tracker.markDone(testPartition("orders", 0, 0))
+
+	if offsets := tracker.committable(); len(offsets) != 0 {
+		t.Errorf("committable after revoke = %v, want nothing", offsets)
+	}
+	if n := tracker.pending(); n != 0 {
+		t.Errorf("pending after revoke = %d, want 0", n)
+	}
+}
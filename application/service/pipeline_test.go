@@ -0,0 +1,383 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/pkg/errors"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/delimited"
+	"kafka-consumer/config"
+)
+
+// Outcomes a pipeline case can expect
+const (
+	outcomePrinted   = "printed"   // one print action with the exported file
+	outcomeDuplicate = "duplicate" // already printed by an earlier case, no print action
+	outcomeRejected  = "rejected"  // invalid message, parked on the dead-letter topic
+)
+
+// Topics the cases are produced to and the service publishes to
+const (
+	pipelineTopic           = "test.bom-product-bartender"
+	pipelineDeadLetterTopic = "test.bom-product-bartender-dlq"
+	pipelineStatusTopic     = "test.bom-product-bartender-status"
+)
+
+// pipelineConfigFile holds the settings of the pipeline tests, relative to the repository root
+var pipelineConfigFile = filepath.Join("application", "service", "testdata", "pipeline", "config.yml")
+
+// pipelineCase is a message of testdata/pipeline and what the pipeline must do with it
+type pipelineCase struct {
+	name     string
+	file     string // Message in testdata/pipeline
+	key      string
+	outcome  string
+	rows     int      // Data rows of the exported file, default the number of products
+	printer  string   // Printer the job must go to, optional
+	contains []string // Text the exported file must contain, optional
+}
+
+// The cases run in order through one service, a re-send relies on the print before it
+var pipelineCases = []pipelineCase{
+	{
+		name: "kidvn prints every product", file: "01_kidvn_print.json", key: "MO-0001",
+		outcome: outcomePrinted, printer: "HASAKI-RFID", contains: []string{"KT001", "E28011700000020A1B2C3D02"},
+	},
+	{
+		name: "re-send of a printed message is skipped", file: "02_kidvn_resend.json", key: "MO-0001",
+		outcome: outcomeDuplicate,
+	},
+	{
+		name: "unknown template is rejected", file: "03_unknown_template.json", key: "MO-0002",
+		outcome: outcomeRejected,
+	},
+	{
+		name: "adultvn prints after a rejected message", file: "04_adultvn_print.json", key: "MO-0003",
+		outcome: outcomePrinted, contains: []string{"QJ010"},
+	},
+	{
+		name: "malformed message is rejected", file: "05_malformed.json", key: "MO-0004",
+		outcome: outcomeRejected,
+	},
+	{
+		name: "invalid products reject the batch", file: "06_invalid_products.json", key: "MO-0005",
+		outcome: outcomeRejected,
+	},
+	{
+		name: "size chart fills attribute and size available", file: "07_size_chart.json", key: "MO-0007",
+		outcome: outcomePrinted, contains: []string{"W/42-45 kg - H/150-155 cm", "adult_s.pdf", "adult_xl.pdf"},
+	},
+	{
+		name: "kid size 2T is printed", file: "08_kid_2t.json", key: "MO-0008",
+		outcome: outcomePrinted, contains: []string{"kids_2t.pdf"},
+	},
+	{
+		name: "vn size is converted to us and uk", file: "09_size_conversion.json", key: "MO-0009",
+		outcome: outcomePrinted, contains: []string{";M;M;10;", "adult_m.pdf"},
+	},
+	{
+		name: "sizes disagreeing across markets are rejected", file: "10_size_mismatch.json", key: "MO-0010",
+		outcome: outcomeRejected,
+	},
+	{
+		name: "delimiters and line breaks in values keep the columns", file: "11_delimited_values.json", key: "MO-0011",
+		outcome: outcomePrinted, contains: []string{
+			`"Ao khoac ""Gio""; ban dac biet"`,
+			"\"Văn phòng: Lầu 3 555 3/2; P.8\nQ.10, TP.HCM, Việt Nam\"",
+		},
+	},
+}
+
+// TestPipeline feeds the cases through parse, export and print with an in-memory message
+// source, print backend and producer, then checks the exported files, the print actions
+// and the dead letters, with the rules of testdata/pipeline/config.yml
+func TestPipeline(t *testing.T) {
+	messages := make([][]byte, len(pipelineCases))
+	for i, tc := range pipelineCases {
+		data, err := os.ReadFile(filepath.Join("testdata", "pipeline", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages[i] = data
+	}
+
+	// The size charts and conversions of the config are relative to the repository root
+	t.Chdir(filepath.Join("..", ".."))
+	cfg, err := config.Load(pipelineConfigFile)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg = pipelineConfig(cfg, t.TempDir())
+	if err := os.MkdirAll(cfg.FileSharePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	source := NewMemoryMessageSource(pipelineTopic)
+	backend := NewMemoryPrintBackend()
+	producer := NewMemoryRecordProducer()
+	ks, err := NewKafkaService(nopLogger{}, cfg, WithMessageSource(source), WithPrintBackend(backend), WithProducer(producer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offsets := make([]kafka.Offset, len(pipelineCases))
+	for i, tc := range pipelineCases {
+		offsets[i] = source.Produce([]byte(tc.key), messages[i], nil).Offset
+	}
+
+	if err := ks.StartConsumer(); err != nil {
+		ks.Close()
+		t.Fatal(err)
+	}
+
+	// Every message is committed once its job reached a terminal state
+	deadline := time.After(30 * time.Second)
+	for source.Committed() < kafka.Offset(len(pipelineCases)) {
+		select {
+		case <-deadline:
+			ks.Close()
+			t.Fatalf("committed offset %v of %d messages after 30s", source.Committed(), len(pipelineCases))
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	if err := ks.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(map[int64][]PrintCall)
+	for _, call := range backend.Calls() {
+		calls[call.SourceOffset] = append(calls[call.SourceOffset], call)
+	}
+	deadLetters := make(map[string]int)
+	for _, record := range producer.Records(pipelineDeadLetterTopic) {
+		for _, h := range record.Headers {
+			if h.Key == headerSourceOffset {
+				deadLetters[string(h.Value)]++
+			}
+		}
+	}
+
+	for i, tc := range pipelineCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parked := deadLetters[offsets[i].String()]
+			if tc.outcome == outcomeRejected && parked != 1 {
+				t.Errorf("expected 1 dead-letter record, got %d", parked)
+			}
+			if tc.outcome != outcomeRejected && parked > 0 {
+				t.Errorf("unexpected %d dead-letter records", parked)
+			}
+			checkPipelineCase(t, cfg, tc, messages[i], calls[int64(offsets[i])])
+		})
+	}
+}
+
+// pipelineConfig isolates the service in workDir, with in-memory topics and fast polling
+func pipelineConfig(cfg *config.Config, workDir string) *config.Config {
+	c := *cfg
+	c.FileSharePath = filepath.Join(workDir, "share")
+	c.IsUsedImgLocalPath = true // No image downloads
+	c.ConsumerTopicInfo.TopicBomBartenderPrinter = pipelineTopic
+	c.ProducerTopicInfo = config.ProducerTopicInfo{TopicDeadLetter: pipelineDeadLetterTopic, TopicPrintJobStatus: pipelineStatusTopic}
+	c.Kafka.CommitIntervalMs = 20
+
+	c.BartenderPrinterAPI.QueuePath = filepath.Join(workDir, "queue")
+	c.BartenderPrinterAPI.RateLimit = 1000
+	c.BartenderPrinterAPI.RetryBaseDelayMs = 10
+	c.BartenderPrinterAPI.RetryMaxDelayMs = 50
+	c.BartenderPrinterAPI.HealthCheckIntervalSeconds = 3600
+	c.BartenderTrackingScriptAPI.IsCallAPI = true
+	c.BartenderTrackingScriptAPI.PollIntervalMs = 5
+
+	c.Deduplication.Enabled = true
+	c.Deduplication.Path = filepath.Join(workDir, "dedup")
+	c.ExportRetention.Enabled = false // The exported files are checked after the run
+
+	printers := make([]config.PrinterConfig, len(cfg.Printers))
+	copy(printers, cfg.Printers)
+	for i := range printers {
+		printers[i].RateLimit = 1000
+	}
+	c.Printers = printers
+	return &c
+}
+
+// checkPipelineCase compares the print actions of a case and its exported file with the expectation
+func checkPipelineCase(t *testing.T, cfg *config.Config, tc pipelineCase, message []byte, calls []PrintCall) {
+	t.Helper()
+	if tc.outcome != outcomePrinted {
+		if len(calls) > 0 {
+			t.Errorf("expected %s, got %d print actions", tc.outcome, len(calls))
+		}
+		return
+	}
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 print action, got %d", len(calls))
+	}
+	call := calls[0]
+	if tc.printer != "" && !strings.EqualFold(call.Printer, tc.printer) {
+		t.Errorf("printed on %q, expected %q", call.Printer, tc.printer)
+	}
+	if !bytes.Contains(call.Payload, []byte(call.Filename)) {
+		t.Errorf("action payload does not reference the exported file %s", call.Filename)
+	}
+
+	data, err := os.ReadFile(filepath.Join(cfg.FileSharePath, call.Filename))
+	if err != nil {
+		t.Fatalf("exported file: %v", err)
+	}
+	template, ok := cfg.Template(call.Template)
+	if !ok {
+		t.Fatalf("printed with unknown template %q", call.Template)
+	}
+	data = decodeText(data)
+	if constant.FileType(template.ExportFormat) == constant.FileTypeXlsx {
+		if data, err = sheetText(data); err != nil {
+			t.Fatalf("exported file: %v", err)
+		}
+	}
+
+	rows, err := countRows(template, data)
+	if err != nil {
+		t.Errorf("exported file: %v", err)
+	}
+	expectedRows := tc.rows
+	if expectedRows == 0 {
+		var req struct {
+			Products []json.RawMessage `json:"products"`
+		}
+		if err := json.Unmarshal(message, &req); err == nil {
+			expectedRows = len(req.Products)
+		}
+	}
+	if rows != expectedRows {
+		t.Errorf("exported %d rows, expected %d", rows, expectedRows)
+	}
+	for _, text := range tc.contains {
+		if !bytes.Contains(data, []byte(text)) {
+			t.Errorf("exported file does not contain %q", text)
+		}
+	}
+}
+
+// countRows returns the data rows of an exported file, without the header
+func countRows(template *config.TemplateConfig, data []byte) (int, error) {
+	var records []map[string]string
+	switch constant.FileType(template.ExportFormat) {
+	case constant.FileTypeJson:
+		if err := json.Unmarshal(data, &records); err != nil {
+			return 0, err
+		}
+	case constant.FileTypeXml:
+		var set struct {
+			Records []struct {
+				Values []struct {
+					XMLName xml.Name
+					Value   string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:"Record"`
+		}
+		if err := xml.Unmarshal(data, &set); err != nil {
+			return 0, err
+		}
+		for _, r := range set.Records {
+			record := make(map[string]string)
+			for _, v := range r.Values {
+				record[v.XMLName.Local] = v.Value
+			}
+			records = append(records, record)
+		}
+	case constant.FileTypeXlsx:
+		// Every row of the sheet is an element, the first one is the header
+		return max(bytes.Count(data, []byte("<row "))-1, 0), nil
+	default:
+		return countDelimitedRows(template, data)
+	}
+	for i, record := range records {
+		if len(record) != len(template.Columns) {
+			return 0, errors.Errorf("record %d has %d columns, expected %d", i, len(record), len(template.Columns))
+		}
+	}
+	return len(records), nil
+}
+
+// countDelimitedRows returns the data rows of a delimited file, without the header
+func countDelimitedRows(template *config.TemplateConfig, data []byte) (int, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = template.ExportOptions().Delimiter
+	reader.LazyQuotes = template.Quoting == string(delimited.QuoteNever)
+	records, err := reader.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range records {
+		if len(record) != len(template.Columns) {
+			return 0, errors.Errorf("record %q has %d columns, expected %d", record, len(record), len(template.Columns))
+		}
+	}
+	return max(len(records)-1, 0), nil
+}
+
+// sheetText returns the sheet of an xlsx export, the text the cases look for
+func sheetText(data []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	f, err := archive.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// decodeText returns the exported text as UTF-8 without byte order mark
+func decodeText(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return data[3:]
+	case len(data) >= 2 && (data[0] == 0xFF && data[1] == 0xFE || data[0] == 0xFE && data[1] == 0xFF):
+		units := make([]uint16, 0, len(data)/2-1)
+		for i := 2; i+1 < len(data); i += 2 {
+			if data[0] == 0xFF {
+				units = append(units, uint16(data[i])|uint16(data[i+1])<<8)
+			} else {
+				units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+			}
+		}
+		return []byte(string(utf16.Decode(units)))
+	default:
+		return data
+	}
+}
+
+// nopLogger discards the logs of the service under test
+type nopLogger struct{}
+
+func (nopLogger) Debug(args ...interface{})                    {}
+func (nopLogger) Debugf(template string, args ...interface{})  {}
+func (nopLogger) Info(args ...interface{})                     {}
+func (nopLogger) Infof(template string, args ...interface{})   {}
+func (nopLogger) Warn(args ...interface{})                     {}
+func (nopLogger) Warnf(template string, args ...interface{})   {}
+func (nopLogger) Error(args ...interface{})                    {}
+func (nopLogger) Errorf(template string, args ...interface{})  {}
+func (nopLogger) DPanic(args ...interface{})                   {}
+func (nopLogger) DPanicf(template string, args ...interface{}) {}
+func (nopLogger) Fatal(args ...interface{})                    {}
+func (nopLogger) Fatalf(template string, args ...interface{})  {}
+func (nopLogger) SetLevel(level string) error                  { return nil }
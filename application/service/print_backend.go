@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+	"github.com/pkg/errors"
+
+	"kafka-consumer/application/logger"
+	"kafka-consumer/application/model"
+	"kafka-consumer/config"
+)
+
+// PrintBackend submits the rendered print actions to Bartender and reports their status
+type PrintBackend interface {
+	// Submit sends the action payload of the job, a nil response means Bartender accepted it without an action to track
+	Submit(ctx context.Context, job *BartenderPrinterJob, payload []byte, contentType string) (*model.BartenderApIResponse, error)
+	// Status returns the status of an action with its messages and print variables
+	Status(ctx context.Context, statusUrl string) (*model.BartenderTrackingStatusResponse, error)
+	// Health returns an error when Bartender cannot be reached
+	Health(ctx context.Context) error
+}
+
+// httpPrintBackend calls the Bartender Integration Builder REST API
+type httpPrintBackend struct {
+	logger logger.ILogger
+	cfg    func() *config.Config // Current configuration, read on every call to follow the reloads
+	client *http.Client
+}
+
+// newHTTPPrintBackend creates the backend with an NTLM client with connection pooling
+func newHTTPPrintBackend(logger logger.ILogger, cfg func() *config.Config) *httpPrintBackend {
+	// Create optimized HTTP client with connection pooling
+	transport := &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	// Wrap with NTLM authentication
+	ntlmTransport := ntlmssp.Negotiator{
+		RoundTripper: transport,
+	}
+
+	client := &http.Client{
+		Transport: ntlmTransport,
+		Timeout:   30 * time.Second, // Add timeout
+	}
+	return &httpPrintBackend{logger: logger, cfg: cfg, client: client}
+}
+
+// Submit posts the action to the Bartender Printer API
+func (b *httpPrintBackend) Submit(ctx context.Context, job *BartenderPrinterJob, payload []byte, contentType string) (*model.BartenderApIResponse, error) {
+	cfg := b.cfg()
+	url := cfg.BartenderPrinterAPI.URL
+	username := cfg.BartenderPrinterAPI.Username
+	password := cfg.BartenderPrinterAPI.Password
+
+	req, err := http.NewRequestWithContext(ctx, cfg.BartenderPrinterAPI.Method, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("accept", "application/json")
+	req.Header.Set("Content-Type", contentType)
+	req.SetBasicAuth(username, password)
+
+	// Use the optimized client with connection pooling
+	resp, err := b.client.Do(req)
+	if err != nil {
+		b.logger.Errorf("Send request to Bartender Printer API error: %v", err)
+		return nil, err
+	}
+	b.logger.Infof("Call API Printer Successfully: %s", job.Filename)
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			b.logger.Errorf("Failed to close response body: %s", err)
+		}
+	}(resp.Body)
+
+	body, _ := io.ReadAll(resp.Body)
+
+	bartenderResponse := &model.BartenderApIResponse{}
+	// Check response status
+	if resp.StatusCode >= 400 {
+		return nil, &bartenderStatusError{API: "API", StatusCode: resp.StatusCode, Body: cfg.Redact(string(body))}
+	} else {
+		b.logger.Debugf("API response: %s", cfg.Redact(string(body)))
+		// Parse the response body
+		if err := json.Unmarshal(body, &bartenderResponse); err != nil {
+			b.logger.Errorf("JSON unmarshal error at Bartender API response: %v", err)
+			return nil, errors.Wrap(err, "parse Bartender API response")
+		}
+	}
+
+	return bartenderResponse, nil
+}
+
+// Status gets the status of an action with its messages and print variables
+func (b *httpPrintBackend) Status(ctx context.Context, statusUrl string) (*model.BartenderTrackingStatusResponse, error) {
+	// http://localhost:5159/api/actions/f39f0ab2-3db8-4ad0-a56a-6f3ba94c0410?MessageCount=200&MessageSeverity=Info&Variables=PrintJobStatus%2CResponse
+	buildUrl := statusUrl + "?MessageCount=200&MessageSeverity=Info&Variables=PrintJobStatus%2CResponse"
+
+	cfg := b.cfg()
+	method := cfg.BartenderTrackingScriptAPI.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, method, buildUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	username := cfg.BartenderTrackingScriptAPI.Username
+	password := cfg.BartenderTrackingScriptAPI.Password
+	req.Header.Set("accept", "application/json")
+	req.SetBasicAuth(username, password)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			b.logger.Errorf("Failed to close response body: %s", err)
+		}
+	}(resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, &bartenderStatusError{API: "status API", StatusCode: resp.StatusCode, Body: cfg.Redact(string(body))}
+	}
+	b.logger.Debugf("API Tracking Script Response: %s", cfg.Redact(string(body)))
+
+	status := &model.BartenderTrackingStatusResponse{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return nil, errors.Wrap(err, "invalid Bartender status response")
+	}
+	return status, nil
+}
+
+// Health sends a simple request to the actions API, any response below 500 is healthy
+func (b *httpPrintBackend) Health(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cfg := b.cfg()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.BartenderPrinterAPI.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("accept", "application/json")
+	req.SetBasicAuth(cfg.BartenderPrinterAPI.Username, cfg.BartenderPrinterAPI.Password)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Consider healthy if we get any response (even error responses)
+	if resp.StatusCode >= 500 {
+		return errors.Errorf("bartender health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
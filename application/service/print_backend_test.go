@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kafka-consumer/config"
+)
+
+// The backend reads the configuration on every call, a reload reaches the next request
+func TestHTTPPrintBackendFollowsReloads(t *testing.T) {
+	var got []string // Server of each request
+	server := func(name string) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = append(got, name)
+			w.Write([]byte(`{}`))
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+	first, second := server("first"), server("second")
+
+	cfg := &config.Config{}
+	cfg.BartenderPrinterAPI.URL = first.URL
+	cfg.BartenderPrinterAPI.Method = http.MethodPost
+	b := newHTTPPrintBackend(nopLogger{}, func() *config.Config { return cfg })
+
+	job := &BartenderPrinterJob{ID: "job-1"}
+	if _, err := b.Submit(context.Background(), job, []byte(`{}`), "application/json"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := *cfg
+	reloaded.BartenderPrinterAPI.URL = second.URL
+	cfg = &reloaded
+	if _, err := b.Submit(context.Background(), job, []byte(`{}`), "application/json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"first", "second"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+)
+
+// errPrintTrackingTimeout is returned when Bartender did not finish the action in time
+var errPrintTrackingTimeout = errors.New("timed out waiting for Bartender to finish the print action")
+
+// errPrintActionFailed is returned when Bartender ended the action Faulted or Canceled
+var errPrintActionFailed = errors.New("bartender print action did not complete")
+
+// submitAndTrackPrintJob sends the job to Bartender and follows the action until the printer is done
+func (ks *KafkaService) submitAndTrackPrintJob(job *BartenderPrinterJob) error {
+	resp, err := ks.callBartenderPrinterAPI(job)
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		// Nothing tells whether the labels were printed, the job is retried like a failed call
+		return errors.Errorf("bartender returned no action for job %s", job.Filename)
+	}
+
+	job.BartenderId = resp.Id
+	job.BartenderStatusUrl = resp.StatusUrl
+	job.Status = constant.BartenderActionStatus(resp.Status)
+	ks.publishJobEvent(job, constant.PrintJobEventSubmitted, nil)
+	if job.Status == constant.BartenderActionRunning {
+		ks.publishJobEvent(job, constant.PrintJobEventRunning, nil)
+	}
+	if job.Status.IsTerminal() {
+		// Bartender ran the action before answering
+		return actionResult(job, nil)
+	}
+
+	// Without tracking the job is only handed off, processPrintJob tells it apart by its status
+	if !ks.cfg().BartenderTrackingScriptAPI.IsCallAPI {
+		return nil
+	}
+	return ks.trackPrintJob(job)
+}
+
+// trackPrintJob polls the action status until Bartender reports a terminal state or the timeout expires
+func (ks *KafkaService) trackPrintJob(job *BartenderPrinterJob) error {
+	if job.BartenderStatusUrl == "" {
+		return permanent(errors.Errorf("bartender action %s has no status url", job.BartenderId))
+	}
+
+	pollInterval := time.Duration(ks.cfg().BartenderTrackingScriptAPI.PollIntervalMs) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = time.Second // Default poll every second
+	}
+	timeout := time.Duration(ks.cfg().BartenderTrackingScriptAPI.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Minute // Default 5 minutes per print action
+	}
+
+	ctx, cancel := context.WithTimeout(ks.ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if ks.ctx.Err() != nil {
+				return ks.ctx.Err()
+			}
+			return errors.Wrapf(errPrintTrackingTimeout, "action %s still %s after %v", job.BartenderId, job.Status, timeout)
+		case <-ticker.C:
+		}
+
+		status, err := ks.callBartenderPrinterAPIStatus(ctx, job.BartenderStatusUrl)
+		if err != nil {
+			// The action keeps running on the Bartender side, keep polling until the timeout
+			ks.logger.Warnf("Failed to get status of Bartender action %s: %v", job.BartenderId, err)
+			continue
+		}
+
+		next := constant.BartenderActionStatus(status.Status)
+		if next != job.Status {
+			ks.logger.Infof("Job %s: Bartender action %s %s -> %s", job.Filename, job.BartenderId, job.Status, next)
+			job.Status = next
+			if next == constant.BartenderActionRunning {
+				ks.publishJobEvent(job, constant.PrintJobEventRunning, nil)
+			}
+		}
+
+		if next.IsTerminal() {
+			if next == constant.BartenderActionRanToCompletion {
+				ks.logger.Infof("Job %s printed, PrintJobStatus: %s", job.Filename, status.Variables["PrintJobStatus"])
+			}
+			return actionResult(job, status)
+		}
+	}
+}
+
+// actionResult returns the error of a finished action, nil when it ran to completion
+func actionResult(job *BartenderPrinterJob, status *model.BartenderTrackingStatusResponse) error {
+	if job.Status == constant.BartenderActionRanToCompletion {
+		return nil
+	}
+	details := "no details reported"
+	if status != nil {
+		details = describeTrackingFailure(status)
+	}
+	return errors.Wrapf(errPrintActionFailed, "action %s %s: %s", job.BartenderId, job.Status, details)
+}
+
+// describeTrackingFailure summarizes the variables and error messages of a failed action
+func describeTrackingFailure(status *model.BartenderTrackingStatusResponse) string {
+	var parts []string
+	if v := status.Variables["PrintJobStatus"]; v != "" {
+		parts = append(parts, "PrintJobStatus="+v)
+	}
+	if v := status.Variables["Response"]; v != "" {
+		parts = append(parts, "Response="+v)
+	}
+	for _, m := range status.Messages {
+		if strings.EqualFold(m.Level, "Error") || strings.EqualFold(m.Level, "Warning") {
+			parts = append(parts, fmt.Sprintf("[%s] %s", m.Level, m.Text))
+		}
+	}
+	if len(parts) == 0 {
+		return "no details reported"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// callBartenderPrinterAPIStatus gets the status of an action with its messages and print variables
+func (ks *KafkaService) callBartenderPrinterAPIStatus(ctx context.Context, statusUrl string) (*model.BartenderTrackingStatusResponse, error) {
+	release, err := ks.acquireAPISlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status, err := ks.backend.Status(ctx, statusUrl)
+	release()
+	if ctx.Err() == nil {
+		ks.recordBartenderResult(err)
+	}
+	return status, err
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/logger"
+	"kafka-consumer/application/model"
+	"kafka-consumer/config"
+)
+
+// printerWorker is a printer of the registry with its own queue of assigned jobs and rate limit
+type printerWorker struct {
+	name           string
+	station        string
+	limiter        *rate.Limiter
+	queue          []*BartenderPrinterJob // Assigned jobs waiting for the printer, bounded by the job queue capacity
+	inFlight       int
+	failures       int // Consecutive failed jobs
+	unhealthyUntil time.Time
+	removed        bool // Removed from the registry, the worker exits once its queue is empty
+	notify         chan struct{}
+}
+
+// errPrinterRemoved stops the worker of a printer removed from the registry
+var errPrinterRemoved = errors.New("printer removed from the registry")
+
+// load is the number of jobs assigned to the printer
+func (pw *printerWorker) load() int {
+	return len(pw.queue) + pw.inFlight
+}
+
+// healthy reports whether the printer is out of its failure cooldown
+func (pw *printerWorker) healthy(now time.Time) bool {
+	return !now.Before(pw.unhealthyUntil)
+}
+
+// signal wakes up the worker of the printer
+func (pw *printerWorker) signal() {
+	select {
+	case pw.notify <- struct{}{}:
+	default:
+	}
+}
+
+// printerPool balances the jobs over the printers able to serve them and fails over
+// when a printer keeps failing
+type printerPool struct {
+	mu               sync.Mutex
+	logger           logger.ILogger
+	printers         map[string]*printerWorker // Keyed by lower-case name
+	workers          []*printerWorker          // In registry order
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+// newPrinterPool creates a worker for every enabled printer of the registry
+func newPrinterPool(logger logger.ILogger, cfg *config.Config) *printerPool {
+	failureThreshold := cfg.BartenderPrinterAPI.PrinterFailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = 3 // Default 3 failed jobs in a row
+	}
+	cooldownSeconds := cfg.BartenderPrinterAPI.PrinterCooldownSeconds
+	if cooldownSeconds <= 0 {
+		cooldownSeconds = 60 // Default skip a failing printer for 1 minute
+	}
+
+	pool := &printerPool{
+		logger:           logger,
+		printers:         make(map[string]*printerWorker),
+		failureThreshold: failureThreshold,
+		cooldown:         time.Duration(cooldownSeconds) * time.Second,
+	}
+	for _, p := range cfg.Printers {
+		if !p.IsEnabled() {
+			continue
+		}
+		pw := newPrinterWorker(p)
+		pool.printers[strings.ToLower(p.Name)] = pw
+		pool.workers = append(pool.workers, pw)
+	}
+	return pool
+}
+
+func newPrinterWorker(p config.PrinterConfig) *printerWorker {
+	return &printerWorker{
+		name:    p.Name,
+		station: p.Station,
+		limiter: rate.NewLimiter(printerRate(p)),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// printerRate returns the rate limit of a printer and its burst
+func printerRate(p config.PrinterConfig) (rate.Limit, int) {
+	rateLimit := p.RateLimit
+	if rateLimit <= 0 {
+		rateLimit = 10 // Default 10 RPS
+	}
+	burst := rateLimit / 2 // Burst = rate/2
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.Limit(rateLimit), burst
+}
+
+// update applies the printer registry of a reloaded configuration. New printers get a worker,
+// returned to be started, and the rate limits follow the registry. The waiting jobs of removed
+// or disabled printers move to their other candidates, jobs without one are printed before
+// the worker of the removed printer exits.
+func (pool *printerPool) update(cfg *config.Config) []*printerWorker {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	enabled := make(map[string]bool)
+	var workers, added []*printerWorker
+	for _, p := range cfg.Printers {
+		if !p.IsEnabled() {
+			continue
+		}
+		key := strings.ToLower(p.Name)
+		enabled[key] = true
+		pw, ok := pool.printers[key]
+		if !ok {
+			pw = newPrinterWorker(p)
+			pool.printers[key] = pw
+			added = append(added, pw)
+		} else {
+			limit, burst := printerRate(p)
+			pw.limiter.SetLimit(limit)
+			pw.limiter.SetBurst(burst)
+			pw.station = p.Station
+		}
+		workers = append(workers, pw)
+	}
+
+	now := time.Now()
+	for _, pw := range pool.workers {
+		key := strings.ToLower(pw.name)
+		if enabled[key] {
+			continue
+		}
+		delete(pool.printers, key)
+		pw.removed = true
+		waiting := pw.queue
+		pw.queue = nil
+		for _, job := range waiting {
+			target := pool.pick(job, nil, now)
+			if target == nil {
+				target = pw
+			} else {
+				pool.logger.Infof("Moving job %s from removed printer %s to %s", job.ID, pw.name, target.name)
+			}
+			pool.enqueue(target, job)
+		}
+		pw.signal()
+	}
+	pool.workers = workers
+	return added
+}
+
+// size returns the number of printers of the registry
+func (pool *printerPool) size() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return len(pool.workers)
+}
+
+// routePrinters returns the printers that can serve the request, preferred first:
+// the printer named by the message, the printers of the station named by the message
+// or the template, else the template printer followed by the other printers of its station
+func routePrinters(cfg *config.Config, req *model.ProductPrinterMsgKafkaRequest, template *config.TemplateConfig) ([]string, error) {
+	capability := constant.PrinterCapability(template.Capability)
+
+	if req.Printer != "" {
+		p, ok := cfg.Printer(req.Printer)
+		if !ok {
+			return nil, errors.Errorf("printer %q is not registered", req.Printer)
+		}
+		if !p.IsEnabled() {
+			return nil, errors.Errorf("printer %q is disabled", p.Name)
+		}
+		if !p.HasCapability(capability) {
+			return nil, errors.Errorf("printer %q cannot print %s labels of template %s", p.Name, capability, template.Key)
+		}
+		return []string{p.Name}, nil
+	}
+
+	station := req.Station
+	if station == "" {
+		station = template.Station
+	}
+	if station != "" {
+		printers := cfg.PrintersFor(station, capability)
+		if len(printers) == 0 {
+			return nil, errors.Errorf("no enabled %s printer at station %q", capability, station)
+		}
+		names := make([]string, len(printers))
+		for i, p := range printers {
+			names[i] = p.Name
+		}
+		return names, nil
+	}
+
+	var names []string
+	if p, ok := cfg.Printer(template.Printer); ok && p.IsEnabled() && p.HasCapability(capability) {
+		names = append(names, p.Name)
+		if p.Station != "" {
+			for _, other := range cfg.PrintersFor(p.Station, capability) {
+				if other.Name != p.Name {
+					names = append(names, other.Name)
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.Errorf("printer %q of template %s is not available", template.Printer, template.Key)
+	}
+	return names, nil
+}
+
+// assign queues the job on the least loaded healthy printer among its candidates. A retried
+// job avoids the printer that failed it when another one is available. When every candidate
+// is cooling down the job waits on the one that recovers first.
+func (pool *printerPool) assign(job *BartenderPrinterJob) (*printerWorker, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pw := pool.pick(job, nil, time.Now())
+	if pw == nil {
+		return nil, errors.Errorf("none of the printers %v of job %s is available", pool.candidates(job), job.ID)
+	}
+	pool.enqueue(pw, job)
+	return pw, nil
+}
+
+// pick returns the printer the job should go to, skipping exclude
+func (pool *printerPool) pick(job *BartenderPrinterJob, exclude *printerWorker, now time.Time) *printerWorker {
+	var best, fallback *printerWorker
+	bestScore := 0
+	for _, name := range pool.candidates(job) {
+		pw, ok := pool.printers[strings.ToLower(name)]
+		if !ok || pw == exclude {
+			continue
+		}
+		if !pw.healthy(now) {
+			if fallback == nil || pw.unhealthyUntil.Before(fallback.unhealthyUntil) {
+				fallback = pw
+			}
+			continue
+		}
+		score := pw.load()
+		if job.RetryCount > 0 && strings.EqualFold(pw.name, job.Printer) {
+			score += len(pool.workers) * 1000 // Prefer any other printer for a retry
+		}
+		if best == nil || score < bestScore {
+			best, bestScore = pw, score
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return fallback
+}
+
+// candidates returns the printers the job may be printed on, jobs queued before
+// routing existed only know their printer
+func (pool *printerPool) candidates(job *BartenderPrinterJob) []string {
+	if len(job.Candidates) > 0 {
+		return job.Candidates
+	}
+	return []string{job.Printer}
+}
+
+// enqueue hands the job to the printer
+func (pool *printerPool) enqueue(pw *printerWorker, job *BartenderPrinterJob) {
+	job.Printer = pw.name
+	pw.queue = append(pw.queue, job)
+	pw.signal()
+}
+
+// next blocks until the printer is healthy and has a job, then marks the job in flight. It
+// returns errPrinterRemoved once a removed printer has no job left.
+func (pool *printerPool) next(ctx context.Context, pw *printerWorker) (*BartenderPrinterJob, error) {
+	for {
+		pool.mu.Lock()
+		wait := time.Until(pw.unhealthyUntil)
+		if wait <= 0 && len(pw.queue) > 0 {
+			job := pw.queue[0]
+			pw.queue[0] = nil
+			pw.queue = pw.queue[1:]
+			pw.inFlight++
+			pool.mu.Unlock()
+			return job, nil
+		}
+		if pw.removed && len(pw.queue) == 0 {
+			pool.mu.Unlock()
+			return nil, errPrinterRemoved
+		}
+		pool.mu.Unlock()
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-pw.notify:
+		}
+	}
+}
+
+// release frees the printer without judging it, the job failed for reasons outside the printer
+func (pool *printerPool) release(pw *printerWorker) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pw.inFlight--
+}
+
+// done records the outcome of a job on the printer. After too many failures in a row the
+// printer cools down and its waiting jobs move to the other healthy candidates.
+func (pool *printerPool) done(pw *printerWorker, err error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pw.inFlight--
+	if err == nil {
+		if pw.failures >= pool.failureThreshold {
+			pool.logger.Infof("Printer %s printed again, marked healthy", pw.name)
+		}
+		pw.failures = 0
+		return
+	}
+
+	pw.failures++
+	if pw.failures < pool.failureThreshold {
+		return
+	}
+	now := time.Now()
+	pw.unhealthyUntil = now.Add(pool.cooldown)
+	pool.logger.Warnf("Printer %s failed %d jobs in a row, skipping it for %v: %v", pw.name, pw.failures, pool.cooldown, err)
+
+	waiting := pw.queue
+	pw.queue = nil
+	for _, job := range waiting {
+		target := pool.pick(job, pw, now)
+		if target == nil || !target.healthy(now) {
+			target = pw
+		}
+		if target != pw {
+			pool.logger.Infof("Moving job %s from printer %s to %s", job.ID, pw.name, target.name)
+		}
+		pool.enqueue(target, job)
+	}
+}
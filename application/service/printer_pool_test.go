@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"kafka-consumer/config"
+)
+
+// testPrinterPool creates a pool of the printers, a printer fails over after 2 failed jobs
+func testPrinterPool(names ...string) *printerPool {
+	cfg := &config.Config{}
+	cfg.BartenderPrinterAPI.PrinterFailureThreshold = 2
+	for _, name := range names {
+		cfg.Printers = append(cfg.Printers, config.PrinterConfig{Name: name, Station: "S1"})
+	}
+	return newPrinterPool(nopLogger{}, cfg)
+}
+
+// failPrinter makes the printer fail as many jobs in a row as the threshold
+func failPrinter(pool *printerPool, name string) {
+	pw := pool.printers[name]
+	for i := 0; i < pool.failureThreshold; i++ {
+		pw.inFlight++
+		pool.done(pw, errBartenderDown)
+	}
+}
+
+func TestPrinterPoolAssign(t *testing.T) {
+	tests := []struct {
+		name       string
+		down       []string // Printers that failed their last jobs
+		busy       string   // Printer already holding a job
+		candidates []string
+		retryOn    string // Printer that failed the job before
+		want       string
+	}{
+		{name: "first candidate", candidates: []string{"a", "b"}, want: "a"},
+		{name: "least loaded", busy: "a", candidates: []string{"a", "b"}, want: "b"},
+		{name: "printer down fails over", down: []string{"a"}, candidates: []string{"a", "b"}, want: "b"},
+		{name: "down printer is skipped even when idle", down: []string{"a"}, busy: "b", candidates: []string{"a", "b"}, want: "b"},
+		{name: "every printer down waits on the first to recover", down: []string{"a", "b"}, candidates: []string{"a", "b"}, want: "a"},
+		{name: "retry avoids the failed printer", retryOn: "a", candidates: []string{"a", "b"}, want: "b"},
+		{name: "retry on the only printer", retryOn: "a", candidates: []string{"a"}, want: "a"},
+		{name: "unregistered candidate", candidates: []string{"c", "b"}, want: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := testPrinterPool("a", "b")
+			for _, name := range tt.down {
+				failPrinter(pool, name)
+			}
+			if tt.busy != "" {
+				pool.enqueue(pool.printers[tt.busy], &BartenderPrinterJob{ID: "busy"})
+			}
+			job := &BartenderPrinterJob{ID: "job", Candidates: tt.candidates}
+			if tt.retryOn != "" {
+				job.Printer, job.RetryCount = tt.retryOn, 1
+			}
+			pw, err := pool.assign(job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pw.name != tt.want || job.Printer != tt.want {
+				t.Errorf("assigned to %s (job printer %s), want %s", pw.name, job.Printer, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrinterPoolAssignWithoutPrinter(t *testing.T) {
+	pool := testPrinterPool("a")
+	if pw, err := pool.assign(&BartenderPrinterJob{ID: "job", Candidates: []string{"c"}}); err == nil {
+		t.Errorf("assigned to %s, want an error", pw.name)
+	}
+}
+
+// The waiting jobs of a printer that goes down move to its healthy peers
+func TestPrinterPoolMovesWaitingJobs(t *testing.T) {
+	pool := testPrinterPool("a", "b")
+	a, b := pool.printers["a"], pool.printers["b"]
+	pool.enqueue(a, &BartenderPrinterJob{ID: "shared", Candidates: []string{"a", "b"}})
+	pool.enqueue(a, &BartenderPrinterJob{ID: "only-a", Candidates: []string{"a"}})
+
+	// One failure stays below the threshold
+	a.inFlight++
+	pool.done(a, errors.New("paper out"))
+	if len(a.queue) != 2 {
+		t.Fatalf("printer a holds %d jobs after one failure, want 2", len(a.queue))
+	}
+
+	a.inFlight++
+	pool.done(a, errors.New("paper out"))
+	if a.healthy(a.unhealthyUntil.Add(-1)) {
+		t.Error("printer a is still healthy after reaching the threshold")
+	}
+	if len(b.queue) != 1 || b.queue[0].ID != "shared" || b.queue[0].Printer != "b" {
+		t.Errorf("printer b holds %v, want the shared job", jobIDs(b.queue))
+	}
+	if len(a.queue) != 1 || a.queue[0].ID != "only-a" {
+		t.Errorf("printer a holds %v, want the job without another candidate", jobIDs(a.queue))
+	}
+
+	// A success resets the count
+	a.inFlight++
+	pool.done(a, nil)
+	if a.failures != 0 {
+		t.Errorf("failures = %d after a success, want 0", a.failures)
+	}
+}
+
+func jobIDs(jobs []*BartenderPrinterJob) []string {
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	return ids
+}
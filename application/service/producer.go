@@ -0,0 +1,88 @@
+package service
+
+import (
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/pkg/errors"
+)
+
+// produce publishes a record and blocks until it is delivered or the delivery timeout expires
+func (ks *KafkaService) produce(topic string, key []byte, value []byte, headers []kafka.Header) error {
+	if ks.producer == nil {
+		return errors.New("kafka producer is not initialized")
+	}
+
+	deliveryChan := make(chan kafka.Event, 1)
+	err := ks.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            key,
+		Value:          value,
+		Headers:        headers,
+	}, deliveryChan)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(ks.cfg().Kafka.DeliveryTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 10 * time.Second // Default delivery timeout
+	}
+
+	select {
+	case e := <-deliveryChan:
+		m, ok := e.(*kafka.Message)
+		if !ok {
+			return errors.Errorf("unexpected delivery event: %v", e)
+		}
+		return m.TopicPartition.Error
+	case <-time.After(timeout):
+		return errors.Errorf("delivery to topic %s timed out after %v", topic, timeout)
+	}
+}
+
+// startProducer creates the Kafka producer used for dead-letter records and status events
+func (ks *KafkaService) startProducer() error {
+	if ks.producer != nil {
+		// Given with WithProducer
+		return nil
+	}
+	if ks.cfg().ProducerTopicInfo.TopicDeadLetter == "" && ks.cfg().ProducerTopicInfo.TopicPrintJobStatus == "" {
+		// Nothing to produce
+		return nil
+	}
+
+	p, err := kafka.NewProducer(newKafkaConfigMap(ks.cfg().Kafka, kafka.ConfigMap{
+		"acks": "all",
+	}))
+	if err != nil {
+		return err
+	}
+	ks.producer = p
+
+	// Drain producer-level events: broker errors and delivery reports of status events
+	go func() {
+		for e := range p.Events() {
+			switch ev := e.(type) {
+			case kafka.Error:
+				ks.logger.Errorf("Kafka producer error: %v", ev)
+			case *kafka.Message:
+				if ev.TopicPartition.Error != nil {
+					ks.logger.Errorf("Failed to deliver record to %v: %v", ev.TopicPartition, ev.TopicPartition.Error)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// closeProducer flushes outstanding records and closes the producer
+func (ks *KafkaService) closeProducer() {
+	if ks.producer == nil {
+		return
+	}
+	if remaining := ks.producer.Flush(5000); remaining > 0 {
+		ks.logger.Warnf("%d produced records were not delivered before shutdown", remaining)
+	}
+	ks.producer.Close()
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/config"
+)
+
+// bartenderStatusError is an error status returned by a Bartender endpoint
+type bartenderStatusError struct {
+	API        string
+	StatusCode int
+	Body       string
+}
+
+func (e *bartenderStatusError) Error() string {
+	return fmt.Sprintf("bartender %s returned error status: %d, body: %s", e.API, e.StatusCode, e.Body)
+}
+
+// permanentError marks an error that fails again whatever the number of retries
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent marks err as not worth retrying
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// classifyError tells whether a failed print attempt may succeed when retried
+func classifyError(err error) constant.ErrorClass {
+	var permanentErr *permanentError
+	if errors.As(err, &permanentErr) {
+		return constant.ErrorClassPermanent
+	}
+	// A timed out action may still be printing, retrying would print the labels twice
+	if errors.Is(err, errPrintTrackingTimeout) {
+		return constant.ErrorClassPermanent
+	}
+	// A faulted or canceled action may have encoded part of its RFID tags already, a retry
+	// would encode them twice
+	if errors.Is(err, errPrintActionFailed) {
+		return constant.ErrorClassPermanent
+	}
+
+	var statusErr *bartenderStatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode >= 500,
+			statusErr.StatusCode == http.StatusRequestTimeout,
+			statusErr.StatusCode == http.StatusTooManyRequests:
+			return constant.ErrorClassTransient
+		default:
+			// Bad payload, authentication or missing resource
+			return constant.ErrorClassPermanent
+		}
+	}
+
+	// Network errors and timeouts: Bartender or the printer may be back on the next attempt
+	return constant.ErrorClassTransient
+}
+
+// retryPolicy computes capped exponential backoff with jitter
+type retryPolicy struct {
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	jitter    float64 // Fraction of the delay randomized, 0.2 = ±20%
+}
+
+// newRetryPolicy reads the retry settings of bartender_printer_api
+func newRetryPolicy(cfg *config.BartenderPrinterAPIConfig) *retryPolicy {
+	baseDelay := time.Duration(cfg.RetryBaseDelayMs) * time.Millisecond
+	if baseDelay <= 0 {
+		baseDelay = 2 * time.Second // Default first retry after 2 seconds
+	}
+	maxDelay := time.Duration(cfg.RetryMaxDelayMs) * time.Millisecond
+	if maxDelay <= 0 {
+		maxDelay = time.Minute // Default never wait more than 1 minute
+	}
+	if maxDelay < baseDelay {
+		maxDelay = baseDelay
+	}
+	jitter := cfg.RetryJitter
+	if jitter <= 0 || jitter > 1 {
+		jitter = 0.2 // Default ±20%
+	}
+	return &retryPolicy{baseDelay: baseDelay, maxDelay: maxDelay, jitter: jitter}
+}
+
+// backoff returns the delay before the given retry, starting at 1
+func (p *retryPolicy) backoff(retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+	delay := float64(p.baseDelay) * math.Pow(2, float64(retry-1))
+	if delay > float64(p.maxDelay) {
+		delay = float64(p.maxDelay)
+	}
+	// Spread the retries so that jobs failed by the same outage do not come back together
+	delay *= 1 + p.jitter*(2*rand.Float64()-1)
+	return time.Duration(delay)
+}
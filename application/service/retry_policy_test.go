@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/config"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want constant.ErrorClass
+	}{
+		{name: "network error", err: errors.New("connection refused"), want: constant.ErrorClassTransient},
+		{name: "canceled", err: context.DeadlineExceeded, want: constant.ErrorClassTransient},
+		{name: "server error", err: &bartenderStatusError{API: "print", StatusCode: http.StatusBadGateway}, want: constant.ErrorClassTransient},
+		{name: "request timeout", err: &bartenderStatusError{API: "print", StatusCode: http.StatusRequestTimeout}, want: constant.ErrorClassTransient},
+		{name: "too many requests", err: &bartenderStatusError{API: "print", StatusCode: http.StatusTooManyRequests}, want: constant.ErrorClassTransient},
+		{name: "bad request", err: &bartenderStatusError{API: "print", StatusCode: http.StatusBadRequest}, want: constant.ErrorClassPermanent},
+		{name: "unauthorized", err: &bartenderStatusError{API: "print", StatusCode: http.StatusUnauthorized}, want: constant.ErrorClassPermanent},
+		{name: "wrapped status", err: errors.Wrap(&bartenderStatusError{API: "print", StatusCode: http.StatusNotFound}, "submit"), want: constant.ErrorClassPermanent},
+		{name: "marked permanent", err: permanent(errors.New("template not found")), want: constant.ErrorClassPermanent},
+		{name: "tracking timeout", err: errors.Wrap(errPrintTrackingTimeout, "job 1"), want: constant.ErrorClassPermanent},
+		{name: "faulted action", err: errors.Wrap(errPrintActionFailed, "action 1 Faulted"), want: constant.ErrorClassPermanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRetryPolicyDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.BartenderPrinterAPIConfig
+		want retryPolicy
+	}{
+		{name: "unset", want: retryPolicy{baseDelay: 2 * time.Second, maxDelay: time.Minute, jitter: 0.2}},
+		{name: "configured", cfg: config.BartenderPrinterAPIConfig{RetryBaseDelayMs: 500, RetryMaxDelayMs: 8000, RetryJitter: 0.5},
+			want: retryPolicy{baseDelay: 500 * time.Millisecond, maxDelay: 8 * time.Second, jitter: 0.5}},
+		{name: "max below base", cfg: config.BartenderPrinterAPIConfig{RetryBaseDelayMs: 5000, RetryMaxDelayMs: 1000},
+			want: retryPolicy{baseDelay: 5 * time.Second, maxDelay: 5 * time.Second, jitter: 0.2}},
+		{name: "jitter out of range", cfg: config.BartenderPrinterAPIConfig{RetryJitter: 3},
+			want: retryPolicy{baseDelay: 2 * time.Second, maxDelay: time.Minute, jitter: 0.2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRetryPolicy(&tt.cfg); *got != tt.want {
+				t.Errorf("newRetryPolicy = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &retryPolicy{baseDelay: time.Second, maxDelay: 10 * time.Second, jitter: 0.2}
+	tests := []struct {
+		retry int
+		want  time.Duration // Delay before the jitter
+	}{
+		{retry: 0, want: time.Second},
+		{retry: 1, want: time.Second},
+		{retry: 2, want: 2 * time.Second},
+		{retry: 4, want: 8 * time.Second},
+		{retry: 5, want: 10 * time.Second},
+		{retry: 50, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		low, high := time.Duration(float64(tt.want)*0.8), time.Duration(float64(tt.want)*1.2)
+		for i := 0; i < 100; i++ {
+			if got := p.backoff(tt.retry); got < low || got > high {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.retry, got, low, high)
+			}
+		}
+	}
+}
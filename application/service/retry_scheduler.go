@@ -0,0 +1,105 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// scheduledRetry is a job waiting for its retry time
+type scheduledRetry struct {
+	at  time.Time
+	job *BartenderPrinterJob
+}
+
+// retryHeap orders the scheduled retries by time
+type retryHeap []*scheduledRetry
+
+func (h retryHeap) Len() int           { return len(h) }
+func (h retryHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h retryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *retryHeap) Push(x any)        { *h = append(*h, x.(*scheduledRetry)) }
+func (h *retryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// retryScheduler requeues the jobs when their backoff expires, from a single timer.
+// Scheduled jobs stay leased in the job queue so a restart resumes them right away.
+type retryScheduler struct {
+	mu     sync.Mutex
+	items  retryHeap
+	wakeup chan struct{}
+}
+
+func newRetryScheduler() *retryScheduler {
+	return &retryScheduler{wakeup: make(chan struct{}, 1)}
+}
+
+// schedule requeues the job after delay
+func (rs *retryScheduler) schedule(job *BartenderPrinterJob, delay time.Duration) {
+	rs.mu.Lock()
+	heap.Push(&rs.items, &scheduledRetry{at: time.Now().Add(delay), job: job})
+	rs.mu.Unlock()
+
+	select {
+	case rs.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of scheduled retries
+func (rs *retryScheduler) Len() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.items.Len()
+}
+
+// run hands every due job to requeue until ctx is done. A job that cannot be requeued
+// is returned with the delay to try again after.
+func (rs *retryScheduler) run(ctx context.Context, requeue func(job *BartenderPrinterJob) (time.Duration, bool)) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		rs.mu.Lock()
+		var due []*scheduledRetry
+		now := time.Now()
+		for rs.items.Len() > 0 && !rs.items[0].at.After(now) {
+			due = append(due, heap.Pop(&rs.items).(*scheduledRetry))
+		}
+		wait := time.Hour
+		if rs.items.Len() > 0 {
+			wait = time.Until(rs.items[0].at)
+		}
+		rs.mu.Unlock()
+
+		for _, item := range due {
+			if delay, ok := requeue(item.job); !ok {
+				rs.schedule(item.job, delay)
+			}
+		}
+		if len(due) > 0 {
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-rs.wakeup:
+		case <-timer.C:
+		}
+	}
+}
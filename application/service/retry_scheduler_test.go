@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// runScheduler runs rs until the test ends, the requeued job ids are sent to the returned channel
+func runScheduler(t *testing.T, rs *retryScheduler, requeue func(job *BartenderPrinterJob) (time.Duration, bool)) <-chan string {
+	t.Helper()
+	requeued := make(chan string, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rs.run(ctx, func(job *BartenderPrinterJob) (time.Duration, bool) {
+			delay, ok := requeue(job)
+			if ok {
+				requeued <- job.ID
+			}
+			return delay, ok
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return requeued
+}
+
+func receive(t *testing.T, requeued <-chan string) string {
+	t.Helper()
+	select {
+	case id := <-requeued:
+		return id
+	case <-time.After(time.Second):
+		t.Fatal("no job was requeued")
+		return ""
+	}
+}
+
+func TestRetrySchedulerOrdersByTime(t *testing.T) {
+	rs := newRetryScheduler()
+	rs.schedule(&BartenderPrinterJob{ID: "late"}, 80*time.Millisecond)
+	rs.schedule(&BartenderPrinterJob{ID: "early"}, 20*time.Millisecond)
+	rs.schedule(&BartenderPrinterJob{ID: "middle"}, 50*time.Millisecond)
+	if rs.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", rs.Len())
+	}
+
+	start := time.Now()
+	requeued := runScheduler(t, rs, func(*BartenderPrinterJob) (time.Duration, bool) { return 0, true })
+	for _, want := range []string{"early", "middle", "late"} {
+		if id := receive(t, requeued); id != want {
+			t.Errorf("requeued %s, want %s", id, want)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("jobs requeued after %v, before their backoff", elapsed)
+	}
+	if rs.Len() != 0 {
+		t.Errorf("Len after the requeues = %d, want 0", rs.Len())
+	}
+}
+
+func TestRetrySchedulerWakesForEarlierJob(t *testing.T) {
+	rs := newRetryScheduler()
+	rs.schedule(&BartenderPrinterJob{ID: "later"}, time.Hour)
+	requeued := runScheduler(t, rs, func(*BartenderPrinterJob) (time.Duration, bool) { return 0, true })
+
+	// The run loop sleeps until the hour is over unless the new job wakes it
+	time.Sleep(10 * time.Millisecond)
+	rs.schedule(&BartenderPrinterJob{ID: "sooner"}, 10*time.Millisecond)
+	if id := receive(t, requeued); id != "sooner" {
+		t.Errorf("requeued %s, want sooner", id)
+	}
+}
+
+func TestRetrySchedulerReschedulesRefusedJob(t *testing.T) {
+	rs := newRetryScheduler()
+	rs.schedule(&BartenderPrinterJob{ID: "a"}, 0)
+
+	attempts := 0
+	requeued := runScheduler(t, rs, func(*BartenderPrinterJob) (time.Duration, bool) {
+		attempts++
+		// The job queue is full on the first attempt
+		return 20 * time.Millisecond, attempts > 1
+	})
+	if id := receive(t, requeued); id != "a" {
+		t.Errorf("requeued %s, want a", id)
+	}
+	if attempts != 2 {
+		t.Errorf("requeue attempts = %d, want 2", attempts)
+	}
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"kafka-consumer/application/model"
+)
+
+// convertSizes fills the missing us_size, vn_size and uk_size from the size conversion table.
+// Products whose sizes disagree are left untouched, the validation flags them.
+func (ks *KafkaService) convertSizes(products []*model.Product) {
+	for _, p := range products {
+		if p == nil {
+			continue
+		}
+		row, err := ks.cfg().MatchSizes(p)
+		if err != nil || row == nil {
+			continue
+		}
+		if p.USSize == "" {
+			p.USSize = row.US
+		}
+		if p.VNSize == "" {
+			p.VNSize = row.VN
+		}
+		if p.UKSize == "" {
+			p.UKSize = row.UK
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+)
+
+// headerCorrelationID lets BOM pass its own correlation key with the print request
+const headerCorrelationID = "correlation_id"
+
+// correlationKey picks the key that identifies the print request on the BOM side:
+// the correlation_id header, the manufacture order id, the message key, then the Kafka position
+func correlationKey(msg *kafka.Message, req *model.ProductPrinterMsgKafkaRequest) string {
+	for _, h := range msg.Headers {
+		if h.Key == headerCorrelationID && len(h.Value) > 0 {
+			return string(h.Value)
+		}
+	}
+	if req != nil && req.OrderId != "" {
+		return req.OrderId
+	}
+	if len(msg.Key) > 0 {
+		return string(msg.Key)
+	}
+
+	topic := ""
+	if msg.TopicPartition.Topic != nil {
+		topic = *msg.TopicPartition.Topic
+	}
+	return topic + "-" + strconv.Itoa(int(msg.TopicPartition.Partition)) + "-" + strconv.FormatInt(int64(msg.TopicPartition.Offset), 10)
+}
+
+// publishJobEvent publishes a lifecycle event of a print job
+func (ks *KafkaService) publishJobEvent(job *BartenderPrinterJob, eventType constant.PrintJobEventType, cause error) {
+	event := &model.PrintJobStatusEvent{
+		CorrelationKey:     job.CorrelationKey,
+		OrderId:            job.OrderId,
+		JobId:              job.ID,
+		Event:              string(eventType),
+		Template:           job.Template,
+		Quantity:           job.Quantity,
+		Filename:           job.Filename,
+		Printer:            job.Printer,
+		BartenderId:        job.BartenderId,
+		BartenderStatus:    string(job.Status),
+		BartenderStatusUrl: job.BartenderStatusUrl,
+		RetryCount:         job.RetryCount,
+		InvalidProducts:    job.InvalidProducts,
+		DuplicateRfids:     job.DuplicateRfids,
+		Timestamp:          time.Now(),
+	}
+	if cause != nil {
+		event.Error = cause.Error()
+	}
+	ks.publishStatusEvent(event)
+}
+
+// publishMessageEvent publishes an event for a message that could not be turned into a print job
+func (ks *KafkaService) publishMessageEvent(msg *kafka.Message, eventType constant.PrintJobEventType, cause error) {
+	event := &model.PrintJobStatusEvent{
+		CorrelationKey: correlationKey(msg, nil),
+		Event:          string(eventType),
+		Timestamp:      time.Now(),
+	}
+	if cause != nil {
+		event.Error = cause.Error()
+	}
+	ks.publishStatusEvent(event)
+}
+
+// publishStatusEvent sends the event to the status topic without waiting for the delivery report,
+// status events are informative and must never hold back printing
+func (ks *KafkaService) publishStatusEvent(event *model.PrintJobStatusEvent) {
+	topic := ks.cfg().ProducerTopicInfo.TopicPrintJobStatus
+	if topic == "" || ks.producer == nil {
+		return
+	}
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		ks.logger.Errorf("Failed to marshal print job status event: %v", err)
+		return
+	}
+
+	err = ks.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            []byte(event.CorrelationKey),
+		Value:          value,
+	}, nil)
+	if err != nil {
+		ks.logger.Errorf("Failed to publish %s event for %s: %v", event.Event, event.CorrelationKey, err)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+	"kafka-consumer/config"
+)
+
+func TestCorrelationKey(t *testing.T) {
+	topic := "local.bom-product-bartender"
+	tests := []struct {
+		name    string
+		headers []kafka.Header
+		key     string
+		orderId string
+		want    string
+	}{
+		{name: "correlation header", headers: []kafka.Header{{Key: headerCorrelationID, Value: []byte("req-7")}}, key: "MO-0001", orderId: "MO-0002", want: "req-7"},
+		{name: "empty header", headers: []kafka.Header{{Key: headerCorrelationID}}, key: "MO-0001", orderId: "MO-0002", want: "MO-0002"},
+		{name: "order id", key: "MO-0001", orderId: "MO-0002", want: "MO-0002"},
+		{name: "message key", key: "MO-0001", want: "MO-0001"},
+		{name: "kafka position", want: "local.bom-product-bartender-1-42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 42},
+				Headers:        tt.headers,
+				Key:            []byte(tt.key),
+			}
+			if got := correlationKey(msg, &model.ProductPrinterMsgKafkaRequest{OrderId: tt.orderId}); got != tt.want {
+				t.Errorf("correlationKey = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Status events are keyed by the correlation key, a rejected event is dropped without an error
+func TestPublishJobEvent(t *testing.T) {
+	producer := NewMemoryRecordProducer()
+	cfg := &config.Config{}
+	cfg.ProducerTopicInfo.TopicPrintJobStatus = "status"
+	ks := &KafkaService{logger: nopLogger{}, ctx: context.Background(), producer: producer}
+	ks.config.Store(cfg)
+	job := &BartenderPrinterJob{
+		ID:             "local.bom-product-bartender-0-42",
+		CorrelationKey: "MO-0001",
+		OrderId:        "MO-0001",
+		Template:       "kidvn",
+		Quantity:       120,
+		Status:         constant.BartenderActionWaitingToRun,
+	}
+
+	ks.publishJobEvent(job, constant.PrintJobEventSubmitted, nil)
+	ks.publishJobEvent(job, constant.PrintJobEventFailed, errors.New("printer offline"))
+	producer.Fail = func(msg *kafka.Message) error { return errors.New("broker unavailable") }
+	ks.publishJobEvent(job, constant.PrintJobEventCompleted, nil)
+
+	records := producer.Records("status")
+	if len(records) != 2 {
+		t.Fatalf("got %d status events, want 2", len(records))
+	}
+	for i, want := range []struct{ event, err string }{{"submitted", ""}, {"failed", "printer offline"}} {
+		var event model.PrintJobStatusEvent
+		if err := json.Unmarshal(records[i].Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		if string(records[i].Key) != "MO-0001" || event.Event != want.event || event.Error != want.err {
+			t.Errorf("event %d = %s %s %q, want MO-0001 %s %q", i, records[i].Key, event.Event, event.Error, want.event, want.err)
+		}
+		if event.JobId != job.ID || event.Quantity != 120 || event.BartenderStatus != "WaitingToRun" {
+			t.Errorf("event %d = %+v", i, event)
+		}
+	}
+}
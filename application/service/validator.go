@@ -0,0 +1,211 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+	"kafka-consumer/config"
+)
+
+// validationError rejects a print request, it holds every rule broken by its products
+type validationError struct {
+	Errors []model.ProductError
+}
+
+func (e *validationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, pe := range e.Errors {
+		parts = append(parts, fmt.Sprintf("product %d: %s", pe.Index, pe.Message))
+	}
+	return fmt.Sprintf("%d invalid products: %s", countProducts(e.Errors), strings.Join(parts, "; "))
+}
+
+// countProducts returns the number of distinct products in errs
+func countProducts(errs []model.ProductError) int {
+	seen := make(map[int]bool)
+	for _, pe := range errs {
+		seen[pe.Index] = true
+	}
+	return len(seen)
+}
+
+// productValidator checks the products of a template against its validation rules
+type productValidator struct {
+	rules    config.ValidationRules
+	config   *config.Config // Size charts
+	market   string
+	enums    map[string]map[string]bool
+	patterns map[string]*regexp.Regexp
+	// Fields of the enum, pattern and max length rules, sorted so errors come in a stable order
+	enumFields, patternFields, lengthFields []string
+}
+
+// newProductValidator compiles the rules, they were checked when the configuration was loaded
+func newProductValidator(cfg *config.Config, template *config.TemplateConfig) (*productValidator, error) {
+	rules := template.Validation
+	v := &productValidator{
+		rules:    rules,
+		config:   cfg,
+		market:   template.Market,
+		enums:    make(map[string]map[string]bool),
+		patterns: make(map[string]*regexp.Regexp),
+	}
+	for field, values := range rules.Enums {
+		allowed := make(map[string]bool, len(values))
+		for _, value := range values {
+			allowed[strings.ToLower(value)] = true
+		}
+		v.enums[field] = allowed
+	}
+	for field, pattern := range rules.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of %s: %w", field, err)
+		}
+		v.patterns[field] = re
+	}
+	v.enumFields = sortedKeys(rules.Enums)
+	v.patternFields = sortedKeys(rules.Patterns)
+	v.lengthFields = sortedKeys(rules.MaxLengths)
+	return v, nil
+}
+
+// validate splits the products into the valid ones and the errors of the invalid ones
+func (v *productValidator) validate(products []*model.Product) ([]*model.Product, []model.ProductError) {
+	valid := make([]*model.Product, 0, len(products))
+	var errs []model.ProductError
+	for i, p := range products {
+		if p == nil {
+			errs = append(errs, model.ProductError{Index: i, Rule: string(constant.ValidationRuleRequired), Message: "product is null"})
+			continue
+		}
+		productErrs := v.validateProduct(i, p)
+		if len(productErrs) == 0 {
+			valid = append(valid, p)
+		}
+		errs = append(errs, productErrs...)
+	}
+	return valid, errs
+}
+
+// validateProduct returns every rule broken by the product at index i
+func (v *productValidator) validateProduct(i int, p *model.Product) []model.ProductError {
+	var errs []model.ProductError
+	fail := func(field string, rule constant.ValidationRule, format string, args ...any) {
+		errs = append(errs, model.ProductError{
+			Index:       i,
+			Code:        p.Code,
+			RfidBarcode: p.RfidBarcode,
+			Field:       field,
+			Rule:        string(rule),
+			Message:     field + ": " + fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, field := range v.rules.Required {
+		if value, _ := p.FieldValue(field); strings.TrimSpace(value) == "" {
+			fail(field, constant.ValidationRuleRequired, "is required")
+		}
+	}
+	for _, field := range v.enumFields {
+		value, _ := p.FieldValue(field)
+		if value != "" && !v.enums[field][strings.ToLower(strings.TrimSpace(value))] {
+			fail(field, constant.ValidationRuleEnum, "%q is not one of %s", value, strings.Join(v.rules.Enums[field], ", "))
+		}
+	}
+	for _, field := range v.patternFields {
+		re := v.patterns[field]
+		value, _ := p.FieldValue(field)
+		if value != "" && !re.MatchString(value) {
+			fail(field, constant.ValidationRulePattern, "%q does not match %s", value, re.String())
+		}
+	}
+	for _, field := range v.lengthFields {
+		maxLength := v.rules.MaxLengths[field]
+		value, _ := p.FieldValue(field)
+		if n := utf8.RuneCountInString(value); n > maxLength {
+			fail(field, constant.ValidationRuleMaxLength, "%d characters, at most %d fit on the label", n, maxLength)
+		}
+	}
+	if v.rules.CheckSizeMismatch() {
+		if _, err := v.config.MatchSizes(p); err != nil {
+			fail("size", constant.ValidationRuleSizeMismatch, "%v", err)
+		}
+	}
+	if v.rules.CheckSizeChart() {
+		size := v.config.SizeOf(p)
+		if _, ok := v.config.SizeChart(v.market, p.Gender, size); !ok {
+			// Genders without a chart are left to the gender rule
+			if sizes := v.config.Sizes(v.market, p.Gender); len(sizes) > 0 {
+				fail(v.config.SizeCharts.SizeField, constant.ValidationRuleSizeChart, "%q is not a %s size, expected one of %s", size, strings.ToLower(p.Gender), strings.Join(sizes, ", "))
+			}
+		}
+	}
+	return errs
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// productValidators caches the compiled validators of the templates
+type productValidators struct {
+	mu         sync.Mutex
+	validators map[string]*productValidator
+}
+
+func (pv *productValidators) get(cfg *config.Config, template *config.TemplateConfig) (*productValidator, error) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if v, ok := pv.validators[template.Key]; ok {
+		return v, nil
+	}
+	v, err := newProductValidator(cfg, template)
+	if err != nil {
+		return nil, err
+	}
+	if pv.validators == nil {
+		pv.validators = make(map[string]*productValidator)
+	}
+	pv.validators[template.Key] = v
+	return v, nil
+}
+
+// reset drops the compiled validators, the templates changed
+func (pv *productValidators) reset() {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+	pv.validators = nil
+}
+
+// validateProducts applies the validation policy of the template to the products of the request.
+// It returns the products to print, or an error when the request is rejected.
+func (ks *KafkaService) validateProducts(job *BartenderPrinterJob, template *config.TemplateConfig, products []*model.Product) ([]*model.Product, error) {
+	v, err := ks.validators.get(ks.cfg(), template)
+	if err != nil {
+		return nil, err
+	}
+	valid, errs := v.validate(products)
+	if len(errs) == 0 {
+		return valid, nil
+	}
+
+	job.InvalidProducts = errs
+	if constant.ValidationPolicy(template.Validation.Policy) == constant.ValidationPolicyDropInvalid && len(valid) > 0 {
+		ks.logger.Warnf("Dropped %d of %d products of message %s: %v", len(products)-len(valid), len(products), job.ID, &validationError{Errors: errs})
+		return valid, nil
+	}
+	return nil, &validationError{Errors: errs}
+}
@@ -0,0 +1,384 @@
+package simulator
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"gopkg.in/yaml.v3"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+)
+
+// Auth schemes the simulator can require
+const (
+	AuthNone  = "none"
+	AuthBasic = "basic"
+	AuthNTLM  = "ntlm"
+)
+
+// Config tunes how the simulated Bartender behaves
+type Config struct {
+	Latency       time.Duration // Added to every response
+	LatencyJitter time.Duration // Random extra latency, up to this
+	QueueDelay    time.Duration // Time an action stays WaitingToRun
+	RunDuration   time.Duration // Time an action stays Running
+	FailureRate   float64       // Share of POST /api/actions answered with 500
+	FaultRate     float64       // Share of actions ending Faulted instead of RanToCompletion
+	Auth          string        // none, basic or ntlm
+	Username      string
+	Password      string // Checked for basic auth, NTLM only checks the user name
+	KeepStatus    time.Duration
+}
+
+// action is a print action submitted to the simulator
+type action struct {
+	id          string
+	submittedAt time.Time
+	submittedBy string
+	printer     string
+	document    string
+	copies      int
+	faulted     bool
+}
+
+// Server is an in-memory Bartender Integration Builder exposing the actions API
+type Server struct {
+	cfg    Config
+	logger *log.Logger
+
+	mu      sync.Mutex
+	actions map[string]*action
+}
+
+// New creates a simulator
+func New(cfg Config, logger *log.Logger) *Server {
+	if cfg.Auth == "" {
+		cfg.Auth = AuthNone
+	}
+	if cfg.KeepStatus <= 0 {
+		cfg.KeepStatus = time.Hour // Bartender keeps action statuses for 60 minutes by default
+	}
+	return &Server{cfg: cfg, logger: logger, actions: make(map[string]*action)}
+}
+
+// Handler returns the HTTP handler of the actions API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/actions", s.submitAction)
+	mux.HandleFunc("GET /api/actions", s.listActions)
+	mux.HandleFunc("GET /api/actions/{id}", s.actionStatus)
+	return s.withAuth(mux)
+}
+
+// submitAction accepts a YAML or JSON action group with a PrintBTWAction
+func (s *Server) submitAction(w http.ResponseWriter, r *http.Request) {
+	s.delay()
+	if s.cfg.FailureRate > 0 && mathrand.Float64() < s.cfg.FailureRate {
+		s.logger.Printf("POST /api/actions: simulated failure")
+		http.Error(w, "simulated Bartender failure", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request := &model.BartenderActionRequest{}
+	if strings.Contains(r.Header.Get("Content-Type"), "json") {
+		err = json.Unmarshal(body, request)
+	} else {
+		err = yaml.Unmarshal(body, request)
+	}
+	if err != nil {
+		http.Error(w, "invalid action payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var print *model.PrintBTWAction
+	for _, a := range request.ActionGroup.Actions {
+		if a.PrintBTWAction != nil {
+			print = a.PrintBTWAction
+		}
+	}
+	if print == nil || print.DocumentFile == "" {
+		http.Error(w, "invalid action payload: no PrintBTWAction with a DocumentFile", http.StatusBadRequest)
+		return
+	}
+
+	a := &action{
+		id:          newActionID(),
+		submittedAt: time.Now(),
+		submittedBy: s.cfg.Username,
+		printer:     print.Printer,
+		document:    print.DocumentFile,
+		copies:      print.Copies,
+		faulted:     s.cfg.FaultRate > 0 && mathrand.Float64() < s.cfg.FaultRate,
+	}
+	s.mu.Lock()
+	s.purge(a.submittedAt)
+	s.actions[a.id] = a
+	s.mu.Unlock()
+	s.logger.Printf("POST /api/actions: action %s prints %s on %s (%d copies)", a.id, a.document, a.printer, a.copies)
+
+	writeJSON(w, model.BartenderApIResponse{
+		Id:        a.id,
+		Status:    string(constant.BartenderActionWaitingToRun),
+		StatusUrl: statusURL(r, a.id),
+	})
+}
+
+// actionStatus reports the status of an action, WaitingToRun → Running → RanToCompletion or Faulted
+func (s *Server) actionStatus(w http.ResponseWriter, r *http.Request) {
+	s.delay()
+
+	s.mu.Lock()
+	a, ok := s.actions[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "action not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, s.status(a, time.Now()))
+}
+
+// listActions lists the known actions, also answers the health check of the service
+func (s *Server) listActions(w http.ResponseWriter, r *http.Request) {
+	s.delay()
+
+	now := time.Now()
+	s.mu.Lock()
+	s.purge(now)
+	statuses := make([]model.BartenderApIResponse, 0, len(s.actions))
+	for _, a := range s.actions {
+		statuses = append(statuses, model.BartenderApIResponse{
+			Id:        a.id,
+			Status:    s.status(a, now).Status,
+			StatusUrl: statusURL(r, a.id),
+		})
+	}
+	s.mu.Unlock()
+	writeJSON(w, statuses)
+}
+
+// statusResponse is the status body with the variables as Bartender lists them
+type statusResponse struct {
+	KeepStatusMinutes float64                  `json:"KeepStatusMinutes"`
+	Id                string                   `json:"Id"`
+	SubmittedBy       string                   `json:"SubmittedBy"`
+	SubmittedTime     time.Time                `json:"SubmittedTime"`
+	Status            string                   `json:"Status"`
+	Variables         []statusVariable         `json:"Variables,omitempty"`
+	Messages          []model.BartenderMessage `json:"Messages,omitempty"`
+}
+
+type statusVariable struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+// status derives the status of an action from the time elapsed since it was submitted
+func (s *Server) status(a *action, now time.Time) *statusResponse {
+	resp := &statusResponse{
+		KeepStatusMinutes: s.cfg.KeepStatus.Minutes(),
+		Id:                a.id,
+		SubmittedBy:       a.submittedBy,
+		SubmittedTime:     a.submittedAt,
+	}
+
+	elapsed := now.Sub(a.submittedAt)
+	switch {
+	case elapsed < s.cfg.QueueDelay:
+		resp.Status = string(constant.BartenderActionWaitingToRun)
+	case elapsed < s.cfg.QueueDelay+s.cfg.RunDuration:
+		resp.Status = string(constant.BartenderActionRunning)
+	case a.faulted:
+		resp.Status = string(constant.BartenderActionFaulted)
+		resp.Variables = []statusVariable{
+			{Name: "PrintJobStatus", Value: "Failed"},
+			{Name: "Response", Value: fmt.Sprintf("Printer '%s' is not responding", a.printer)},
+		}
+		resp.Messages = []model.BartenderMessage{{
+			ActionName: "PrintBTWAction",
+			Category:   "Print",
+			Level:      "Error",
+			Text:       fmt.Sprintf("Printer '%s' is not responding. The print job for '%s' was not sent.", a.printer, a.document),
+			Time:       now.Format(time.RFC3339Nano),
+		}}
+	default:
+		resp.Status = string(constant.BartenderActionRanToCompletion)
+		resp.Variables = []statusVariable{
+			{Name: "PrintJobStatus", Value: "Sent"},
+			{Name: "Response", Value: fmt.Sprintf("%d copies of '%s' sent to '%s'", a.copies, a.document, a.printer)},
+		}
+		resp.Messages = []model.BartenderMessage{{
+			ActionName: "PrintBTWAction",
+			Category:   "Print",
+			Level:      "Info",
+			Text:       fmt.Sprintf("The print job for '%s' was sent to '%s'.", a.document, a.printer),
+			Time:       now.Format(time.RFC3339Nano),
+		}}
+	}
+	return resp
+}
+
+// purge forgets the actions older than the keep status window, the caller holds the lock
+func (s *Server) purge(now time.Time) {
+	for id, a := range s.actions {
+		if now.Sub(a.submittedAt) > s.cfg.KeepStatus {
+			delete(s.actions, id)
+		}
+	}
+}
+
+// delay sleeps for the configured latency
+func (s *Server) delay() {
+	d := s.cfg.Latency
+	if s.cfg.LatencyJitter > 0 {
+		d += time.Duration(mathrand.Int63n(int64(s.cfg.LatencyJitter)))
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// withAuth challenges the requests according to the auth scheme
+func (s *Server) withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch s.cfg.Auth {
+		case AuthBasic:
+			user, password, ok := r.BasicAuth()
+			if !ok || user != s.cfg.Username || password != s.cfg.Password {
+				w.Header().Set("WWW-Authenticate", `Basic realm="BarTender"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		case AuthNTLM:
+			if !s.ntlmHandshake(w, r) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ntlmHandshake answers the negotiate message with a challenge and accepts an authenticate
+// message for the configured user. The NTLMv2 response itself is not verified.
+func (s *Server) ntlmHandshake(w http.ResponseWriter, r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	token, found := strings.CutPrefix(header, "NTLM ")
+	if !found {
+		w.Header().Set("WWW-Authenticate", "NTLM")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	message, err := base64.StdEncoding.DecodeString(token)
+	if err != nil || len(message) < 12 || string(message[:8]) != "NTLMSSP\x00" {
+		http.Error(w, "invalid NTLM message", http.StatusBadRequest)
+		return false
+	}
+
+	switch binary.LittleEndian.Uint32(message[8:12]) {
+	case 1:
+		w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(ntlmChallenge()))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	case 3:
+		user, err := ntlmUserName(message)
+		if err != nil || (s.cfg.Username != "" && !strings.EqualFold(user, ntlmUser(s.cfg.Username))) {
+			s.logger.Printf("NTLM authentication rejected for user %q", user)
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	default:
+		http.Error(w, "unexpected NTLM message", http.StatusBadRequest)
+		return false
+	}
+}
+
+// ntlmChallenge builds a CHALLENGE_MESSAGE with an empty target info
+func ntlmChallenge() []byte {
+	const (
+		negotiateUnicode    = 0x00000001
+		negotiateNTLM       = 0x00000200
+		negotiateTargetInfo = 0x00800000
+		headerLen           = 48
+	)
+	targetInfo := []byte{0, 0, 0, 0} // MsvAvEOL
+
+	msg := make([]byte, headerLen+len(targetInfo))
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	// Empty target name
+	binary.LittleEndian.PutUint32(msg[16:], headerLen)
+	binary.LittleEndian.PutUint32(msg[20:], negotiateUnicode|negotiateNTLM|negotiateTargetInfo)
+	rand.Read(msg[24:32])
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], headerLen)
+	copy(msg[headerLen:], targetInfo)
+	return msg
+}
+
+// ntlmUserName reads the user name of an AUTHENTICATE_MESSAGE
+func ntlmUserName(message []byte) (string, error) {
+	if len(message) < 44 {
+		return "", fmt.Errorf("authenticate message too short")
+	}
+	length := int(binary.LittleEndian.Uint16(message[36:]))
+	offset := int(binary.LittleEndian.Uint32(message[40:]))
+	if offset+length > len(message) || length%2 != 0 {
+		return "", fmt.Errorf("invalid user name field")
+	}
+	units := make([]uint16, length/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(message[offset+2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// ntlmUser strips the domain of DOMAIN\user as the client does
+func ntlmUser(username string) string {
+	if i := strings.LastIndex(username, `\`); i >= 0 {
+		return username[i+1:]
+	}
+	return username
+}
+
+// statusURL is the status url of an action as seen by the caller
+func statusURL(r *http.Request, id string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/api/actions/" + id
+}
+
+// newActionID returns a random id formatted like a GUID
+func newActionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,152 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+)
+
+const testAction = `ActionGroup:
+  Actions:
+    - PrintBTWAction:
+        DocumentFile: "D:\\hsk-bar\\kidvn.btw"
+        Printer: "HASAKI-RFID"
+        Copies: 2
+`
+
+func newTestServer(t *testing.T, cfg Config) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(New(cfg, log.New(io.Discard, "", 0)).Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// submit posts the action as the Bartender client does, through the NTLM negotiator
+func submit(t *testing.T, url, username, password, body string) (*http.Response, model.BartenderApIResponse) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url+"/api/actions", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	client := &http.Client{Transport: ntlmssp.Negotiator{RoundTripper: &http.Transport{}}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var accepted model.BartenderApIResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&accepted); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp, accepted
+}
+
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		username string
+		password string
+		want     int
+	}{
+		{name: "no auth", want: http.StatusOK},
+		{name: "basic", cfg: Config{Auth: AuthBasic, Username: "printer", Password: "secret"}, username: "printer", password: "secret", want: http.StatusOK},
+		{name: "basic wrong password", cfg: Config{Auth: AuthBasic, Username: "printer", Password: "secret"}, username: "printer", password: "other", want: http.StatusUnauthorized},
+		{name: "basic without credentials", cfg: Config{Auth: AuthBasic, Username: "printer", Password: "secret"}, want: http.StatusUnauthorized},
+		{name: "ntlm handshake", cfg: Config{Auth: AuthNTLM, Username: `HSK\printer`}, username: `HSK\printer`, password: "secret", want: http.StatusOK},
+		{name: "ntlm user without domain", cfg: Config{Auth: AuthNTLM, Username: `HSK\printer`}, username: "printer", password: "secret", want: http.StatusOK},
+		{name: "ntlm wrong user", cfg: Config{Auth: AuthNTLM, Username: `HSK\printer`}, username: `HSK\someone`, password: "secret", want: http.StatusUnauthorized},
+		{name: "ntlm without credentials", cfg: Config{Auth: AuthNTLM, Username: `HSK\printer`}, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.cfg)
+			resp, accepted := submit(t, server.URL, tt.username, tt.password, testAction)
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusOK && accepted.Id == "" {
+				t.Error("accepted action has no id")
+			}
+		})
+	}
+}
+
+func TestActionLifecycle(t *testing.T) {
+	tests := []struct {
+		name      string
+		faultRate float64
+		final     constant.BartenderActionStatus
+	}{
+		{name: "printed", final: constant.BartenderActionRanToCompletion},
+		{name: "faulted", faultRate: 1, final: constant.BartenderActionFaulted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, Config{QueueDelay: 50 * time.Millisecond, FaultRate: tt.faultRate})
+			_, accepted := submit(t, server.URL, "", "", testAction)
+			if accepted.Status != string(constant.BartenderActionWaitingToRun) {
+				t.Errorf("submitted action is %s, want WaitingToRun", accepted.Status)
+			}
+			if status := actionStatus(t, accepted.StatusUrl); status.Status != string(constant.BartenderActionWaitingToRun) {
+				t.Errorf("queued action is %s, want WaitingToRun", status.Status)
+			}
+
+			time.Sleep(60 * time.Millisecond)
+			status := actionStatus(t, accepted.StatusUrl)
+			if status.Status != string(tt.final) {
+				t.Errorf("finished action is %s, want %s", status.Status, tt.final)
+			}
+			if len(status.Messages) == 0 || len(status.Variables) == 0 {
+				t.Error("finished action has no messages or variables")
+			}
+		})
+	}
+}
+
+func TestInvalidAction(t *testing.T) {
+	server := newTestServer(t, Config{})
+	for _, body := range []string{"ActionGroup: [", "ActionGroup:\n  Actions: []\n"} {
+		if resp, _ := submit(t, server.URL, "", "", body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("payload %q answered %d, want 400", body, resp.StatusCode)
+		}
+	}
+	resp, err := http.Get(server.URL + "/api/actions/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown action answered %d, want 404", resp.StatusCode)
+	}
+}
+
+func actionStatus(t *testing.T, url string) statusResponse {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status statusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
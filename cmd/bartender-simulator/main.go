@@ -0,0 +1,74 @@
+// Command bartender-simulator runs a mock Bartender Integration Builder so the whole
+// print pipeline can be exercised without a Windows Bartender host.
+//
+//	go run ./cmd/bartender-simulator -addr :5159 -run-duration 3s -fault-rate 0.1
+//
+// Point bartender_printer_api.url at http://127.0.0.1:5159/api/actions.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"kafka-consumer/application/simulator"
+)
+
+func main() {
+	addr := flag.String("addr", ":5159", "listen address")
+	latency := flag.Duration("latency", 50*time.Millisecond, "latency added to every response")
+	latencyJitter := flag.Duration("latency-jitter", 50*time.Millisecond, "random extra latency, up to this")
+	queueDelay := flag.Duration("queue-delay", 500*time.Millisecond, "time an action stays WaitingToRun")
+	runDuration := flag.Duration("run-duration", 2*time.Second, "time an action stays Running")
+	failureRate := flag.Float64("failure-rate", 0, "share of submissions answered with 500, 0..1")
+	faultRate := flag.Float64("fault-rate", 0, "share of actions ending Faulted, 0..1")
+	auth := flag.String("auth", simulator.AuthNone, "authentication challenge: none, basic or ntlm")
+	username := flag.String("username", "", "expected user name")
+	password := flag.String("password", "", "expected password, basic auth only")
+	keepStatus := flag.Duration("keep-status", time.Hour, "how long action statuses are kept")
+	flag.Parse()
+
+	switch *auth {
+	case simulator.AuthNone, simulator.AuthBasic, simulator.AuthNTLM:
+	default:
+		log.Fatalf("unknown auth %q, expected none, basic or ntlm", *auth)
+	}
+
+	logger := log.New(os.Stdout, "[bartender-simulator] ", log.LstdFlags|log.Lmicroseconds)
+	sim := simulator.New(simulator.Config{
+		Latency:       *latency,
+		LatencyJitter: *latencyJitter,
+		QueueDelay:    *queueDelay,
+		RunDuration:   *runDuration,
+		FailureRate:   *failureRate,
+		FaultRate:     *faultRate,
+		Auth:          *auth,
+		Username:      *username,
+		Password:      *password,
+		KeepStatus:    *keepStatus,
+	}, logger)
+
+	server := &http.Server{Addr: *addr, Handler: sim.Handler()}
+	go func() {
+		logger.Printf("Listening on %s, auth: %s", *addr, *auth)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	<-signalChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Printf("Shutdown error: %v", err)
+	}
+}
@@ -5,96 +5,205 @@ import (
 	"kafka-consumer/application/logger"
 	"os"
 	"path/filepath"
-
-	"gopkg.in/yaml.v3"
 )
 
 type ConsumerTopicInfo struct {
 	TopicBomBartenderPrinter string `yaml:"topic_bom_bartender_printer"`
 }
 
+type ProducerTopicInfo struct {
+	TopicDeadLetter     string `yaml:"topic_dead_letter"`      // Empty stops the consumer at the first failed message, redelivered after a restart
+	TopicPrintJobStatus string `yaml:"topic_print_job_status"` // Empty disables the print job status events
+}
+
 type KafkaConfig struct {
-	BootstrapServers string `yaml:"bootstrap_servers"`
-	GroupID          string `yaml:"group_id"`
-	AutoOffsetReset  string `yaml:"auto_offset_reset"`
+	BootstrapServers  string `yaml:"bootstrap_servers"`
+	GroupID           string `yaml:"group_id"`
+	AutoOffsetReset   string `yaml:"auto_offset_reset"`
+	CommitIntervalMs  int    `yaml:"commit_interval_ms"`  // How often finished offsets are committed, default 1000
+	DeliveryTimeoutMs int    `yaml:"delivery_timeout_ms"` // How long to wait for a produced record to be acknowledged, default 10000
+
+	// Security of the consumer and producer connections
+	SecurityProtocol       string `yaml:"security_protocol"` // plaintext (default), ssl, sasl_plaintext or sasl_ssl
+	SaslMechanism          string `yaml:"sasl_mechanism"`    // PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512
+	SaslUsername           string `yaml:"sasl_username"`     // Required by the sasl_* protocols
+	SaslPassword           string `yaml:"sasl_password" secret:"true"`
+	SslCaLocation          string `yaml:"ssl_ca_location"`          // CA certificates of the brokers, default the system store
+	SslCertificateLocation string `yaml:"ssl_certificate_location"` // Client certificate when the brokers require mutual TLS
+	SslKeyLocation         string `yaml:"ssl_key_location"`         // Key of the client certificate
+	SslKeyPassword         string `yaml:"ssl_key_password" secret:"true"`
+
+	// Extra librdkafka properties, e.g. socket.timeout.ms, applied over every other setting
+	Properties map[string]string `yaml:"properties" secret:"true"`
 }
 
 type BartenderPrinterAPIConfig struct {
 	IsCallAPI      bool   `yaml:"is_call_api"`
 	Method         string `yaml:"method"`
 	URL            string `yaml:"url"`
-	Username       string `yaml:"username"`
-	Password       string `yaml:"password"`
+	Username       string `yaml:"username"` // Default bartender_credentials
+	Password       string `yaml:"password" secret:"true"`
 	MaxRetries     int    `yaml:"max_retries"`
 	RateLimit      int    `yaml:"rate_limit"`
-	WorkerCount    int    `yaml:"worker_count"`
+	WorkerCount    int    `yaml:"worker_count"` // Parallel mode: max concurrent API calls across printers, default 1 per printer
 	QueueSize      int    `yaml:"queue_size"`
+	QueuePath      string `yaml:"queue_path"`      // Directory of the persistent job queue, default <file_share_path>/.queue
 	SequentialMode bool   `yaml:"sequential_mode"` // true: only 1 API call at a time, false: parallel mode
+
+	// Finished jobs of the queue are remembered to commit their redelivered messages without printing
+	CompletedRetentionHours int `yaml:"completed_retention_hours"` // Default 24
+
+	// Retry backoff of transient failures, capped exponential with jitter
+	RetryBaseDelayMs int     `yaml:"retry_base_delay_ms"` // Delay before the first retry, doubled on every retry, default 2000
+	RetryMaxDelayMs  int     `yaml:"retry_max_delay_ms"`  // Default 60000
+	RetryJitter      float64 `yaml:"retry_jitter"`        // Fraction of the delay randomized, default 0.2
+
+	// Printer failover, a printer failing this many jobs in a row is skipped during the cooldown
+	PrinterFailureThreshold int `yaml:"printer_failure_threshold"` // Default 3
+	PrinterCooldownSeconds  int `yaml:"printer_cooldown_seconds"`  // Default 60
+
+	// Circuit breaker, workers pause after this many consecutive Bartender failures
+	CircuitFailureThreshold    int `yaml:"circuit_failure_threshold"`     // Default 5
+	CircuitOpenSeconds         int `yaml:"circuit_open_seconds"`          // Wait before probing Bartender again, default 30
+	HealthCheckIntervalSeconds int `yaml:"health_check_interval_seconds"` // Default 30
+
+	// Action payload, templates can override the format and the template file
+	RootPath           string `yaml:"root_path"`            // Bartender folder holding the templates, default D:\hsk-bar
+	DataPath           string `yaml:"data_path"`            // Bartender view of file_share_path, default <root_path>\data
+	PayloadFormat      string `yaml:"payload_format"`       // yaml (default) or json
+	ActionTemplateFile string `yaml:"action_template_file"` // Optional text/template rendering the action payload
 }
 
 type BartenderTrackingScriptAPI struct {
-	IsCallAPI bool   `yaml:"is_call_api"`
-	Method    string `yaml:"method"`
-	URL       string `yaml:"url"`
-	Username  string `yaml:"username"`
-	Password  string `yaml:"password"`
+	IsCallAPI      bool   `yaml:"is_call_api"` // true: poll the action status until the printer is done, false: the outcome stays unknown
+	Method         string `yaml:"method"`
+	URL            string `yaml:"url"`
+	Username       string `yaml:"username"` // Default bartender_credentials
+	Password       string `yaml:"password" secret:"true"`
+	PollIntervalMs int    `yaml:"poll_interval_ms"` // Delay between two status requests, default 1000
+	TimeoutSeconds int    `yaml:"timeout_seconds"`  // Give up waiting for the printer after this, default 300
+}
+
+type DeduplicationConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Path           string `yaml:"path"`            // Directory of the deduplication store, default <file_share_path>/.dedup
+	RetentionHours int    `yaml:"retention_hours"` // How long printed messages and RFIDs are remembered, default 72
+	MessageKey     string `yaml:"message_key"`     // message_id (default, falls back to content hash), order_id or content_hash
+}
+
+type ImageCacheConfig struct {
+	Path              string `yaml:"path"`               // Directory of the cached images, default <file_share_path>/.images
+	MaxSizeMB         int    `yaml:"max_size_mb"`        // Disk limit, least recently used images are evicted first, default 200
+	MemorySizeMB      int    `yaml:"memory_size_mb"`     // Images kept in memory, default 32
+	MaxImageSizeMB    int    `yaml:"max_image_size_mb"`  // Larger images are refused, default 5
+	RevalidateSeconds int    `yaml:"revalidate_seconds"` // Cached images are used without an ETag check for this long, default 300
+	TimeoutSeconds    int    `yaml:"timeout_seconds"`    // Download timeout, default 10
+	PreSync           bool   `yaml:"pre_sync"`           // Download the size chart images to file_size_available_path at start
+}
+
+type ExportRetentionConfig struct {
+	Enabled           bool   `yaml:"enabled"`
+	Action            string `yaml:"action"`               // delete (default) or archive, applied to completed exports past max_age_hours
+	ArchivePath       string `yaml:"archive_path"`         // Directory of the archived exports, default <file_share_path>/.archive
+	MaxAgeHours       int    `yaml:"max_age_hours"`        // Completed exports are kept this long, default 24
+	MaxSizeMB         int    `yaml:"max_size_mb"`          // Cap of the exports and the archive, oldest completed files are deleted first, default 500
+	MinAgeMinutes     int    `yaml:"min_age_minutes"`      // Completed exports younger than this are spared by the size cap, default 60
+	ArchiveMaxAgeDays int    `yaml:"archive_max_age_days"` // Archived exports are deleted after this, default 30
+	IntervalMinutes   int    `yaml:"interval_minutes"`     // Delay between two sweeps, default 10
+}
+
+// CredentialsConfig is a user of the Bartender REST API. The password may be given as
+// ${env:NAME}, ${file:path} or an enc: value of -encrypt-secret.
+type CredentialsConfig struct {
+	Username string `yaml:"username"` // DOMAIN\user for NTLM
+	Password string `yaml:"password" secret:"true"`
+}
+
+type ConfigReloadConfig struct {
+	Enabled               bool `yaml:"enabled"`                  // Watch the config files, SIGHUP reloads them in any case
+	IntervalSeconds       int  `yaml:"interval_seconds"`         // How often the files are checked for changes, default 5
+	RestartOnUnsafeChange bool `yaml:"restart_on_unsafe_change"` // Restart the consumer to apply settings that cannot change live
 }
 
 type Config struct {
 	Kafka                      KafkaConfig                `yaml:"kafka"`
 	ConsumerTopicInfo          ConsumerTopicInfo          `yaml:"consumer_topic_info"`
+	ProducerTopicInfo          ProducerTopicInfo          `yaml:"producer_topic_info"`
 	BartenderPrinterAPI        BartenderPrinterAPIConfig  `yaml:"bartender_printer_api"`
 	BartenderTrackingScriptAPI BartenderTrackingScriptAPI `yaml:"bartender_tracking_status"`
+	BartenderCredentials       CredentialsConfig          `yaml:"bartender_credentials"` // Shared by the API sections without their own
+	SecretKeyFile              string                     `yaml:"secret_key_file"`       // Key of the enc: values, default secret.key next to the config files
+	Deduplication              DeduplicationConfig        `yaml:"deduplication"`
 	FileSharePath              string                     `yaml:"file_share_path"`
 	FileSizeAvailablePath      string                     `yaml:"file_size_available_path"`
 	IsUsedImgLocalPath         bool                       `yaml:"is_used_img_local_path"`
+	ExportRetention            ExportRetentionConfig      `yaml:"export_retention"` // Cleanup of the exported files once their job completed
+	ImageCache                 ImageCacheConfig           `yaml:"image_cache"`
+	SizeCharts                 SizeChartConfig            `yaml:"size_charts"`      // Attribute and SizeAvailable per market, gender and size
+	SizeConversions            SizeConversionConfig       `yaml:"size_conversions"` // Equivalent US, VN and UK sizes per gender and category
+	Validation                 ValidationRules            `yaml:"validation"`       // Default product checks, templates extend them
+	Templates                  []TemplateConfig           `yaml:"templates"`
+	Printers                   []PrinterConfig            `yaml:"printers"`
 	Logger                     logger.ConfigLogger        `yaml:"logger"`
+	ConfigReload               ConfigReloadConfig         `yaml:"config_reload"` // Live reload of the safe settings
+
+	files        []string // Files the configuration was loaded from
+	overrides    []string // Environment variables and -set paths applied over the files
+	source       string   // The files joined, named by the validation errors
+	loadProblems []string // Problems found while applying the defaults, reported by Validate
+	secrets      []string // Resolved secret values, redacted from the logs
 }
 
 func loadConfig(path string) (*Config, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
-			fmt.Printf("Error closing file: %v\n", err)
-		}
-	}(f)
-
 	var cfg Config
-	decoder := yaml.NewDecoder(f)
-	if err := decoder.Decode(&cfg); err != nil {
+	if err := decodeFile(path, &cfg); err != nil {
 		return nil, err
 	}
+	cfg.files = []string{path}
+	cfg.finish(path, os.LookupEnv)
+	if problems := cfg.settingProblems(); len(problems) > 0 {
+		return nil, &ValidationError{Source: path, Problems: problems}
+	}
 	return &cfg, nil
 }
 
-func GetConfigByEnv() (*Config, string, error) {
-	//env := os.Getenv("ENV")
-	env := "production" // Default to production for testing purposes
+// finish applies the defaults to the settings loaded from source, the secret references are
+// resolved with the variables of lookupEnv
+func (cfg *Config) finish(source string, lookupEnv func(string) (string, bool)) {
+	cfg.source = source
+	problems := cfg.resolveSecrets(lookupEnv)
+	cfg.applyCredentialDefaults()
+	cfg.applyTemplateDefaults()
+	cfg.applyPrinterDefaults()
+	cfg.applyValidationDefaults()
+	cfg.loadProblems = append(problems, cfg.applySizeChartDefaults()...)
+	cfg.loadProblems = append(cfg.loadProblems, cfg.applySizeConversionDefaults()...)
+}
 
-	fmt.Printf("Environment: %s\n", env)
+// Load reads the configuration file at path and validates the settings, the files and
+// directories it names are only checked by Validate
+func Load(path string) (*Config, error) {
+	return loadConfig(path)
+}
 
-	cfgFile := "config.yml"
-	if env == "production" {
-		cfgFile = "config_prod.yml"
-	} else if env == "qa" {
-		cfgFile = "config_qa.yml"
+// Files returns the files the configuration was read from, the YAML layers in order then
+// the size chart and size conversion files
+func (c *Config) Files() []string {
+	files := append([]string(nil), c.files...)
+	for _, file := range []string{c.SizeCharts.File, c.SizeConversions.File} {
+		if file != "" {
+			files = append(files, file)
+		}
 	}
-	//configPath := filepath.Join(getConfigPath(), "config", cfgFile)
-
-	configPath := filepath.Join("config/", cfgFile)
-	fmt.Printf("Config path: %s\n", configPath)
+	return files
+}
 
-	cfg, err := loadConfig(configPath)
-	if err != nil {
-		return nil, "", err
-	}
-	return cfg, env, nil
+// Overrides returns the environment variables and -set settings applied over the files
+func (c *Config) Overrides() []string {
+	return append([]string(nil), c.overrides...)
 }
 
+// getConfigPath returns the directory of the executable, its config directory is searched first
 func getConfigPath() string {
 	exePath, err := os.Executable()
 	if err != nil {
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnv is the environment used without -env or ENV, set per build with
+// -ldflags "-X kafka-consumer/config.DefaultEnv=qa"
+var DefaultEnv = EnvProduction
+
+const (
+	EnvDevelopment = "development"
+	EnvQa          = "qa"
+	EnvProduction  = "production"
+
+	// baseConfigFile holds the settings shared by every environment
+	baseConfigFile = "config.yml"
+)
+
+// envAliases are the spellings of the environments accepted by -env and ENV
+var envAliases = map[string]string{
+	"dev":   EnvDevelopment,
+	"local": EnvDevelopment,
+	"prod":  EnvProduction,
+}
+
+// envConfigFiles are the environment files layered over config.yml
+var envConfigFiles = map[string]string{
+	EnvDevelopment: "",
+	EnvQa:          "config_qa.yml",
+	EnvProduction:  "config_prod.yml",
+}
+
+// Options select the configuration files and the overrides applied on top of them
+type Options struct {
+	Env       string   // development, qa, production or the name of a config_<env>.yml, default ENV then DefaultEnv
+	Path      string   // Single configuration file replacing config.yml and the environment file
+	Dir       string   // Directory of the files, default config/ next to the executable then in the working directory
+	Overrides []string // path=value pairs applied last, e.g. kafka.group_id=printer-2
+	Environ   []string // KEY=value pairs, default os.Environ()
+}
+
+// GetConfigByEnv loads config.yml, the file of the environment over it, then the KAFKA_* and
+// BARTENDER_* environment variables and the overrides, and validates the result. It returns
+// the environment name, the files and overrides are reported by Files and Overrides.
+func GetConfigByEnv(opts Options) (*Config, string, error) {
+	environ := opts.Environ
+	if environ == nil {
+		environ = os.Environ()
+	}
+	variables := make(map[string]string)
+	for _, kv := range environ {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			variables[key] = value
+		}
+	}
+
+	env := selectEnv(opts.Env, variables["ENV"])
+	paths, root, err := configFiles(env, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var cfg Config
+	for _, path := range paths {
+		if err := decodeFile(path, &cfg); err != nil {
+			return nil, "", fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	applied, err := cfg.applyOverrides(variables, opts.Overrides)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg.files = paths
+	cfg.overrides = applied
+	cfg.resolvePaths(root)
+	cfg.finish(strings.Join(paths, ", "), func(name string) (string, bool) {
+		value, ok := variables[name]
+		return value, ok
+	})
+	if err := cfg.Validate(); err != nil {
+		return nil, "", err
+	}
+	return &cfg, env, nil
+}
+
+// selectEnv returns the environment of -env, else of ENV, else DefaultEnv
+func selectEnv(flag, variable string) string {
+	env := flag
+	if env == "" {
+		env = variable
+	}
+	if env == "" {
+		env = DefaultEnv
+	}
+	env = strings.ToLower(strings.TrimSpace(env))
+	if alias, ok := envAliases[env]; ok {
+		env = alias
+	}
+	return env
+}
+
+// SecretKeyPath returns the default key file of the encrypted settings, next to the config
+// files the options select. A secret_key_file setting is not read.
+func SecretKeyPath(opts Options) (string, error) {
+	paths, _, err := configFiles(selectEnv(opts.Env, os.Getenv("ENV")), opts)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(paths[len(paths)-1]), DefaultSecretKeyFile), nil
+}
+
+// configFiles returns the files to layer, in order, and the application directory holding
+// their config directory
+func configFiles(env string, opts Options) ([]string, string, error) {
+	if opts.Path != "" {
+		return []string{opts.Path}, "", nil
+	}
+
+	envFile, known := envConfigFiles[env]
+	if !known {
+		envFile = "config_" + env + ".yml"
+	}
+	var names []string
+	for _, name := range []string{baseConfigFile, envFile} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	dirs := []string{opts.Dir}
+	if opts.Dir == "" {
+		dirs = []string{filepath.Join(getConfigPath(), "config"), "config"}
+	}
+	for _, dir := range dirs {
+		var paths []string
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		if envFile != "" && paths[len(paths)-1] != filepath.Join(dir, envFile) {
+			return nil, "", fmt.Errorf("unknown environment %q, %s not found in %s", env, envFile, dir)
+		}
+		return paths, filepath.Dir(dir), nil
+	}
+	return nil, "", fmt.Errorf("no %s found in %s", strings.Join(names, " or "), strings.Join(dirs, " or "))
+}
+
+// resolvePaths makes the relative data files of the settings relative to root, the
+// directory of the executable when its config directory was used
+func (c *Config) resolvePaths(root string) {
+	if root == "" {
+		return
+	}
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(root, *path)
+		}
+	}
+	resolve(&c.SizeCharts.File)
+	resolve(&c.SizeConversions.File)
+	resolve(&c.BartenderPrinterAPI.ActionTemplateFile)
+	resolve(&c.SecretKeyFile)
+	resolve(&c.Kafka.SslCaLocation)
+	resolve(&c.Kafka.SslCertificateLocation)
+	resolve(&c.Kafka.SslKeyLocation)
+	for i := range c.Templates {
+		resolve(&c.Templates[i].ActionTemplateFile)
+	}
+}
+
+// decodeFile decodes the file over cfg, keys missing from the file keep their value
+func decodeFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := yaml.NewDecoder(f).Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// EnvName returns the environment variable overriding the setting at a dotted yaml path, the
+// settings outside the kafka and bartender_* sections take the BARTENDER_ prefix
+func EnvName(path string) string {
+	name := strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+	if !strings.HasPrefix(name, "KAFKA_") && !strings.HasPrefix(name, "BARTENDER_") {
+		name = "BARTENDER_" + name
+	}
+	return name
+}
+
+// Settings returns the dotted yaml path of every setting that can be overridden, sorted
+func Settings() []string {
+	fields := make(map[string]reflect.Value)
+	settableFields(reflect.ValueOf(&Config{}).Elem(), "", fields)
+	return sortedPaths(fields)
+}
+
+func sortedPaths(fields map[string]reflect.Value) []string {
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// applyOverrides sets the fields named by the environment variables, then the path=value
+// overrides. Empty variables are ignored. It returns the names of the applied overrides.
+func (c *Config) applyOverrides(variables map[string]string, overrides []string) ([]string, error) {
+	fields := make(map[string]reflect.Value)
+	settableFields(reflect.ValueOf(c).Elem(), "", fields)
+
+	var applied, problems []string
+	for _, path := range sortedPaths(fields) {
+		name := EnvName(path)
+		value := variables[name]
+		if value == "" {
+			continue
+		}
+		if err := setField(fields[path], value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		applied = append(applied, name)
+	}
+	for _, override := range overrides {
+		path, value, ok := strings.Cut(override, "=")
+		path = strings.ToLower(strings.TrimSpace(path))
+		field, known := fields[path]
+		if !ok || !known {
+			problems = append(problems, fmt.Sprintf("override %q: expected <setting>=<value> with a setting such as kafka.group_id", override))
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			problems = append(problems, fmt.Sprintf("override %s: %v", path, err))
+			continue
+		}
+		applied = append(applied, path)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid config overrides:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return applied, nil
+}
+
+// settableFields collects the fields of v by dotted yaml path, nested structs are walked
+// and lists or maps are set as a whole
+func settableFields(v reflect.Value, prefix string, fields map[string]reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := yamlName(sf)
+		if !ok {
+			continue
+		}
+		path := prefix + name
+		if sf.Type.Kind() == reflect.Struct {
+			settableFields(v.Field(i), path+".", fields)
+			continue
+		}
+		fields[path] = v.Field(i)
+	}
+}
+
+// yamlName returns the yaml key of a struct field, false for fields yaml skips
+func yamlName(sf reflect.StructField) (string, bool) {
+	if !sf.IsExported() {
+		return "", false
+	}
+	name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = strings.ToLower(sf.Name)
+	}
+	return name, true
+}
+
+// setField parses value as YAML into the field, strings are taken verbatim and a list of
+// strings may be given comma separated
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		items := strings.Split(value, ",")
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+		field.Set(reflect.ValueOf(items).Convert(field.Type()))
+		return nil
+	}
+	target := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(value), target.Interface()); err != nil {
+		return err
+	}
+	field.Set(target.Elem())
+	return nil
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// baseConfig is the smallest config.yml that validates once file_share_path is set
+const baseConfig = `kafka:
+  bootstrap_servers: localhost:9092
+  group_id: printer
+consumer_topic_info:
+  topic_bom_bartender_printer: bom
+bartender_printer_api:
+  url: http://localhost:5159
+`
+
+// configDir writes the files to a temporary config directory
+func configDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSelectEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		flag     string
+		variable string
+		want     string
+	}{
+		{name: "default", want: DefaultEnv},
+		{name: "variable", variable: "qa", want: EnvQa},
+		{name: "flag wins over variable", flag: "qa", variable: "production", want: EnvQa},
+		{name: "alias", flag: "prod", want: EnvProduction},
+		{name: "alias of development", variable: "local", want: EnvDevelopment},
+		{name: "case and spaces", flag: " QA ", want: EnvQa},
+		{name: "custom environment", flag: "staging", want: "staging"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectEnv(tt.flag, tt.variable); got != tt.want {
+				t.Errorf("selectEnv(%q, %q) = %s, want %s", tt.flag, tt.variable, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConfigByEnvLayersFiles(t *testing.T) {
+	dir := configDir(t, map[string]string{
+		"config.yml":         baseConfig,
+		"config_qa.yml":      "kafka:\n  group_id: printer-qa\n",
+		"config_prod.yml":    "kafka:\n  group_id: printer-prod\n",
+		"config_staging.yml": "kafka:\n  group_id: printer-staging\n",
+	})
+	tests := []struct {
+		name    string
+		env     string
+		environ []string
+		wantEnv string
+		group   string
+		files   []string
+		fails   bool
+	}{
+		{name: "default is production", wantEnv: EnvProduction, group: "printer-prod", files: []string{"config.yml", "config_prod.yml"}},
+		{name: "ENV variable", environ: []string{"ENV=qa"}, wantEnv: EnvQa, group: "printer-qa", files: []string{"config.yml", "config_qa.yml"}},
+		{name: "development reads config.yml alone", env: "dev", wantEnv: EnvDevelopment, group: "printer", files: []string{"config.yml"}},
+		{name: "custom environment file", env: "staging", wantEnv: "staging", group: "printer-staging", files: []string{"config.yml", "config_staging.yml"}},
+		{name: "unknown environment", env: "demo", fails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Not nil, the variables of the test process are not read
+			environ := append([]string{}, tt.environ...)
+			cfg, env, err := GetConfigByEnv(Options{Env: tt.env, Dir: dir, Environ: environ, Overrides: []string{"file_share_path=" + t.TempDir()}})
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("loaded environment %s, want an error", env)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env != tt.wantEnv {
+				t.Errorf("environment = %s, want %s", env, tt.wantEnv)
+			}
+			if cfg.Kafka.GroupID != tt.group {
+				t.Errorf("kafka.group_id = %s, want %s", cfg.Kafka.GroupID, tt.group)
+			}
+			var files []string
+			for _, path := range cfg.Files() {
+				files = append(files, filepath.Base(path))
+			}
+			if strings.Join(files, ",") != strings.Join(tt.files, ",") {
+				t.Errorf("files = %v, want %v", files, tt.files)
+			}
+		})
+	}
+}
+
+// The shipped environments check nothing unless their own file enables validation, config.yml
+// is layered under them and must not enable it either
+func TestShippedEnvironmentsUseDefaultValidation(t *testing.T) {
+	for _, env := range []string{EnvProduction, EnvQa, EnvDevelopment} {
+		t.Run(env, func(t *testing.T) {
+			cfg, _, err := GetConfigByEnv(Options{Env: env, Dir: "../config", Environ: []string{
+				"BARTENDER_FILE_SHARE_PATH=" + t.TempDir(),
+				"BARTENDER_IS_USED_IMG_LOCAL_PATH=false",
+				"BARTENDER_PASSWORD=printer-pass",
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := defaultValidationRules()
+			if !reflect.DeepEqual(cfg.Validation, want) {
+				t.Errorf("validation = %+v, want the defaults %+v", cfg.Validation, want)
+			}
+			for _, template := range cfg.Templates {
+				if !reflect.DeepEqual(template.Validation, want) {
+					t.Errorf("template %s validation = %+v, want the defaults", template.Key, template.Validation)
+				}
+			}
+		})
+	}
+}
+
+func TestGetConfigByEnvOverrides(t *testing.T) {
+	dir := configDir(t, map[string]string{"config.yml": baseConfig})
+	share := t.TempDir()
+	tests := []struct {
+		name      string
+		environ   []string
+		overrides []string
+		check     func(cfg *Config) bool
+		applied   []string
+		fails     bool
+	}{
+		{
+			name:    "environment variable",
+			environ: []string{"KAFKA_GROUP_ID=printer-2"},
+			check:   func(cfg *Config) bool { return cfg.Kafka.GroupID == "printer-2" },
+			applied: []string{"KAFKA_GROUP_ID"},
+		},
+		{
+			name:    "empty variable is ignored",
+			environ: []string{"KAFKA_GROUP_ID="},
+			check:   func(cfg *Config) bool { return cfg.Kafka.GroupID == "printer" },
+		},
+		{
+			name:      "override wins over the variable",
+			environ:   []string{"KAFKA_GROUP_ID=printer-2"},
+			overrides: []string{"kafka.group_id=printer-3"},
+			check:     func(cfg *Config) bool { return cfg.Kafka.GroupID == "printer-3" },
+			applied:   []string{"KAFKA_GROUP_ID", "kafka.group_id"},
+		},
+		{
+			name:      "typed value",
+			overrides: []string{"kafka.commit_interval_ms=250"},
+			check:     func(cfg *Config) bool { return cfg.Kafka.CommitIntervalMs == 250 },
+			applied:   []string{"kafka.commit_interval_ms"},
+		},
+		{
+			name:      "comma separated list",
+			overrides: []string{"validation.required=name, code"},
+			check: func(cfg *Config) bool {
+				return strings.Join(cfg.Validation.Required, ",") == "name,code"
+			},
+			applied: []string{"validation.required"},
+		},
+		{name: "unknown setting", overrides: []string{"kafka.group=printer-2"}, fails: true},
+		{name: "missing value", overrides: []string{"kafka.group_id"}, fails: true},
+		{name: "invalid value", environ: []string{"KAFKA_COMMIT_INTERVAL_MS=soon"}, fails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environ := append([]string{"BARTENDER_FILE_SHARE_PATH=" + share}, tt.environ...)
+			cfg, _, err := GetConfigByEnv(Options{Env: EnvDevelopment, Dir: dir, Environ: environ, Overrides: tt.overrides})
+			if tt.fails {
+				if err == nil {
+					t.Fatal("invalid override was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cfg) {
+				t.Error("override was not applied")
+			}
+			applied := append([]string{"BARTENDER_FILE_SHARE_PATH"}, tt.applied...)
+			if got := cfg.Overrides(); strings.Join(got, ",") != strings.Join(applied, ",") {
+				t.Errorf("Overrides = %v, want %v", got, applied)
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "kafka.group_id", want: "KAFKA_GROUP_ID"},
+		{path: "bartender_printer_api.url", want: "BARTENDER_PRINTER_API_URL"},
+		{path: "file_share_path", want: "BARTENDER_FILE_SHARE_PATH"},
+		{path: "export_retention.max_age_hours", want: "BARTENDER_EXPORT_RETENTION_MAX_AGE_HOURS"},
+	}
+	for _, tt := range tests {
+		if got := EnvName(tt.path); got != tt.want {
+			t.Errorf("EnvName(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+	for _, path := range Settings() {
+		if !strings.HasPrefix(EnvName(path), "KAFKA_") && !strings.HasPrefix(EnvName(path), "BARTENDER_") {
+			t.Errorf("setting %s has no prefixed variable", path)
+		}
+	}
+}
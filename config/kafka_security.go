@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"kafka-consumer/application/constant"
+)
+
+// reservedKafkaProperties are managed by the consumer, kafka.properties cannot change them
+var reservedKafkaProperties = map[string]string{
+	"enable.auto.commit": "offsets are committed once the print jobs finished",
+	"bootstrap.servers":  "use kafka.bootstrap_servers",
+	"group.id":           "use kafka.group_id",
+}
+
+// validateKafkaSecurity reports invalid security settings and extra properties of the brokers
+func (c *Config) validateKafkaSecurity() []string {
+	var problems []string
+	k := c.Kafka
+	protocol := constant.KafkaSecurityProtocol(strings.ToLower(k.SecurityProtocol))
+	switch protocol {
+	case "", constant.KafkaSecurityPlaintext, constant.KafkaSecuritySsl:
+	case constant.KafkaSecuritySaslPlaintext, constant.KafkaSecuritySaslSsl:
+		switch constant.KafkaSaslMechanism(strings.ToUpper(k.SaslMechanism)) {
+		case constant.KafkaSaslPlain, constant.KafkaSaslScramSha256, constant.KafkaSaslScramSha512:
+		case "":
+			problems = append(problems, fmt.Sprintf("kafka.sasl_mechanism: required by security_protocol %s", k.SecurityProtocol))
+		default:
+			problems = append(problems, fmt.Sprintf("kafka.sasl_mechanism: unknown value %q, expected PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", k.SaslMechanism))
+		}
+		if k.SaslUsername == "" || k.SaslPassword == "" {
+			problems = append(problems, fmt.Sprintf("kafka.sasl_username, sasl_password: required by security_protocol %s", k.SecurityProtocol))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("kafka.security_protocol: unknown value %q, expected plaintext, ssl, sasl_plaintext or sasl_ssl", k.SecurityProtocol))
+	}
+	if k.SaslMechanism != "" && (protocol == "" || protocol == constant.KafkaSecurityPlaintext || protocol == constant.KafkaSecuritySsl) {
+		problems = append(problems, "kafka.sasl_mechanism: only used by security_protocol sasl_plaintext or sasl_ssl")
+	}
+	if (k.SslCertificateLocation == "") != (k.SslKeyLocation == "") {
+		problems = append(problems, "kafka.ssl_certificate_location, ssl_key_location: the client certificate needs both")
+	}
+	var reserved []string
+	for key := range k.Properties {
+		if reason, ok := reservedKafkaProperties[strings.ToLower(strings.TrimSpace(key))]; ok {
+			reserved = append(reserved, fmt.Sprintf("kafka.properties: %s cannot be set, %s", key, reason))
+		}
+	}
+	sort.Strings(reserved)
+	return append(problems, reserved...)
+}
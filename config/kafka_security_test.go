@@ -0,0 +1,69 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateKafkaSecurity(t *testing.T) {
+	scram := KafkaConfig{SecurityProtocol: "SASL_SSL", SaslMechanism: "scram-sha-512", SaslUsername: "printer", SaslPassword: "secret"}
+	tests := []struct {
+		name  string
+		kafka KafkaConfig
+		want  []string // Reported problems, empty when valid
+	}{
+		{name: "plaintext"},
+		{name: "sasl scram", kafka: scram},
+		{name: "tls with client certificate", kafka: KafkaConfig{SecurityProtocol: "ssl", SslCertificateLocation: "client.pem", SslKeyLocation: "client.key"}},
+		{
+			name:  "unknown protocol",
+			kafka: KafkaConfig{SecurityProtocol: "tls"},
+			want:  []string{`kafka.security_protocol: unknown value "tls"`},
+		},
+		{
+			name:  "sasl without mechanism and credentials",
+			kafka: KafkaConfig{SecurityProtocol: "sasl_plaintext"},
+			want: []string{
+				"kafka.sasl_mechanism: required by security_protocol sasl_plaintext",
+				"kafka.sasl_username, sasl_password: required by security_protocol sasl_plaintext",
+			},
+		},
+		{
+			name:  "unknown mechanism",
+			kafka: KafkaConfig{SecurityProtocol: "sasl_ssl", SaslMechanism: "GSSAPI", SaslUsername: "printer", SaslPassword: "secret"},
+			want:  []string{`kafka.sasl_mechanism: unknown value "GSSAPI"`},
+		},
+		{
+			name:  "mechanism without sasl",
+			kafka: KafkaConfig{SecurityProtocol: "ssl", SaslMechanism: "PLAIN"},
+			want:  []string{"kafka.sasl_mechanism: only used by security_protocol sasl_plaintext or sasl_ssl"},
+		},
+		{
+			name:  "certificate without key",
+			kafka: KafkaConfig{SecurityProtocol: "ssl", SslCertificateLocation: "client.pem"},
+			want:  []string{"kafka.ssl_certificate_location, ssl_key_location: the client certificate needs both"},
+		},
+		{
+			name:  "reserved properties",
+			kafka: KafkaConfig{Properties: map[string]string{"socket.timeout.ms": "30000", "Group.Id": "other", "enable.auto.commit": "true"}},
+			want: []string{
+				"kafka.properties: Group.Id cannot be set, use kafka.group_id",
+				"kafka.properties: enable.auto.commit cannot be set",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Kafka: tt.kafka}
+			got := c.validateKafkaSecurity()
+			if len(got) != len(tt.want) {
+				t.Fatalf("problems = %q, want %d", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(got[i], want) {
+					t.Errorf("problem %q, want %q", got[i], want)
+				}
+			}
+		})
+	}
+}
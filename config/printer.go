@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"kafka-consumer/application/constant"
+)
+
+// PrinterConfig is a printer installed on the Bartender host
+type PrinterConfig struct {
+	Name         string   `yaml:"name"`         // Printer name as installed on the Bartender host
+	Station      string   `yaml:"station"`      // Production station the printer belongs to
+	Capabilities []string `yaml:"capabilities"` // rfid and/or plain, default rfid
+	Enabled      *bool    `yaml:"enabled"`      // Default true
+	RateLimit    int      `yaml:"rate_limit"`   // Print requests per second, default bartender_printer_api.rate_limit
+}
+
+// IsEnabled reports whether jobs can be routed to the printer
+func (p *PrinterConfig) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// HasCapability reports whether the printer can print labels of the given kind
+func (p *PrinterConfig) HasCapability(capability constant.PrinterCapability) bool {
+	for _, c := range p.Capabilities {
+		if strings.EqualFold(c, string(capability)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Printer returns the printer registered under name, case-insensitive
+func (c *Config) Printer(name string) (*PrinterConfig, bool) {
+	name = strings.TrimSpace(name)
+	for i := range c.Printers {
+		if strings.EqualFold(c.Printers[i].Name, name) {
+			return &c.Printers[i], true
+		}
+	}
+	return nil, false
+}
+
+// applyPrinterDefaults fills the optional printer settings, without a registry every
+// printer named by a template is registered as an RFID printer
+func (c *Config) applyPrinterDefaults() {
+	if len(c.Printers) == 0 {
+		for _, t := range c.Templates {
+			if _, ok := c.Printer(t.Printer); !ok && t.Printer != "" {
+				c.Printers = append(c.Printers, PrinterConfig{Name: t.Printer})
+			}
+		}
+	}
+	for i := range c.Printers {
+		p := &c.Printers[i]
+		if len(p.Capabilities) == 0 {
+			p.Capabilities = []string{string(constant.PrinterCapabilityRfid)}
+		}
+		if p.RateLimit <= 0 {
+			p.RateLimit = c.BartenderPrinterAPI.RateLimit
+		}
+	}
+}
+
+// validatePrinters returns every problem of the printer registry and of the template routes
+func (c *Config) validatePrinters() []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for i, p := range c.Printers {
+		name := fmt.Sprintf("printers[%d]", i)
+		if p.Name == "" {
+			problems = append(problems, name+": name is required")
+			continue
+		}
+		name = fmt.Sprintf("printer %q", p.Name)
+		if seen[strings.ToLower(p.Name)] {
+			problems = append(problems, name+": duplicate name")
+		}
+		seen[strings.ToLower(p.Name)] = true
+		for _, capability := range p.Capabilities {
+			switch constant.PrinterCapability(strings.ToLower(capability)) {
+			case constant.PrinterCapabilityRfid, constant.PrinterCapabilityPlain:
+			default:
+				problems = append(problems, fmt.Sprintf("%s: unknown capability %q", name, capability))
+			}
+		}
+	}
+
+	for _, t := range c.Templates {
+		name := fmt.Sprintf("template %q", t.Key)
+		capability := constant.PrinterCapability(t.Capability)
+		switch capability {
+		case constant.PrinterCapabilityRfid, constant.PrinterCapabilityPlain:
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown capability %q", name, t.Capability))
+			continue
+		}
+		if t.Station != "" {
+			if len(c.PrintersFor(t.Station, capability)) == 0 {
+				problems = append(problems, fmt.Sprintf("%s: no enabled %s printer at station %q", name, capability, t.Station))
+			}
+			continue
+		}
+		p, ok := c.Printer(t.Printer)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: printer %q is not registered", name, t.Printer))
+			continue
+		}
+		if !p.HasCapability(capability) {
+			problems = append(problems, fmt.Sprintf("%s: printer %q cannot print %s labels", name, t.Printer, capability))
+		}
+	}
+	return problems
+}
+
+// PrintersFor returns the enabled printers of a station able to print labels of the given kind
+func (c *Config) PrintersFor(station string, capability constant.PrinterCapability) []*PrinterConfig {
+	var result []*PrinterConfig
+	for i := range c.Printers {
+		p := &c.Printers[i]
+		if p.IsEnabled() && strings.EqualFold(p.Station, station) && p.HasCapability(capability) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// liveSettings can change while the consumer runs, every other setting needs a restart
+var liveSettings = []string{
+	"bartender_printer_api.rate_limit",
+	"bartender_printer_api.worker_count",
+	"bartender_printer_api.sequential_mode",
+	"bartender_printer_api.max_retries",
+	"bartender_printer_api.payload_format",
+	"bartender_printer_api.action_template_file",
+	"bartender_printer_api.root_path",
+	"bartender_printer_api.data_path",
+	"bartender_tracking_status.is_call_api",
+	"bartender_tracking_status.poll_interval_ms",
+	"bartender_tracking_status.timeout_seconds",
+	"config_reload.restart_on_unsafe_change",
+	"logger.level",
+	"templates",
+	"printers",
+	"validation",
+	"size_charts",
+	"size_conversions",
+}
+
+// Change is a setting that differs between two configurations
+type Change struct {
+	Setting string // Dotted yaml path, list entries by key, e.g. templates[kidvn].copies
+	Old     string
+	New     string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Setting, c.Old, c.New)
+}
+
+// Live reports whether the setting can be applied without restarting the consumer
+func (c Change) Live() bool {
+	for _, live := range liveSettings {
+		if c.Setting == live || strings.HasPrefix(c.Setting, live+".") || strings.HasPrefix(c.Setting, live+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff returns the settings that differ from old to new. Templates and printers are compared
+// entry by entry, by key and name.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diffValue("", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), false, &changes)
+	return changes
+}
+
+func diffValue(path string, a, b reflect.Value, sensitive bool, changes *[]Change) {
+	switch a.Kind() {
+	case reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := yamlName(t.Field(i))
+			if !ok {
+				continue
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			diffValue(name, a.Field(i), b.Field(i), sensitive || isSecret(t.Field(i)), changes)
+		}
+		return
+	case reflect.Slice:
+		if key := entryKey(a.Type().Elem()); key != "" {
+			diffEntries(path, key, a, b, changes)
+			return
+		}
+	}
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+	*changes = append(*changes, Change{Setting: path, Old: formatSetting(a, sensitive), New: formatSetting(b, sensitive)})
+}
+
+// diffEntries compares two lists of entries identified by their key field, case-insensitively
+func diffEntries(path, key string, a, b reflect.Value, changes *[]Change) {
+	index := func(list reflect.Value) ([]string, map[string]reflect.Value) {
+		var ids []string
+		entries := make(map[string]reflect.Value)
+		for i := 0; i < list.Len(); i++ {
+			id := strings.ToLower(list.Index(i).FieldByName(key).String())
+			ids = append(ids, id)
+			entries[id] = list.Index(i)
+		}
+		return ids, entries
+	}
+	name := func(entry reflect.Value) string {
+		return fmt.Sprintf("%s[%s]", path, entry.FieldByName(key).String())
+	}
+	oldIds, oldEntries := index(a)
+	newIds, newEntries := index(b)
+	for _, id := range newIds {
+		entry := newEntries[id]
+		if old, ok := oldEntries[id]; ok {
+			diffValue(name(entry), old, entry, false, changes)
+		} else {
+			*changes = append(*changes, Change{Setting: name(entry), Old: "absent", New: "added"})
+		}
+	}
+	for _, id := range oldIds {
+		if _, ok := newEntries[id]; !ok {
+			*changes = append(*changes, Change{Setting: name(oldEntries[id]), Old: "present", New: "removed"})
+		}
+	}
+}
+
+// entryKey returns the field identifying the entries of a list, empty when they have none
+func entryKey(t reflect.Type) string {
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+	for _, name := range []string{"Key", "Name"} {
+		if f, ok := t.FieldByName(name); ok && f.Type.Kind() == reflect.String {
+			return name
+		}
+	}
+	return ""
+}
+
+// formatSetting renders a value for the reload log, lists of entries by their count
+func formatSetting(v reflect.Value, sensitive bool) string {
+	if sensitive {
+		return "***"
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return "default"
+		}
+		return formatSetting(v.Elem(), false)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			return fmt.Sprintf("%d entries", v.Len())
+		}
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// fileStamp identifies a version of a watched file, zero when the file is missing
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileStamps(files []string) []fileStamp {
+	stamps := make([]fileStamp, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+// Watch calls changed after one of the files was modified, checking every interval until
+// ctx is done
+func Watch(ctx context.Context, files []string, interval time.Duration, changed func()) {
+	stamps := fileStamps(files)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := fileStamps(files)
+		if !reflect.DeepEqual(current, stamps) {
+			stamps = current
+			changed()
+		}
+	}
+}
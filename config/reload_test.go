@@ -0,0 +1,111 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reloadConfig() *Config {
+	return &Config{
+		Kafka:               KafkaConfig{GroupID: "printer", SaslPassword: "old-secret"},
+		BartenderPrinterAPI: BartenderPrinterAPIConfig{URL: "http://localhost:5159", WorkerCount: 2},
+		Templates:           []TemplateConfig{{Key: "kidvn", Copies: 1}, {Key: "adultvn", Copies: 1}},
+		Printers:            []PrinterConfig{{Name: "ZD621-01", Station: "A"}},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+		live   bool
+	}{
+		{name: "no change", change: func(c *Config) {}},
+		{name: "live setting", change: func(c *Config) { c.BartenderPrinterAPI.WorkerCount = 4 },
+			want: []string{"bartender_printer_api.worker_count: 2 -> 4"}, live: true},
+		{name: "restart setting", change: func(c *Config) { c.Kafka.GroupID = "printer-2" },
+			want: []string{`kafka.group_id: "printer" -> "printer-2"`}},
+		{name: "secret is redacted", change: func(c *Config) { c.Kafka.SaslPassword = "new-secret" },
+			want: []string{"kafka.sasl_password: *** -> ***"}},
+		{name: "template entry", change: func(c *Config) { c.Templates[1].Copies = 2 },
+			want: []string{"templates[adultvn].copies: 1 -> 2"}, live: true},
+		{name: "entries matched by key, not position", change: func(c *Config) {
+			c.Templates = []TemplateConfig{{Key: "adultvn", Copies: 1}, {Key: "kidvn", Copies: 1}}
+		}},
+		{name: "keys matched case-insensitively", change: func(c *Config) { c.Templates[1].Key = "ADULTVN" },
+			want: []string{`templates[ADULTVN].key: "adultvn" -> "ADULTVN"`}, live: true},
+		{name: "entry added and removed", change: func(c *Config) { c.Templates[1].Key = "kidus" },
+			want: []string{"templates[kidus]: absent -> added", "templates[adultvn]: present -> removed"}, live: true},
+		{name: "pointer setting", change: func(c *Config) { c.Printers[0].Enabled = &disabled },
+			want: []string{"printers[ZD621-01].enabled: default -> false"}, live: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, updated := reloadConfig(), reloadConfig()
+			tt.change(updated)
+
+			var got []string
+			for _, change := range Diff(old, updated) {
+				got = append(got, change.String())
+				if change.Live() != tt.live {
+					t.Errorf("%s: Live = %v, want %v", change.Setting, change.Live(), tt.live)
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Diff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeLive(t *testing.T) {
+	tests := []struct {
+		setting string
+		live    bool
+	}{
+		{setting: "logger.level", live: true},
+		{setting: "validation.required", live: true},
+		{setting: "templates", live: true},
+		{setting: "bartender_printer_api.rate_limit", live: true},
+		{setting: "bartender_printer_api.url"},
+		{setting: "bartender_printer_api.rate_limit_burst"},
+		{setting: "kafka.bootstrap_servers"},
+		{setting: "file_share_path"},
+	}
+	for _, tt := range tests {
+		if got := (Change{Setting: tt.setting}).Live(); got != tt.live {
+			t.Errorf("Live(%s) = %v, want %v", tt.setting, got, tt.live)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("a: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go Watch(ctx, []string{path}, 10*time.Millisecond, func() { changed <- struct{}{} })
+
+	select {
+	case <-changed:
+		t.Fatal("change reported for an untouched file")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := os.WriteFile(path, []byte("a: 12\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("change of the file was not reported")
+	}
+}
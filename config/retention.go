@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"kafka-consumer/application/constant"
+)
+
+// validateExportRetention reports invalid export retention settings
+func (c *Config) validateExportRetention() []string {
+	r := c.ExportRetention
+	if !r.Enabled {
+		return nil
+	}
+	var problems []string
+	switch constant.RetentionAction(strings.ToLower(r.Action)) {
+	case "", constant.RetentionActionDelete, constant.RetentionActionArchive:
+	default:
+		problems = append(problems, fmt.Sprintf("export_retention: unknown action %q, expected delete or archive", r.Action))
+	}
+	if r.ArchivePath != "" && filepath.Clean(r.ArchivePath) == filepath.Clean(c.FileSharePath) {
+		problems = append(problems, "export_retention: archive_path must differ from file_share_path")
+	}
+	if r.MaxAgeHours < 0 || r.MaxSizeMB < 0 || r.MinAgeMinutes < 0 || r.ArchiveMaxAgeDays < 0 || r.IntervalMinutes < 0 {
+		problems = append(problems, "export_retention: ages, sizes and intervals cannot be negative")
+	}
+	return problems
+}
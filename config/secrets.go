@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"kafka-consumer/application/secret"
+)
+
+// DefaultSecretKeyFile is the key of the encrypted settings, next to the config files
+const DefaultSecretKeyFile = "secret.key"
+
+// Secret values shorter than this are not redacted from the logs, they would hide every
+// occurrence of a common word
+const minRedactedLength = 4
+
+// secretKeyFile returns the key file of the encrypted settings
+func (c *Config) secretKeyFile() string {
+	if c.SecretKeyFile != "" {
+		return c.SecretKeyFile
+	}
+	return filepath.Join(c.configDir(), DefaultSecretKeyFile)
+}
+
+// configDir returns the directory of the last config file, the environment file when layered
+func (c *Config) configDir() string {
+	if len(c.files) == 0 {
+		return ""
+	}
+	return filepath.Dir(c.files[len(c.files)-1])
+}
+
+// resolveSecrets replaces the ${env:...}, ${file:...} and enc:... values of the settings
+// tagged secret by what they refer to, and remembers the values to redact them. The ${env:...}
+// variables are read through lookupEnv.
+func (c *Config) resolveSecrets(lookupEnv func(string) (string, bool)) []string {
+	resolver := &secret.Resolver{KeyFile: c.secretKeyFile(), Dir: c.configDir(), LookupEnv: lookupEnv}
+	var problems []string
+	c.secrets = nil
+	secretFields(reflect.ValueOf(c).Elem(), "", func(path, value string, set func(string)) {
+		value, err := resolver.Resolve(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+			return
+		}
+		set(value)
+		if len(value) >= minRedactedLength {
+			c.secrets = append(c.secrets, value)
+		}
+	})
+	return problems
+}
+
+// secretFields calls visit with the values of the string fields and string maps tagged
+// secret:"true", by dotted yaml path, and a setter of the value
+func secretFields(v reflect.Value, prefix string, visit func(path, value string, set func(string))) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := yamlName(sf)
+		if !ok {
+			continue
+		}
+		switch {
+		case sf.Type.Kind() == reflect.Struct:
+			secretFields(v.Field(i), prefix+name+".", visit)
+		case !isSecret(sf):
+		case sf.Type.Kind() == reflect.String:
+			field := v.Field(i)
+			visit(prefix+name, field.String(), field.SetString)
+		case sf.Type.Kind() == reflect.Map && sf.Type.Key().Kind() == reflect.String && sf.Type.Elem().Kind() == reflect.String:
+			field := v.Field(i)
+			for _, key := range field.MapKeys() {
+				visit(prefix+name+"."+key.String(), field.MapIndex(key).String(), func(value string) {
+					field.SetMapIndex(key, reflect.ValueOf(value).Convert(sf.Type.Elem()))
+				})
+			}
+		}
+	}
+}
+
+// isSecret reports whether the field holds a credential, never logged
+func isSecret(sf reflect.StructField) bool {
+	return sf.Tag.Get("secret") == "true"
+}
+
+// applyCredentialDefaults gives the shared Bartender credentials to the API sections that
+// have none of their own
+func (c *Config) applyCredentialDefaults() {
+	shared := c.BartenderCredentials
+	api := &c.BartenderPrinterAPI
+	if api.Username == "" && api.Password == "" {
+		api.Username, api.Password = shared.Username, shared.Password
+	}
+	tracking := &c.BartenderTrackingScriptAPI
+	if tracking.Username == "" && tracking.Password == "" {
+		tracking.Username, tracking.Password = shared.Username, shared.Password
+	}
+}
+
+// Redact replaces the secret values of the configuration found in text
+func (c *Config) Redact(text string) string {
+	for _, value := range c.secrets {
+		text = strings.ReplaceAll(text, value, "***")
+	}
+	return text
+}
+
+// RedactURL hides the password of a URL with user information
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+)
+
+// SizeChartEntry is the label data of a size, per market and gender
+type SizeChartEntry struct {
+	Market    string `yaml:"market"`    // vn, us or uk, empty applies to every market
+	Gender    string `yaml:"gender"`    // women, men, kids, or adult for both women and men
+	Size      string `yaml:"size"`      // e.g. S, 2XL, 3T
+	Attribute string `yaml:"attribute"` // Weight and height printed on the label, e.g. W/42-45 kg - H/150-155 cm
+	Image     string `yaml:"image"`     // SizeAvailable image file, used when is_used_img_local_path is true
+	ImageUrl  string `yaml:"image_url"` // SizeAvailable image, downloaded and base64 encoded otherwise
+}
+
+// SizeChartConfig holds the size charts filling Attribute and SizeAvailable
+type SizeChartConfig struct {
+	SizeField string           `yaml:"size_field"` // Product field looked up in the charts, default us_size
+	File      string           `yaml:"file"`       // Optional CSV with the columns market,gender,size,attribute,image,image_url
+	Entries   []SizeChartEntry `yaml:"entries"`    // Added to the rows of file
+
+	index map[string]*SizeChartEntry
+}
+
+// sizeChartColumns is the header of the size chart CSV file
+var sizeChartColumns = []string{"market", "gender", "size", "attribute", "image", "image_url"}
+
+// defaultSizeChart has the size available images known before the charts were configurable
+func defaultSizeChart() []SizeChartEntry {
+	var entries []SizeChartEntry
+	for _, size := range []string{"xs", "s", "m", "l", "xl", "2xl", "3xl"} {
+		entries = append(entries, SizeChartEntry{Gender: "adult", Size: size, Image: "adult_" + size + ".pdf"})
+	}
+	for _, size := range []string{"2t", "3t", "4t", "5", "6", "7", "8"} {
+		entries = append(entries, SizeChartEntry{Gender: string(constant.GenderTypeKids), Size: size, Image: "kids_" + size + ".pdf"})
+	}
+	return entries
+}
+
+// normalizeGender maps the gender spellings of BOM to the chart genders
+func normalizeGender(gender string) string {
+	gender = strings.ToLower(strings.TrimSpace(gender))
+	if gender == string(constant.GenderTypeKid) {
+		return string(constant.GenderTypeKids)
+	}
+	return gender
+}
+
+func sizeChartKey(market, gender, size string) string {
+	return strings.ToLower(strings.TrimSpace(market)) + "|" + normalizeGender(gender) + "|" + strings.ToLower(strings.TrimSpace(size))
+}
+
+// genders returns the genders an entry applies to
+func (e *SizeChartEntry) genders() []string {
+	if strings.EqualFold(strings.TrimSpace(e.Gender), "adult") {
+		return []string{string(constant.GenderTypeWomen), string(constant.GenderTypeMen)}
+	}
+	return []string{normalizeGender(e.Gender)}
+}
+
+// SizeChart returns the chart entry of a size, an entry of the market wins over one for every market
+func (c *Config) SizeChart(market, gender, size string) (*SizeChartEntry, bool) {
+	if e, ok := c.SizeCharts.index[sizeChartKey(market, gender, size)]; ok {
+		return e, true
+	}
+	e, ok := c.SizeCharts.index[sizeChartKey("", gender, size)]
+	return e, ok
+}
+
+// Sizes returns the sizes of a gender in the chart of the market, in chart order
+func (c *Config) Sizes(market, gender string) []string {
+	market = strings.ToLower(strings.TrimSpace(market))
+	gender = normalizeGender(gender)
+	var sizes []string
+	seen := make(map[string]bool)
+	for _, e := range c.SizeCharts.Entries {
+		entryMarket := strings.ToLower(strings.TrimSpace(e.Market))
+		if entryMarket != "" && entryMarket != market {
+			continue
+		}
+		for _, g := range e.genders() {
+			size := strings.ToLower(strings.TrimSpace(e.Size))
+			if g == gender && !seen[size] {
+				seen[size] = true
+				sizes = append(sizes, size)
+			}
+		}
+	}
+	return sizes
+}
+
+// SizeOf returns the size of the product looked up in the charts
+func (c *Config) SizeOf(p *model.Product) string {
+	size, _ := p.FieldValue(c.SizeCharts.SizeField)
+	return size
+}
+
+// loadSizeChartFile reads the entries of a size chart CSV file
+func loadSizeChartFile(path string) ([]SizeChartEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"gender", "size"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q, expected %s", name, strings.Join(sizeChartColumns, ","))
+		}
+	}
+
+	var entries []SizeChartEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		entries = append(entries, SizeChartEntry{
+			Market:    value("market"),
+			Gender:    value("gender"),
+			Size:      value("size"),
+			Attribute: value("attribute"),
+			Image:     value("image"),
+			ImageUrl:  value("image_url"),
+		})
+	}
+	return entries, nil
+}
+
+// applySizeChartDefaults loads the size chart file and indexes the entries,
+// without charts the built-in size available images are used
+func (c *Config) applySizeChartDefaults() []string {
+	sc := &c.SizeCharts
+	if sc.SizeField == "" {
+		sc.SizeField = "us_size"
+	}
+
+	var problems []string
+	if sc.File != "" {
+		entries, err := loadSizeChartFile(sc.File)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("size_charts: invalid file %s: %v", sc.File, err))
+		}
+		sc.Entries = append(entries, sc.Entries...)
+	}
+	if len(sc.Entries) == 0 && sc.File == "" {
+		sc.Entries = defaultSizeChart()
+	}
+
+	sc.index = make(map[string]*SizeChartEntry)
+	for i := range sc.Entries {
+		e := &sc.Entries[i]
+		for _, gender := range e.genders() {
+			key := sizeChartKey(e.Market, gender, e.Size)
+			if _, ok := sc.index[key]; ok {
+				problems = append(problems, fmt.Sprintf("size_charts: duplicate size %q of %s in market %q", e.Size, gender, e.Market))
+			}
+			sc.index[key] = e
+		}
+	}
+	return problems
+}
+
+// validateSizeCharts reports every invalid size chart entry
+func (c *Config) validateSizeCharts() []string {
+	var problems []string
+	if _, ok := (&model.Product{}).FieldValue(c.SizeCharts.SizeField); !ok {
+		problems = append(problems, fmt.Sprintf("size_charts: unknown size_field %q", c.SizeCharts.SizeField))
+	}
+	for i, e := range c.SizeCharts.Entries {
+		name := fmt.Sprintf("size_charts[%d]", i)
+		if e.Size == "" {
+			problems = append(problems, name+": size is required")
+		}
+		switch constant.Market(strings.ToLower(e.Market)) {
+		case "", constant.MarketVn, constant.MarketUs, constant.MarketUk:
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown market %q", name, e.Market))
+		}
+		for _, gender := range e.genders() {
+			switch constant.GenderType(gender) {
+			case constant.GenderTypeWomen, constant.GenderTypeMen, constant.GenderTypeKids:
+			default:
+				problems = append(problems, fmt.Sprintf("%s: unknown gender %q", name, e.Gender))
+			}
+		}
+	}
+	for _, t := range c.Templates {
+		switch constant.Market(t.Market) {
+		case "", constant.MarketVn, constant.MarketUs, constant.MarketUk:
+		default:
+			problems = append(problems, fmt.Sprintf("template %q: unknown market %q", t.Key, t.Market))
+		}
+	}
+	return problems
+}
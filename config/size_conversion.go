@@ -0,0 +1,223 @@
+package config
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+)
+
+// SizeConversion is a row of equivalent sizes across markets
+type SizeConversion struct {
+	Gender   string `yaml:"gender"`   // women, men, kids, or adult for both women and men
+	Category string `yaml:"category"` // Product category, e.g. tops, empty applies to every category
+	US       string `yaml:"us"`
+	VN       string `yaml:"vn"`
+	UK       string `yaml:"uk"`
+}
+
+// SizeConversionConfig holds the tables filling the missing us_size, vn_size and uk_size,
+// conversion is disabled without rows
+type SizeConversionConfig struct {
+	File string           `yaml:"file"` // Optional CSV with the columns gender,category,us,vn,uk
+	Rows []SizeConversion `yaml:"rows"` // Added to the rows of file
+}
+
+// sizeConversionColumns is the header of the size conversion CSV file
+var sizeConversionColumns = []string{"gender", "category", "us", "vn", "uk"}
+
+// SizeMismatchError reports the sizes of a product that are not the same size in the conversion table
+type SizeMismatchError struct {
+	Sizes map[constant.Market]string
+}
+
+func (e *SizeMismatchError) Error() string {
+	var parts []string
+	for _, market := range []constant.Market{constant.MarketUs, constant.MarketVn, constant.MarketUk} {
+		if size, ok := e.Sizes[market]; ok {
+			parts = append(parts, fmt.Sprintf("%s %q", strings.ToUpper(string(market)), size))
+		}
+	}
+	return "sizes " + strings.Join(parts, ", ") + " are not the same size"
+}
+
+// size returns the size of the row in a market
+func (r *SizeConversion) size(market constant.Market) string {
+	switch market {
+	case constant.MarketUs:
+		return r.US
+	case constant.MarketVn:
+		return r.VN
+	case constant.MarketUk:
+		return r.UK
+	default:
+		return ""
+	}
+}
+
+// appliesTo reports whether the row converts the sizes of a gender and category
+func (r *SizeConversion) appliesTo(gender, category string) bool {
+	if r.Category != "" && !strings.EqualFold(strings.TrimSpace(r.Category), category) {
+		return false
+	}
+	for _, g := range (&SizeChartEntry{Gender: r.Gender}).genders() {
+		if g == gender {
+			return true
+		}
+	}
+	return false
+}
+
+// productSizes returns the sizes BOM sent for a product, by market
+func productSizes(p *model.Product) map[constant.Market]string {
+	sizes := make(map[constant.Market]string)
+	for market, size := range map[constant.Market]string{
+		constant.MarketUs: p.USSize,
+		constant.MarketVn: p.VNSize,
+		constant.MarketUk: p.UKSize,
+	} {
+		if size = strings.TrimSpace(size); size != "" {
+			sizes[market] = size
+		}
+	}
+	return sizes
+}
+
+// MatchSizes returns the conversion row holding every size of the product, nil when the table
+// does not know them. Rows of the product category win over rows for every category.
+// A SizeMismatchError is returned when the sizes belong to different rows.
+func (c *Config) MatchSizes(p *model.Product) (*SizeConversion, error) {
+	sizes := productSizes(p)
+	if len(c.SizeConversions.Rows) == 0 || len(sizes) == 0 {
+		return nil, nil
+	}
+	gender := normalizeGender(p.Gender)
+	category := strings.TrimSpace(p.Category)
+
+	var match, known *SizeConversion
+	for _, specific := range []bool{true, false} {
+		for i := range c.SizeConversions.Rows {
+			r := &c.SizeConversions.Rows[i]
+			if (r.Category != "") != specific || !r.appliesTo(gender, category) {
+				continue
+			}
+			matches, found := true, false
+			for market, size := range sizes {
+				rowSize := r.size(market)
+				if strings.EqualFold(rowSize, size) {
+					found = true
+				} else if rowSize != "" {
+					matches = false
+				}
+			}
+			if found && known == nil {
+				known = r
+			}
+			if found && matches {
+				match = r
+				break
+			}
+		}
+		if match != nil {
+			return match, nil
+		}
+	}
+	if known != nil && len(sizes) > 1 {
+		return nil, &SizeMismatchError{Sizes: sizes}
+	}
+	return known, nil
+}
+
+// loadSizeConversionFile reads the rows of a size conversion CSV file
+func loadSizeConversionFile(path string) ([]SizeConversion, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["gender"]; !ok {
+		return nil, fmt.Errorf("missing column %q, expected %s", "gender", strings.Join(sizeConversionColumns, ","))
+	}
+
+	var rows []SizeConversion
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		rows = append(rows, SizeConversion{
+			Gender:   value("gender"),
+			Category: value("category"),
+			US:       value("us"),
+			VN:       value("vn"),
+			UK:       value("uk"),
+		})
+	}
+	return rows, nil
+}
+
+// applySizeConversionDefaults loads the size conversion file
+func (c *Config) applySizeConversionDefaults() []string {
+	sc := &c.SizeConversions
+	if sc.File == "" {
+		return nil
+	}
+	rows, err := loadSizeConversionFile(sc.File)
+	if err != nil {
+		return []string{fmt.Sprintf("size_conversions: invalid file %s: %v", sc.File, err)}
+	}
+	sc.Rows = append(rows, sc.Rows...)
+	return nil
+}
+
+// validateSizeConversions reports every invalid size conversion row
+func (c *Config) validateSizeConversions() []string {
+	var problems []string
+	for i, r := range c.SizeConversions.Rows {
+		name := fmt.Sprintf("size_conversions[%d]", i)
+		for _, gender := range (&SizeChartEntry{Gender: r.Gender}).genders() {
+			switch constant.GenderType(gender) {
+			case constant.GenderTypeWomen, constant.GenderTypeMen, constant.GenderTypeKids:
+			default:
+				problems = append(problems, fmt.Sprintf("%s: unknown gender %q", name, r.Gender))
+			}
+		}
+		filled := 0
+		for _, size := range []string{r.US, r.VN, r.UK} {
+			if size != "" {
+				filled++
+			}
+		}
+		if filled < 2 {
+			problems = append(problems, name+": at least two of us, vn and uk are required")
+		}
+	}
+	return problems
+}
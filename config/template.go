@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/delimited"
+	"kafka-consumer/application/export"
+	"kafka-consumer/application/model"
+)
+
+// TemplateConfig describes a label design selectable by the template field of the Kafka message
+type TemplateConfig struct {
+	Key                 string   `yaml:"key"`
+	DocumentFile        string   `yaml:"document_file"`         // BTW document, relative to the Bartender root
+	ConnectionSetupFile string   `yaml:"connection_setup_file"` // Text database connection setup, relative to the Bartender root
+	Printer             string   `yaml:"printer"`
+	Copies              int      `yaml:"copies"`
+	Station             string   `yaml:"station"`       // Prints on any printer of the station instead of printer
+	Market              string   `yaml:"market"`        // vn, us or uk, selects the size chart, empty uses the charts for every market
+	Capability          string   `yaml:"capability"`    // rfid (default) or plain, kind of printer the label needs
+	ExportFormat        string   `yaml:"export_format"` // txt, csv, json, xml or xlsx, the connection setup must read the same format
+	Fields              []string `yaml:"fields"`        // Record set columns, in the order of the connection setup
+
+	// Exported record set, columns must match the fields of the db.xml connection setup
+	Columns    []ColumnConfig `yaml:"columns"`     // Overrides fields, a column can be renamed or hold a constant
+	Delimiter  string         `yaml:"delimiter"`   // Default ; for txt and , for csv, "\t" or "tab" for tabs
+	Quoting    string         `yaml:"quoting"`     // minimal (default), all or never
+	Encoding   string         `yaml:"encoding"`    // utf8 (default), utf8_bom, utf16le or utf16be
+	LineEnding string         `yaml:"line_ending"` // lf (default) or crlf
+
+	// Bartender action settings
+	PayloadFormat         string            `yaml:"payload_format"`           // Overrides bartender_printer_api.payload_format
+	ActionTemplateFile    string            `yaml:"action_template_file"`     // Overrides bartender_printer_api.action_template_file
+	RecordSetVariableName string            `yaml:"record_set_variable_name"` // Default datum
+	DatabaseName          string            `yaml:"database_name"`            // Database of the BTW document fed by the record set, default db
+	SaveAfterPrint        bool              `yaml:"save_after_print"`
+	NamedDataSources      map[string]string `yaml:"named_data_sources"` // Named data source values set on the document
+
+	Validation ValidationRules `yaml:"validation"` // Extends the global validation rules
+}
+
+// ColumnConfig is a column of the exported record set
+type ColumnConfig struct {
+	Name  string `yaml:"name"`  // Header, the field name in db.xml, default the product field
+	Field string `yaml:"field"` // Product field of the column
+	Value string `yaml:"value"` // Constant value, used when field is empty
+}
+
+// ExportOptions returns the format of the exported record set
+func (t *TemplateConfig) ExportOptions() delimited.Options {
+	delimiter, _ := utf8.DecodeRuneInString(t.Delimiter)
+	return delimited.Options{
+		Delimiter:  delimiter,
+		Quoting:    delimited.Quoting(t.Quoting),
+		Encoding:   delimited.Encoding(t.Encoding),
+		LineEnding: delimited.LineEnding(t.LineEnding),
+	}
+}
+
+// defaultPrinter is the printer used when a template does not name one
+const defaultPrinter = "HASAKI-RFID"
+
+// defaultTemplates are the label designs available before the registry was configurable
+func defaultTemplates() []TemplateConfig {
+	return []TemplateConfig{
+		{Key: string(constant.KidVn), DocumentFile: "kid_vn\\kid_vn_noprice.btw", ConnectionSetupFile: "kid_vn\\db.xml"},
+		{Key: string(constant.AdultVn), DocumentFile: "adult_vn\\adult_vn_noprice.btw", ConnectionSetupFile: "adult_vn\\db.xml"},
+		{Key: string(constant.KidUs), DocumentFile: "kid_us\\kid_us_noprice.btw", ConnectionSetupFile: "kid_us\\db.xml"},
+		{Key: string(constant.AdultUs), DocumentFile: "adult_us\\adult_us_noprice.btw", ConnectionSetupFile: "adult_us\\db.xml"},
+	}
+}
+
+// Template returns the template registered under key, case-insensitive
+func (c *Config) Template(key string) (*TemplateConfig, bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	for i := range c.Templates {
+		if strings.ToLower(c.Templates[i].Key) == key {
+			return &c.Templates[i], true
+		}
+	}
+	return nil, false
+}
+
+// applyTemplateDefaults fills the optional template settings
+func (c *Config) applyTemplateDefaults() {
+	if len(c.Templates) == 0 {
+		c.Templates = defaultTemplates()
+	}
+	for i := range c.Templates {
+		t := &c.Templates[i]
+		if t.Printer == "" {
+			t.Printer = defaultPrinter
+		}
+		if t.Capability == "" {
+			t.Capability = string(constant.PrinterCapabilityRfid)
+		}
+		t.Capability = strings.ToLower(t.Capability)
+		t.Market = strings.ToLower(strings.TrimSpace(t.Market))
+		if t.Copies == 0 {
+			t.Copies = 1
+		}
+		t.ExportFormat = strings.ToLower(t.ExportFormat)
+		if t.ExportFormat == "" {
+			t.ExportFormat = string(constant.FileTypeTxt)
+		}
+		if len(t.Fields) == 0 {
+			t.Fields = append([]string(nil), model.ProductFields...)
+		}
+		if len(t.Columns) == 0 {
+			for _, field := range t.Fields {
+				t.Columns = append(t.Columns, ColumnConfig{Name: field, Field: field})
+			}
+		}
+		for j := range t.Columns {
+			if t.Columns[j].Name == "" {
+				t.Columns[j].Name = t.Columns[j].Field
+			}
+		}
+		if strings.EqualFold(t.Delimiter, "tab") || t.Delimiter == `\t` {
+			t.Delimiter = "\t"
+		}
+		if t.Delimiter == "" {
+			t.Delimiter = ";"
+			if constant.FileType(t.ExportFormat) == constant.FileTypeCsv {
+				t.Delimiter = ","
+			}
+		}
+		t.Quoting = strings.ToLower(t.Quoting)
+		t.Encoding = strings.ToLower(t.Encoding)
+		t.LineEnding = strings.ToLower(t.LineEnding)
+		if t.PayloadFormat == "" {
+			t.PayloadFormat = c.BartenderPrinterAPI.PayloadFormat
+		}
+		if t.PayloadFormat == "" {
+			t.PayloadFormat = string(constant.PayloadFormatYaml)
+		}
+		if t.ActionTemplateFile == "" {
+			t.ActionTemplateFile = c.BartenderPrinterAPI.ActionTemplateFile
+		}
+		if t.RecordSetVariableName == "" {
+			t.RecordSetVariableName = "datum"
+		}
+		if t.DatabaseName == "" {
+			t.DatabaseName = "db"
+		}
+	}
+}
+
+// validateTemplates reports every invalid template entry
+func (c *Config) validateTemplates() []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for i, t := range c.Templates {
+		name := fmt.Sprintf("templates[%d]", i)
+		if t.Key == "" {
+			problems = append(problems, name+": key is required")
+		} else {
+			key := strings.ToLower(t.Key)
+			if seen[key] {
+				problems = append(problems, fmt.Sprintf("%s: duplicate key %q", name, t.Key))
+			}
+			seen[key] = true
+			name = fmt.Sprintf("templates[%s]", t.Key)
+		}
+		if t.DocumentFile == "" {
+			problems = append(problems, name+": document_file is required")
+		}
+		if t.ConnectionSetupFile == "" {
+			problems = append(problems, name+": connection_setup_file is required")
+		}
+		if t.Copies < 1 {
+			problems = append(problems, fmt.Sprintf("%s: copies must be at least 1, got %d", name, t.Copies))
+		}
+		exporter, ok := export.Get(t.ExportFormat)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: unsupported export_format %q, expected one of %s", name, t.ExportFormat, strings.Join(export.Formats(), ", ")))
+		}
+		switch constant.PayloadFormat(t.PayloadFormat) {
+		case constant.PayloadFormatYaml, constant.PayloadFormatJson:
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unsupported payload_format %q", name, t.PayloadFormat))
+		}
+		if t.ActionTemplateFile != "" {
+			if _, err := template.ParseFiles(t.ActionTemplateFile); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid action_template_file: %v", name, err))
+			}
+		}
+		for _, field := range t.Fields {
+			if _, ok := (&model.Product{}).FieldValue(field); !ok {
+				problems = append(problems, fmt.Sprintf("%s: unknown field %q", name, field))
+			}
+		}
+		columns := make(map[string]bool)
+		for j, column := range t.Columns {
+			if column.Name == "" {
+				problems = append(problems, fmt.Sprintf("%s: columns[%d]: name or field is required", name, j))
+				continue
+			}
+			if columns[strings.ToLower(column.Name)] {
+				problems = append(problems, fmt.Sprintf("%s: duplicate column %q", name, column.Name))
+			}
+			columns[strings.ToLower(column.Name)] = true
+			if column.Field != "" {
+				if _, ok := (&model.Product{}).FieldValue(column.Field); !ok {
+					problems = append(problems, fmt.Sprintf("%s: column %q: unknown field %q", name, column.Name, column.Field))
+				}
+			}
+		}
+		if exporter != nil {
+			names := make([]string, len(t.Columns))
+			for j, column := range t.Columns {
+				names[j] = column.Name
+			}
+			if err := exporter.CheckColumns(names); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+		if utf8.RuneCountInString(t.Delimiter) != 1 {
+			problems = append(problems, fmt.Sprintf("%s: delimiter must be a single character, got %q", name, t.Delimiter))
+		} else if err := t.ExportOptions().Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	return problems
+}
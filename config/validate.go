@@ -0,0 +1,251 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultBartenderRootPath is where the templates live on the Bartender host
+const DefaultBartenderRootPath = `D:\hsk-bar`
+
+// ValidationError lists every problem found in the configuration
+type ValidationError struct {
+	Source   string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration %s, %d problems:\n  - %s", e.Source, len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// Validate checks every section of the configuration and the files and directories it names,
+// it returns a *ValidationError with all the problems found
+func (c *Config) Validate() error {
+	problems := c.settingProblems()
+	problems = append(problems, c.validateFiles()...)
+	if len(problems) > 0 {
+		return &ValidationError{Source: c.source, Problems: problems}
+	}
+	return nil
+}
+
+// settingProblems checks the settings without looking at the file system
+func (c *Config) settingProblems() []string {
+	problems := append([]string(nil), c.loadProblems...)
+	problems = append(problems, c.validateKafka()...)
+	problems = append(problems, c.validateKafkaSecurity()...)
+	problems = append(problems, c.validateBartender()...)
+	problems = append(problems, c.validateTemplates()...)
+	problems = append(problems, c.validatePrinters()...)
+	problems = append(problems, c.validateValidationRules()...)
+	problems = append(problems, c.validateSizeCharts()...)
+	problems = append(problems, c.validateSizeConversions()...)
+	problems = append(problems, c.validateExportRetention()...)
+	return problems
+}
+
+// validateKafka reports invalid broker, consumer and producer settings
+func (c *Config) validateKafka() []string {
+	var problems []string
+	k := c.Kafka
+	if strings.TrimSpace(k.BootstrapServers) == "" {
+		problems = append(problems, "kafka.bootstrap_servers: required, e.g. 10.0.0.1:9092,10.0.0.2:9092")
+	}
+	for _, server := range strings.Split(k.BootstrapServers, ",") {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(server)
+		if err != nil || host == "" {
+			problems = append(problems, fmt.Sprintf("kafka.bootstrap_servers: %q is not host:port", server))
+			continue
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			problems = append(problems, fmt.Sprintf("kafka.bootstrap_servers: %q has an invalid port", server))
+		}
+	}
+	if strings.TrimSpace(k.GroupID) == "" {
+		problems = append(problems, "kafka.group_id: required")
+	}
+	switch k.AutoOffsetReset {
+	case "", "earliest", "latest", "none":
+	default:
+		problems = append(problems, fmt.Sprintf("kafka.auto_offset_reset: unknown value %q, expected earliest, latest or none", k.AutoOffsetReset))
+	}
+	if k.CommitIntervalMs < 0 {
+		problems = append(problems, fmt.Sprintf("kafka.commit_interval_ms: cannot be negative, got %d", k.CommitIntervalMs))
+	}
+	if k.DeliveryTimeoutMs < 0 {
+		problems = append(problems, fmt.Sprintf("kafka.delivery_timeout_ms: cannot be negative, got %d", k.DeliveryTimeoutMs))
+	}
+	if strings.TrimSpace(c.ConsumerTopicInfo.TopicBomBartenderPrinter) == "" {
+		problems = append(problems, "consumer_topic_info.topic_bom_bartender_printer: required")
+	}
+	return problems
+}
+
+// validateBartender reports invalid Bartender API, queue and retry settings
+func (c *Config) validateBartender() []string {
+	var problems []string
+	api := c.BartenderPrinterAPI
+	problems = append(problems, checkURL("bartender_printer_api.url", api.URL, true)...)
+	problems = append(problems, checkMethod("bartender_printer_api.method", api.Method)...)
+	tracking := c.BartenderTrackingScriptAPI
+	problems = append(problems, checkURL("bartender_tracking_status.url", tracking.URL, false)...)
+	problems = append(problems, checkMethod("bartender_tracking_status.method", tracking.Method)...)
+
+	// Zero takes the default, a negative size or count is a typo
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"bartender_printer_api.worker_count", api.WorkerCount},
+		{"bartender_printer_api.queue_size", api.QueueSize},
+		{"bartender_printer_api.completed_retention_hours", api.CompletedRetentionHours},
+		{"bartender_printer_api.rate_limit", api.RateLimit},
+		{"bartender_printer_api.max_retries", api.MaxRetries},
+		{"bartender_printer_api.retry_base_delay_ms", api.RetryBaseDelayMs},
+		{"bartender_printer_api.retry_max_delay_ms", api.RetryMaxDelayMs},
+		{"bartender_printer_api.printer_failure_threshold", api.PrinterFailureThreshold},
+		{"bartender_printer_api.printer_cooldown_seconds", api.PrinterCooldownSeconds},
+		{"bartender_printer_api.circuit_failure_threshold", api.CircuitFailureThreshold},
+		{"bartender_printer_api.circuit_open_seconds", api.CircuitOpenSeconds},
+		{"bartender_printer_api.health_check_interval_seconds", api.HealthCheckIntervalSeconds},
+		{"bartender_tracking_status.poll_interval_ms", tracking.PollIntervalMs},
+		{"bartender_tracking_status.timeout_seconds", tracking.TimeoutSeconds},
+		{"deduplication.retention_hours", c.Deduplication.RetentionHours},
+		{"image_cache.max_size_mb", c.ImageCache.MaxSizeMB},
+		{"image_cache.memory_size_mb", c.ImageCache.MemorySizeMB},
+		{"image_cache.max_image_size_mb", c.ImageCache.MaxImageSizeMB},
+		{"image_cache.revalidate_seconds", c.ImageCache.RevalidateSeconds},
+		{"image_cache.timeout_seconds", c.ImageCache.TimeoutSeconds},
+	} {
+		if n.value < 0 {
+			problems = append(problems, fmt.Sprintf("%s: cannot be negative, got %d, 0 takes the default", n.name, n.value))
+		}
+	}
+	if api.RetryJitter < 0 || api.RetryJitter > 1 {
+		problems = append(problems, fmt.Sprintf("bartender_printer_api.retry_jitter: must be between 0 and 1, got %v", api.RetryJitter))
+	}
+	if api.RetryMaxDelayMs > 0 && api.RetryMaxDelayMs < api.RetryBaseDelayMs {
+		problems = append(problems, fmt.Sprintf("bartender_printer_api.retry_max_delay_ms: %d is below retry_base_delay_ms %d", api.RetryMaxDelayMs, api.RetryBaseDelayMs))
+	}
+	if strings.TrimSpace(c.FileSharePath) == "" {
+		problems = append(problems, "file_share_path: required, the directory Bartender reads the exported files from")
+	}
+	if c.IsUsedImgLocalPath && strings.TrimSpace(c.FileSizeAvailablePath) == "" {
+		problems = append(problems, "file_size_available_path: required when is_used_img_local_path is true")
+	}
+	return problems
+}
+
+// validateFiles checks the directories the service writes to and the files it reads. The
+// Bartender documents are checked when the Bartender folder is reachable from this host.
+func (c *Config) validateFiles() []string {
+	var problems []string
+	for _, file := range []struct{ name, path string }{
+		{"kafka.ssl_ca_location", c.Kafka.SslCaLocation},
+		{"kafka.ssl_certificate_location", c.Kafka.SslCertificateLocation},
+		{"kafka.ssl_key_location", c.Kafka.SslKeyLocation},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", file.name, err))
+		}
+	}
+	if c.FileSharePath != "" {
+		if err := checkWritableDir(c.FileSharePath); err != nil {
+			problems = append(problems, fmt.Sprintf("file_share_path: %v", err))
+		}
+	}
+	if c.IsUsedImgLocalPath && c.FileSizeAvailablePath != "" {
+		if info, err := os.Stat(c.FileSizeAvailablePath); err != nil {
+			problems = append(problems, fmt.Sprintf("file_size_available_path: %v", err))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("file_size_available_path: %s is not a directory", c.FileSizeAvailablePath))
+		} else {
+			for _, e := range c.SizeCharts.Entries {
+				if e.Image == "" {
+					continue
+				}
+				if _, err := os.Stat(filepath.Join(c.FileSizeAvailablePath, e.Image)); err != nil {
+					problems = append(problems, fmt.Sprintf("size_charts: image %s of size %q: %v", e.Image, e.Size, err))
+				}
+			}
+		}
+	}
+
+	root := c.BartenderPrinterAPI.RootPath
+	if root == "" {
+		root = DefaultBartenderRootPath
+	}
+	if info, err := os.Stat(root); err == nil && info.IsDir() {
+		for _, t := range c.Templates {
+			for _, file := range []struct{ name, path string }{
+				{"document_file", t.DocumentFile},
+				{"connection_setup_file", t.ConnectionSetupFile},
+			} {
+				if file.path == "" {
+					continue
+				}
+				// Template paths use Windows separators
+				path := filepath.Join(root, filepath.FromSlash(strings.ReplaceAll(file.path, `\`, "/")))
+				if _, err := os.Stat(path); err != nil {
+					problems = append(problems, fmt.Sprintf("templates[%s]: %s %s not found in %s", t.Key, file.name, file.path, root))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// checkURL reports a URL that is not an absolute http or https URL
+func checkURL(name, value string, required bool) []string {
+	if strings.TrimSpace(value) == "" {
+		if required {
+			return []string{name + ": required"}
+		}
+		return nil
+	}
+	u, err := url.ParseRequestURI(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return []string{fmt.Sprintf("%s: %q is not an http or https URL", name, value)}
+	}
+	return nil
+}
+
+// checkMethod reports an unknown HTTP method, empty takes the default
+func checkMethod(name, method string) []string {
+	switch strings.ToUpper(method) {
+	case "", http.MethodGet, http.MethodPost, http.MethodPut:
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: unknown method %q, expected GET, POST or PUT", name, method)}
+}
+
+// checkWritableDir reports a path that is not a directory the service can create files in
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".config-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
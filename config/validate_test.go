@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir := configDir(t, map[string]string{"config.yml": baseConfig})
+	share := t.TempDir()
+	notADir := filepath.Join(share, "file.txt")
+	if err := os.WriteFile(notADir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		overrides []string
+		want      []string // Reported problems, each found in the error
+	}{
+		{name: "valid"},
+		{
+			name:      "broker without port",
+			overrides: []string{"kafka.bootstrap_servers=broker-1:9092,broker-2"},
+			want:      []string{`kafka.bootstrap_servers: "broker-2" is not host:port`},
+		},
+		{
+			name:      "broker with invalid port",
+			overrides: []string{"kafka.bootstrap_servers=broker-1:99999"},
+			want:      []string{`kafka.bootstrap_servers: "broker-1:99999" has an invalid port`},
+		},
+		{
+			name:      "unknown offset reset",
+			overrides: []string{"kafka.auto_offset_reset=oldest"},
+			want:      []string{`kafka.auto_offset_reset: unknown value "oldest"`},
+		},
+		{
+			name:      "API url without scheme",
+			overrides: []string{"bartender_printer_api.url=localhost:5159/api/actions"},
+			want:      []string{"bartender_printer_api.url: \"localhost:5159/api/actions\" is not an http or https URL"},
+		},
+		{
+			name:      "unknown method",
+			overrides: []string{"bartender_tracking_status.method=FETCH"},
+			want:      []string{`bartender_tracking_status.method: unknown method "FETCH"`},
+		},
+		{
+			name:      "negative size",
+			overrides: []string{"bartender_printer_api.queue_size=-1"},
+			want:      []string{"bartender_printer_api.queue_size: cannot be negative, got -1"},
+		},
+		{
+			name:      "retry delays",
+			overrides: []string{"bartender_printer_api.retry_jitter=1.5", "bartender_printer_api.retry_base_delay_ms=5000", "bartender_printer_api.retry_max_delay_ms=1000"},
+			want: []string{
+				"bartender_printer_api.retry_jitter: must be between 0 and 1, got 1.5",
+				"bartender_printer_api.retry_max_delay_ms: 1000 is below retry_base_delay_ms 5000",
+			},
+		},
+		{
+			name:      "share is a file",
+			overrides: []string{"file_share_path=" + notADir},
+			want:      []string{"file_share_path: " + notADir + " is not a directory"},
+		},
+		{
+			name:      "image directory required",
+			overrides: []string{"is_used_img_local_path=true"},
+			want:      []string{"file_size_available_path: required when is_used_img_local_path is true"},
+		},
+		{
+			name:      "every problem at once",
+			overrides: []string{"kafka.group_id=", "consumer_topic_info.topic_bom_bartender_printer=", "bartender_printer_api.url=", "kafka.commit_interval_ms=-5"},
+			want: []string{
+				"kafka.group_id: required",
+				"consumer_topic_info.topic_bom_bartender_printer: required",
+				"bartender_printer_api.url: required",
+				"kafka.commit_interval_ms: cannot be negative, got -5",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrides := append([]string{"file_share_path=" + share}, tt.overrides...)
+			_, _, err := GetConfigByEnv(Options{Env: EnvDevelopment, Dir: dir, Environ: []string{}, Overrides: overrides})
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("GetConfigByEnv = %v, want a *ValidationError", err)
+			}
+			if len(invalid.Problems) != len(tt.want) {
+				t.Errorf("got %d problems, want %d:\n%v", len(invalid.Problems), len(tt.want), err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error does not report %q:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
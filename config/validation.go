@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"kafka-consumer/application/constant"
+	"kafka-consumer/application/model"
+)
+
+// ValidationRules are the checks the products of a print request must pass before they are exported.
+// The rules of a template extend the global rules, maps are merged field by field. Nothing is
+// checked unless the configuration sets it, the validation block of config.yml is an example.
+type ValidationRules struct {
+	Policy       string              `yaml:"policy"`        // reject_batch (default) or drop_invalid
+	Required     []string            `yaml:"required"`      // Fields that must not be empty
+	Enums        map[string][]string `yaml:"enums"`         // Allowed values by field, case-insensitive
+	Patterns     map[string]string   `yaml:"patterns"`      // Regular expression a non-empty field must match
+	MaxLengths   map[string]int      `yaml:"max_lengths"`   // Max characters of a label field
+	SizeChart    *bool               `yaml:"size_chart"`    // The size must be in the size chart of the gender, default false
+	SizeMismatch *bool               `yaml:"size_mismatch"` // us_size, vn_size and uk_size must be the same size in size_conversions, default false
+}
+
+// CheckSizeChart reports whether the size is checked against the size chart of the gender
+func (r *ValidationRules) CheckSizeChart() bool {
+	return r.SizeChart != nil && *r.SizeChart
+}
+
+// CheckSizeMismatch reports whether the sizes of the markets are checked against each other
+func (r *ValidationRules) CheckSizeMismatch() bool {
+	return r.SizeMismatch != nil && *r.SizeMismatch
+}
+
+// defaultValidationRules check nothing, a configuration written before the validation
+// existed prints every product as it did
+func defaultValidationRules() ValidationRules {
+	return ValidationRules{
+		Policy:     string(constant.ValidationPolicyRejectBatch),
+		Enums:      map[string][]string{},
+		Patterns:   map[string]string{},
+		MaxLengths: map[string]int{},
+	}
+}
+
+// merge returns the rules with the settings of override applied on top
+func (r ValidationRules) merge(override ValidationRules) ValidationRules {
+	merged := ValidationRules{
+		Policy:       r.Policy,
+		Required:     r.Required,
+		Enums:        make(map[string][]string),
+		Patterns:     make(map[string]string),
+		MaxLengths:   make(map[string]int),
+		SizeChart:    r.SizeChart,
+		SizeMismatch: r.SizeMismatch,
+	}
+	if override.Policy != "" {
+		merged.Policy = override.Policy
+	}
+	if override.Required != nil {
+		merged.Required = override.Required
+	}
+	if override.SizeChart != nil {
+		merged.SizeChart = override.SizeChart
+	}
+	if override.SizeMismatch != nil {
+		merged.SizeMismatch = override.SizeMismatch
+	}
+	for field, values := range r.Enums {
+		merged.Enums[field] = values
+	}
+	for field, values := range override.Enums {
+		merged.Enums[field] = values
+	}
+	for field, pattern := range r.Patterns {
+		merged.Patterns[field] = pattern
+	}
+	for field, pattern := range override.Patterns {
+		merged.Patterns[field] = pattern
+	}
+	for field, length := range r.MaxLengths {
+		merged.MaxLengths[field] = length
+	}
+	for field, length := range override.MaxLengths {
+		merged.MaxLengths[field] = length
+	}
+	merged.Policy = strings.ToLower(merged.Policy)
+	return merged
+}
+
+// applyValidationDefaults resolves the validation rules of every template
+func (c *Config) applyValidationDefaults() {
+	c.Validation = defaultValidationRules().merge(c.Validation)
+	for i := range c.Templates {
+		c.Templates[i].Validation = c.Validation.merge(c.Templates[i].Validation)
+	}
+}
+
+// validateValidationRules reports every invalid validation rule of the templates
+func (c *Config) validateValidationRules() []string {
+	var problems []string
+	for _, t := range c.Templates {
+		name := fmt.Sprintf("template %q validation", t.Key)
+		r := t.Validation
+		switch constant.ValidationPolicy(r.Policy) {
+		case constant.ValidationPolicyRejectBatch, constant.ValidationPolicyDropInvalid:
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown policy %q", name, r.Policy))
+		}
+
+		var fields []string
+		fields = append(fields, r.Required...)
+		for field := range r.Enums {
+			fields = append(fields, field)
+		}
+		for field, pattern := range r.Patterns {
+			fields = append(fields, field)
+			if _, err := regexp.Compile(pattern); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid pattern of %s: %v", name, field, err))
+			}
+		}
+		for field, length := range r.MaxLengths {
+			fields = append(fields, field)
+			if length < 1 {
+				problems = append(problems, fmt.Sprintf("%s: max length of %s must be at least 1, got %d", name, field, length))
+			}
+		}
+		for _, field := range fields {
+			if _, ok := (&model.Product{}).FieldValue(field); !ok {
+				problems = append(problems, fmt.Sprintf("%s: unknown field %q", name, field))
+			}
+		}
+	}
+	return problems
+}
@@ -1,42 +1,113 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"kafka-consumer/application/logger"
+	"kafka-consumer/application/secret"
 	"kafka-consumer/application/service"
 	"kafka-consumer/config"
 )
 
+// overrideFlags collects the repeated -set flags
+type overrideFlags []string
+
+func (o *overrideFlags) String() string {
+	return fmt.Sprint(*o)
+}
+
+func (o *overrideFlags) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
 func main() {
-	con, _, err := config.GetConfigByEnv()
+	var opts config.Options
+	var overrides overrideFlags
+	flag.StringVar(&opts.Env, "env", "", "environment: development, qa or production, default $ENV then "+config.DefaultEnv)
+	flag.StringVar(&opts.Path, "config", "", "single configuration file instead of config.yml and the environment file")
+	flag.StringVar(&opts.Dir, "config-dir", "", "directory of the configuration files, default config/ next to the executable then in the working directory")
+	flag.Var(&overrides, "set", "override a setting, e.g. -set kafka.group_id=printer-2, repeatable")
+	checkConfig := flag.Bool("check-config", false, "validate the configuration and exit, without consuming anything")
+	encryptSecret := flag.Bool("encrypt-secret", false, "encrypt the value read from stdin for a password setting and exit")
+	secretKey := flag.String("secret-key", "", "key file of -encrypt-secret, default secret.key next to the config files, created when missing")
+	flag.Parse()
+	opts.Overrides = overrides
+
+	if *encryptSecret {
+		if err := encryptValue(opts, *secretKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encrypt: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// An invalid configuration refuses to start, every problem is reported at once
+	con, env, err := config.GetConfigByEnv(opts)
 	if err != nil {
-		panic("Failed to load config: " + err.Error())
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if *checkConfig {
+		fmt.Printf("Configuration of %s is valid: %d templates, %d printers\n", env, len(con.Templates), len(con.Printers))
+		os.Exit(0)
 	}
 
 	// Initialize logger with config
 	logger.Newlogger(con.Logger)
 	l := logger.GetLogger()
+	l.Infof("Environment: %s", env)
+	l.Infof("Config files: %s", strings.Join(con.Files(), ", "))
+	if overrides := con.Overrides(); len(overrides) > 0 {
+		l.Infof("Config overrides: %s", strings.Join(overrides, ", "))
+	}
 
-	// Create Kafka service with dependencies
-	kafkaService := service.NewKafkaService(l, con)
+	kafkaService, err := startService(l, con)
+	if err != nil {
+		l.Errorf("Failed to create Kafka service: %v", err)
+		os.Exit(1)
+	}
 
-	// Start consumer in a goroutine
-	go func() {
-		if err := kafkaService.StartConsumer(); err != nil {
-			l.Errorf("Failed to start consumer: %v", err)
-			os.Exit(1)
-		}
-	}()
+	// SIGHUP or a change of the config files reloads the configuration
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	stopWatch := watchConfig(con, reloadChan)
 
 	// Wait for shutdown signal
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
-	<-signalChan
+	for waiting := true; waiting; {
+		select {
+		case <-signalChan:
+			waiting = false
+		case <-kafkaService.Done():
+			// Stopped on its own, the supervisor restarts the process to redeliver the messages
+			l.Errorf("Kafka service stopped: %v", kafkaService.Err())
+			kafkaService.Close()
+			os.Exit(1)
+		case <-reloadChan:
+			next, restarted := reloadConfig(l, opts, kafkaService)
+			if restarted != nil {
+				// The restarted service may watch other files or at another interval
+				stopWatch()
+				stopWatch = watchConfig(restarted, reloadChan)
+			}
+			kafkaService = next
+			l = logger.GetLogger()
+		}
+	}
 
 	l.Info("Received shutdown signal, closing consumer...")
+	stopWatch()
 
 	// Gracefully close the Kafka service
 	if err := kafkaService.Close(); err != nil {
@@ -46,3 +117,111 @@ func main() {
 	l.Info("Application shutdown complete")
 	os.Exit(0)
 }
+
+// encryptValue prints the enc: value of the first line of stdin, the key file is generated
+// on first use
+func encryptValue(opts config.Options, keyFile string) error {
+	if keyFile == "" {
+		path, err := config.SecretKeyPath(opts)
+		if err != nil {
+			return err
+		}
+		keyFile = path
+	}
+	key, err := secret.GenerateKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Value to encrypt:")
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		return err
+	}
+	value = strings.TrimRight(value, "\r\n")
+	if value == "" {
+		return errors.New("empty value")
+	}
+	encrypted, err := secret.Encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Encrypted with %s, keep the key file next to the config files\n", keyFile)
+	fmt.Println(encrypted)
+	return nil
+}
+
+// watchConfig sends to reload when the config files change, until the returned function
+// is called
+func watchConfig(con *config.Config, reload chan<- os.Signal) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	if !con.ConfigReload.Enabled {
+		return cancel
+	}
+	interval := con.ConfigReload.IntervalSeconds
+	if interval <= 0 {
+		interval = 5 // Default check the files every 5 seconds
+	}
+	go config.Watch(ctx, con.Files(), time.Duration(interval)*time.Second, func() {
+		select {
+		case reload <- syscall.SIGHUP:
+		default:
+		}
+	})
+	return cancel
+}
+
+// startService creates the Kafka service and starts its consumer
+func startService(l logger.ILogger, con *config.Config) (*service.KafkaService, error) {
+	// Create Kafka service with dependencies
+	kafkaService, err := service.NewKafkaService(l, con)
+	if err != nil {
+		return nil, err
+	}
+
+	// The consumer runs in the background until Close
+	if err := kafkaService.StartConsumer(); err != nil {
+		kafkaService.Close()
+		return nil, fmt.Errorf("failed to start consumer: %w", err)
+	}
+	return kafkaService, nil
+}
+
+// reloadConfig loads the configuration files again and applies them to the running service.
+// It returns the service to keep using, a new one when the consumer was restarted to apply
+// settings that cannot change live, then with the configuration it was started with.
+func reloadConfig(l logger.ILogger, opts config.Options, kafkaService *service.KafkaService) (*service.KafkaService, *config.Config) {
+	con, _, err := config.GetConfigByEnv(opts)
+	if err != nil {
+		l.Errorf("Config reload failed, keeping the running configuration: %v", err)
+		return kafkaService, nil
+	}
+
+	changes, err := kafkaService.Reload(con)
+	for _, c := range changes {
+		l.Infof("Config changed %s", c)
+	}
+	var restart *service.RestartRequiredError
+	switch {
+	case errors.As(err, &restart) && con.ConfigReload.RestartOnUnsafeChange:
+		l.Warnf("Restarting the consumer to apply %s", strings.Join(restart.Settings, ", "))
+		if err := kafkaService.Close(); err != nil {
+			l.Errorf("Error closing Kafka service: %v", err)
+		}
+		logger.Newlogger(con.Logger)
+		l = logger.GetLogger()
+		next, err := startService(l, con)
+		if err != nil {
+			l.Errorf("Failed to restart Kafka service: %v", err)
+			os.Exit(1)
+		}
+		return next, con
+	case err != nil:
+		l.Warnf("Config reload refused, keeping the running configuration: %v. Restart the service or set config_reload.restart_on_unsafe_change", err)
+	case len(changes) == 0:
+		l.Info("Config reloaded, nothing changed")
+	default:
+		l.Infof("Config reloaded, %d settings applied", len(changes))
+	}
+	return kafkaService, nil
+}